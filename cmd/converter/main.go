@@ -1,18 +1,116 @@
 // Package cmd/converter as the entry point of application from the converter side (queue consumer).
+//
+// Usage:
+//
+//	converter                           listen to the queue
+//	converter dlq list [limit]          print the dead-lettered messages (10 by default)
+//	converter dlq replay [request]      move the dead-lettered messages of the request (all by default) back to the queue
+//	converter queue migrate             move the messages of the queue of the previous version to the current queue
+//	converter retention report [limit]  print the expired images without deleting them (100 by default)
+//	converter retention sweep           delete the expired images
+//	converter storage acl               apply the configured AWS_ACL to every stored image
+//	converter users tier email value    set the priority tier of the user (0 to 9)
 package main
 
 import (
 	"context"
 	"fmt"
+	"os"
+	"strconv"
 
 	"github.com/Konstantsiy/image-converter/internal/app"
+	"github.com/Konstantsiy/image-converter/internal/repository"
 	"github.com/Konstantsiy/image-converter/pkg/logger"
 )
 
+const (
+	defaultDeadLettersLimit   = 10
+	defaultExpiredImagesLimit = 100
+)
+
 func main() {
-	err := app.StartListener()
+	err := run(os.Args[1:])
 	if err != nil {
 		logger.FromContext(context.Background()).
 			Errorln(fmt.Errorf("failed to start converter: %v", err))
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	if len(args) == 0 {
+		return app.StartListener()
+	}
+
+	switch {
+	case len(args) >= 2 && args[0] == "dlq":
+		return runDeadLetters(args[1:])
+	case len(args) == 2 && args[0] == "queue" && args[1] == "migrate":
+		return app.MigrateQueue(os.Stdout)
+	case len(args) >= 2 && args[0] == "retention":
+		return runRetention(args[1:])
+	case len(args) == 2 && args[0] == "storage" && args[1] == "acl":
+		return app.ApplyStorageACL(os.Stdout)
+	case len(args) == 4 && args[0] == "users" && args[1] == "tier":
+		return runUserTier(args[2], args[3])
+	}
+
+	return fmt.Errorf("unknown command, needed no arguments, \"dlq list [limit]\", \"dlq replay [request]\", " +
+		"\"queue migrate\", \"retention report [limit]\", \"retention sweep\", \"storage acl\" " +
+		"or \"users tier email value\"")
+}
+
+func runDeadLetters(args []string) error {
+	switch args[0] {
+	case "list":
+		limit, err := parseLimit(args[1:], defaultDeadLettersLimit)
+		if err != nil {
+			return err
+		}
+		return app.ListDeadLetters(os.Stdout, limit)
+	case "replay":
+		requestID := ""
+		if len(args) > 1 {
+			requestID = args[1]
+		}
+		return app.ReplayDeadLetters(requestID)
+	}
+
+	return fmt.Errorf("unknown dlq command %q, needed list or replay", args[0])
+}
+
+func runRetention(args []string) error {
+	switch args[0] {
+	case "report":
+		limit, err := parseLimit(args[1:], defaultExpiredImagesLimit)
+		if err != nil {
+			return err
+		}
+		return app.ReportExpiredImages(os.Stdout, limit)
+	case "sweep":
+		return app.SweepExpiredImages(os.Stdout)
+	}
+
+	return fmt.Errorf("unknown retention command %q, needed report or sweep", args[0])
+}
+
+func runUserTier(email, rawTier string) error {
+	tier, err := strconv.Atoi(rawTier)
+	if err != nil || tier < 0 || tier > repository.MaxPriority {
+		return fmt.Errorf("invalid tier %q, needed a value from 0 to %d", rawTier, repository.MaxPriority)
+	}
+	return app.SetUserPriority(os.Stdout, email, tier)
+}
+
+// parseLimit parses the optional limit argument.
+func parseLimit(args []string, defaultLimit int) (int, error) {
+	if len(args) == 0 {
+		return defaultLimit, nil
+	}
+
+	limit, err := strconv.Atoi(args[0])
+	if err != nil || limit < 1 {
+		return 0, fmt.Errorf("invalid limit %q", args[0])
 	}
+	return limit, nil
 }
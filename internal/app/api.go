@@ -5,6 +5,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/Konstantsiy/image-converter/internal/service"
 
@@ -14,13 +15,18 @@ import (
 
 	"github.com/Konstantsiy/image-converter/internal/config"
 	"github.com/Konstantsiy/image-converter/internal/repository"
+	"github.com/Konstantsiy/image-converter/internal/retention"
 	"github.com/Konstantsiy/image-converter/internal/server"
 	"github.com/Konstantsiy/image-converter/internal/storage"
 	"github.com/Konstantsiy/image-converter/pkg/jwt"
 	"github.com/gorilla/mux"
 )
 
+// shutdownTimeout limits the time the server waits for the active connections on shutdown.
+const shutdownTimeout = 10 * time.Second
+
 // Start starts the application server.
+// With the in-memory queue or the embedded workers the server runs the conversion workers as well.
 func Start() error {
 	r := mux.NewRouter()
 
@@ -45,17 +51,15 @@ func Start() error {
 	}
 	logger.FromContext(context.Background()).Infoln("JWT-manager created successfully")
 
-	st, err := storage.NewStorage(conf.AWSConf)
+	st, err := newStorage(&conf)
 	if err != nil {
-		return fmt.Errorf("can't create storage: %v", err)
+		return err
 	}
-	logger.FromContext(context.Background()).Infoln("AWS S3 connected successfully")
 
-	producer, err := queue.NewRabbitMQProducer(conf.RabbitMQConf)
+	producer, memoryQueue, err := newProducer(&conf, db)
 	if err != nil {
-		return fmt.Errorf("can't create producer: %w", err)
+		return err
 	}
-	logger.FromContext(context.Background()).Infoln("RabbitMQ client (producer) initialized successfully")
 
 	usersRepo, err := repository.NewUsersRepository(db)
 	if err != nil {
@@ -72,12 +76,112 @@ func Start() error {
 		return fmt.Errorf("requests repository creating error: %w", err)
 	}
 
-	authService := service.NewAuthService(usersRepo, tokenManager)
-	imagesService := service.NewImageService(imageRepo, requestsRepo, st)
-	requestsService := service.NewRequestsService(requestsRepo)
+	batchesRepo, err := repository.NewBatchesRepository(db)
+	if err != nil {
+		return fmt.Errorf("batches repository creating error: %w", err)
+	}
+
+	webhooksRepo, err := repository.NewWebhooksRepository(db)
+	if err != nil {
+		return fmt.Errorf("webhooks repository creating error: %w", err)
+	}
 
-	s := server.NewServer(authService, imagesService, requestsService, producer)
+	tokensRepo, err := repository.NewRefreshTokensRepository(db)
+	if err != nil {
+		return fmt.Errorf("refresh tokens repository creating error: %w", err)
+	}
+
+	accountJobsRepo, err := repository.NewAccountJobsRepository(db)
+	if err != nil {
+		return fmt.Errorf("account jobs repository creating error: %w", err)
+	}
+
+	authService := service.NewAuthService(usersRepo, tokensRepo, tokenManager)
+	imagesService := service.NewImageService(imageRepo, requestsRepo, usersRepo, st)
+	batchService := service.NewBatchService(batchesRepo, imagesService, st)
+	webhookService := service.NewWebhooksService(webhooksRepo)
+	accountService := service.NewAccountService(accountJobsRepo, usersRepo, requestsRepo, imageRepo, st, conf.AccountsConf)
+
+	eventsListener, err := repository.NewRequestEventsListener(conf.DBConf)
+	if err != nil {
+		return fmt.Errorf("can't create request events listener: %w", err)
+	}
+	defer eventsListener.Close()
+	logger.FromContext(context.Background()).Infoln("request events listener started")
+
+	eventsBroker := service.NewRequestEventsBroker()
+	go eventsBroker.Run(eventsListener.Events())
+
+	requestsService := service.NewRequestsService(requestsRepo, imageRepo, st, eventsBroker)
+
+	outboxRepo, err := repository.NewOutboxRepository(db)
+	if err != nil {
+		return fmt.Errorf("outbox repository creating error: %w", err)
+	}
+
+	// The in-memory queue loses the messages on restart, the unfinished requests are sent to it once again.
+	if memoryQueue != nil {
+		count, err := outboxRepo.RequeueRequests(context.Background())
+		if err != nil {
+			return fmt.Errorf("can't requeue unfinished requests: %w", err)
+		}
+		logger.FromContext(context.Background()).WithField("count", count).Infoln("unfinished requests requeued")
+	}
+
+	ctx, cancel := contextWithSignal()
+	defer cancel()
+	go queue.NewOutboxRelay(outboxRepo, producer, conf.RabbitMQConf.OutboxInterval).Run(ctx)
+	logger.FromContext(context.Background()).Infoln("outbox relay started")
+
+	go retention.NewSweeper(imageRepo, st, conf.RetentionConf).Run(ctx)
+	logger.FromContext(context.Background()).WithField("dry_run", conf.RetentionConf.DryRun).
+		Infoln("retention sweeper started")
+
+	go accountService.Run(ctx)
+	logger.FromContext(context.Background()).Infoln("account jobs runner started")
+
+	var workersDone chan struct{}
+	if memoryQueue != nil || conf.QueueConf.EmbeddedWorkers {
+		consumer, err := newConsumer(&conf, db, st, memoryQueue)
+		if err != nil {
+			return err
+		}
+
+		workersDone = make(chan struct{})
+		go func() {
+			defer close(workersDone)
+			if err := consumer.Listen(ctx); err != nil {
+				logger.FromContext(ctx).Errorln(fmt.Errorf("can't listen to the queue: %w", err))
+				cancel()
+			}
+		}()
+		logger.FromContext(context.Background()).Infoln("conversion workers started")
+	}
+
+	s := server.NewServer(authService, imagesService, requestsService, batchService, webhookService, eventsBroker, accountService)
 	s.RegisterRoutes(r)
+	if files, ok := st.(storage.SignedFiles); ok {
+		s.RegisterFileRoutes(r, files)
+	}
+
+	srv := &http.Server{Addr: ":" + conf.AppPort, Handler: r}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancelShutdown()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			logger.FromContext(ctx).Errorln(fmt.Errorf("can't shut down the server: %w", err))
+		}
+	}()
+
+	err = srv.ListenAndServe()
+	cancel()
+	if workersDone != nil {
+		<-workersDone
+	}
+	if err != http.ErrServerClosed {
+		return err
+	}
 
-	return http.ListenAndServe(":"+conf.AppPort, r)
+	return nil
 }
@@ -0,0 +1,104 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/Konstantsiy/image-converter/internal/config"
+	"github.com/Konstantsiy/image-converter/internal/queue"
+	"github.com/Konstantsiy/image-converter/internal/repository"
+	"github.com/Konstantsiy/image-converter/internal/storage"
+	"github.com/Konstantsiy/image-converter/internal/webhook"
+	"github.com/Konstantsiy/image-converter/pkg/logger"
+)
+
+// newProducer creates the producer of the configured queue.
+// The in-memory queue is returned as well, its consumer has to run in the same process.
+func newProducer(conf *config.Config, db *sql.DB) (queue.Producer, *queue.MemoryQueue, error) {
+	switch conf.QueueConf.Backend {
+	case queue.BackendPostgres:
+		jobsRepo, err := repository.NewJobsRepository(db)
+		if err != nil {
+			return nil, nil, fmt.Errorf("jobs repository creating error: %w", err)
+		}
+		return queue.NewPostgresProducer(jobsRepo), nil, nil
+	case queue.BackendMemory:
+		memoryQueue := queue.NewMemoryQueue(conf.QueueConf.Size)
+		logger.FromContext(context.Background()).Infoln("in-memory queue created successfully")
+		return memoryQueue, memoryQueue, nil
+	case queue.BackendRabbitMQ:
+		producer, err := queue.NewRabbitMQProducer(conf.RabbitMQConf)
+		if err != nil {
+			return nil, nil, fmt.Errorf("can't create producer: %w", err)
+		}
+		logger.FromContext(context.Background()).Infoln("RabbitMQ client (producer) initialized successfully")
+		return producer, nil, nil
+	}
+
+	return nil, nil, fmt.Errorf("unknown queue backend %q", conf.QueueConf.Backend)
+}
+
+// newConsumer creates the consumer of the configured queue, memoryQueue is required by the in-memory backend.
+func newConsumer(conf *config.Config, db *sql.DB, st storage.Storage, memoryQueue *queue.MemoryQueue) (queue.Consumer, error) {
+	imageRepo, err := repository.NewImagesRepository(db)
+	if err != nil {
+		return nil, fmt.Errorf("images repository creating error: %w", err)
+	}
+
+	requestsRepo, err := repository.NewRequestsRepository(db)
+	if err != nil {
+		return nil, fmt.Errorf("requests repository creating error: %w", err)
+	}
+
+	webhooksRepo, err := repository.NewWebhooksRepository(db)
+	if err != nil {
+		return nil, fmt.Errorf("webhooks repository creating error: %w", err)
+	}
+	notifier := webhook.NewNotifier(webhooksRepo)
+
+	switch conf.QueueConf.Backend {
+	case queue.BackendMemory:
+		if memoryQueue == nil {
+			return nil, fmt.Errorf("the in-memory queue is consumed by the API server only")
+		}
+		return queue.NewMemoryConsumer(memoryQueue, requestsRepo, imageRepo, st, notifier, conf.RabbitMQConf), nil
+	case queue.BackendPostgres:
+		jobsRepo, err := repository.NewJobsRepository(db)
+		if err != nil {
+			return nil, fmt.Errorf("jobs repository creating error: %w", err)
+		}
+		return queue.NewPostgresConsumer(jobsRepo, requestsRepo, imageRepo, st, notifier, conf.RabbitMQConf, conf.QueueConf), nil
+	case queue.BackendRabbitMQ:
+		consumer, err := queue.NewRabbitMQConsumer(requestsRepo, imageRepo, st, notifier, conf.RabbitMQConf)
+		if err != nil {
+			return nil, fmt.Errorf("can't create consumer: %w", err)
+		}
+		logger.FromContext(context.Background()).Infoln("RabbitMQ client (consumer) initialized successfully")
+		return consumer, nil
+	}
+
+	return nil, fmt.Errorf("unknown queue backend %q", conf.QueueConf.Backend)
+}
+
+// contextWithSignal returns the context canceled on SIGINT or SIGTERM.
+func contextWithSignal() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		defer signal.Stop(signals)
+		select {
+		case sig := <-signals:
+			logger.FromContext(ctx).WithField("signal", sig.String()).Infoln("shutdown signal received")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, cancel
+}
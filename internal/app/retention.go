@@ -0,0 +1,70 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/Konstantsiy/image-converter/internal/config"
+	"github.com/Konstantsiy/image-converter/internal/repository"
+	"github.com/Konstantsiy/image-converter/internal/retention"
+)
+
+// ReportExpiredImages writes up to limit expired images as JSON lines without deleting them.
+func ReportExpiredImages(w io.Writer, limit int) error {
+	return withSweeper(func(sweeper *retention.Sweeper) error {
+		images, err := sweeper.Report(context.Background(), limit)
+		if err != nil {
+			return fmt.Errorf("can't report expired images: %w", err)
+		}
+
+		enc := json.NewEncoder(w)
+		for _, image := range images {
+			if err = enc.Encode(image); err != nil {
+				return fmt.Errorf("can't write expired image: %w", err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// SweepExpiredImages deletes the expired images once and writes the number of deleted images.
+func SweepExpiredImages(w io.Writer) error {
+	return withSweeper(func(sweeper *retention.Sweeper) error {
+		removed, err := sweeper.Sweep(context.Background())
+		if err != nil {
+			return fmt.Errorf("can't sweep expired images after %d files: %w", removed, err)
+		}
+
+		_, err = fmt.Fprintf(w, "%d expired images deleted\n", removed)
+		return err
+	})
+}
+
+// withSweeper connects to the database and the storage and calls fn with the sweeper of the expired images.
+func withSweeper(fn func(sweeper *retention.Sweeper) error) error {
+	conf, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("can't load configs: %w", err)
+	}
+
+	db, err := repository.NewPostgresDB(conf.DBConf)
+	if err != nil {
+		return fmt.Errorf("can't connect to postgres database: %v", err)
+	}
+	defer db.Close()
+
+	imagesRepo, err := repository.NewImagesRepository(db)
+	if err != nil {
+		return fmt.Errorf("images repository creating error: %w", err)
+	}
+
+	st, err := newStorage(&conf)
+	if err != nil {
+		return err
+	}
+
+	return fn(retention.NewSweeper(imagesRepo, st, conf.RetentionConf))
+}
@@ -0,0 +1,59 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/Konstantsiy/image-converter/internal/config"
+	"github.com/Konstantsiy/image-converter/internal/storage"
+	"github.com/Konstantsiy/image-converter/pkg/logger"
+)
+
+// newStorage creates the configured images storage.
+func newStorage(conf *config.Config) (storage.Storage, error) {
+	switch conf.StorageConf.Backend {
+	case storage.BackendLocal:
+		st, err := storage.NewLocalStorage(conf.StorageConf)
+		if err != nil {
+			return nil, fmt.Errorf("can't create storage: %w", err)
+		}
+		logger.FromContext(context.Background()).WithField("dir", conf.StorageConf.Dir).
+			Infoln("local storage created successfully")
+		return st, nil
+	case storage.BackendS3:
+		st, err := storage.NewStorage(conf.AWSConf)
+		if err != nil {
+			return nil, fmt.Errorf("can't create storage: %w", err)
+		}
+		logger.FromContext(context.Background()).Infoln("AWS S3 connected successfully")
+		return st, nil
+	}
+
+	return nil, fmt.Errorf("unknown storage backend %q", conf.StorageConf.Backend)
+}
+
+// ApplyStorageACL sets the configured AWS ACL on every stored image, e.g. makes the public images private.
+func ApplyStorageACL(w io.Writer) error {
+	conf, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("can't load configs: %w", err)
+	}
+
+	if conf.StorageConf.Backend != storage.BackendS3 {
+		return fmt.Errorf("ACL needs the %s storage, got %q", storage.BackendS3, conf.StorageConf.Backend)
+	}
+
+	st, err := storage.NewStorage(conf.AWSConf)
+	if err != nil {
+		return fmt.Errorf("can't create storage: %w", err)
+	}
+
+	updated, err := st.ApplyACL()
+	if err != nil {
+		return fmt.Errorf("can't apply ACL after %d files: %w", updated, err)
+	}
+
+	_, err = fmt.Fprintf(w, "ACL %s applied to %d files\n", conf.AWSConf.ACL, updated)
+	return err
+}
@@ -0,0 +1,36 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/Konstantsiy/image-converter/internal/config"
+	"github.com/Konstantsiy/image-converter/internal/repository"
+)
+
+// SetUserPriority sets the priority tier of the user with the given email and writes the result.
+func SetUserPriority(w io.Writer, email string, priority int) error {
+	conf, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("can't load configs: %w", err)
+	}
+
+	db, err := repository.NewPostgresDB(conf.DBConf)
+	if err != nil {
+		return fmt.Errorf("can't connect to postgres database: %v", err)
+	}
+	defer db.Close()
+
+	usersRepo, err := repository.NewUsersRepository(db)
+	if err != nil {
+		return fmt.Errorf("users repository creating error: %w", err)
+	}
+
+	if err = usersRepo.SetUserPriority(context.Background(), email, priority); err != nil {
+		return fmt.Errorf("can't set priority of %s: %w", email, err)
+	}
+
+	_, err = fmt.Fprintf(w, "priority of %s set to %d\n", email, priority)
+	return err
+}
@@ -2,14 +2,15 @@ package app
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 
 	"github.com/Konstantsiy/image-converter/pkg/logger"
 
 	"github.com/Konstantsiy/image-converter/internal/config"
 	"github.com/Konstantsiy/image-converter/internal/queue"
 	"github.com/Konstantsiy/image-converter/internal/repository"
-	"github.com/Konstantsiy/image-converter/internal/storage"
 )
 
 // StartListener starts the queue listener.
@@ -28,32 +29,110 @@ func StartListener() error {
 		WithField("host", conf.DBConf.Host).WithField("port", conf.DBConf.Port).
 		Infoln("database connected successfully")
 
-	st, err := storage.NewStorage(conf.AWSConf)
+	st, err := newStorage(&conf)
 	if err != nil {
-		return fmt.Errorf("can't create storage: %w", err)
+		return err
 	}
-	logger.FromContext(context.Background()).Infoln("AWS S3 connected successfully")
 
-	imageRepo, err := repository.NewImagesRepository(db)
+	consumer, err := newConsumer(&conf, db, st, nil)
 	if err != nil {
-		return fmt.Errorf("images repository creating error: %w", err)
+		return err
 	}
 
+	ctx, cancel := contextWithSignal()
+	defer cancel()
+
+	logger.FromContext(context.Background()).Infoln("queue is listening")
+	err = consumer.Listen(ctx)
+	if err != nil {
+		return fmt.Errorf("can't start listening to the queue: %w", err)
+	}
+
+	return nil
+}
+
+// MigrateQueue moves the messages of the work queue of the previous version to the current work queue
+// and writes the number of moved messages.
+func MigrateQueue(w io.Writer) error {
+	conf, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("can't load configs: %w", err)
+	}
+
+	moved, err := queue.MigrateQueue(conf.RabbitMQConf)
+	if err != nil {
+		return fmt.Errorf("can't migrate queue after %d messages: %w", moved, err)
+	}
+
+	_, err = fmt.Fprintf(w, "%d messages moved to the current queue\n", moved)
+	return err
+}
+
+// ListDeadLetters writes up to limit messages of the dead-letter queue as JSON lines.
+func ListDeadLetters(w io.Writer, limit int) error {
+	conf, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("can't load configs: %w", err)
+	}
+
+	dlq, err := queue.NewDeadLetterQueue(conf.RabbitMQConf)
+	if err != nil {
+		return fmt.Errorf("can't create dead-letter queue client: %w", err)
+	}
+	defer dlq.Close()
+
+	letters, err := dlq.List(limit)
+	if err != nil {
+		return fmt.Errorf("can't list dead-lettered messages: %w", err)
+	}
+
+	enc := json.NewEncoder(w)
+	for _, letter := range letters {
+		if err = enc.Encode(letter); err != nil {
+			return fmt.Errorf("can't write dead-lettered message: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// ReplayDeadLetters moves the dead-lettered messages of the request (all messages if the request id is empty)
+// back to the work queue and marks their requests queued.
+func ReplayDeadLetters(requestID string) error {
+	conf, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("can't load configs: %w", err)
+	}
+
+	db, err := repository.NewPostgresDB(conf.DBConf)
+	if err != nil {
+		return fmt.Errorf("can't connect to postgres database: %v", err)
+	}
+	defer db.Close()
+
 	requestsRepo, err := repository.NewRequestsRepository(db)
 	if err != nil {
 		return fmt.Errorf("requests repository creating error: %w", err)
 	}
 
-	consumer, err := queue.NewRabbitMQConsumer(requestsRepo, imageRepo, st, conf.RabbitMQConf)
+	dlq, err := queue.NewDeadLetterQueue(conf.RabbitMQConf)
 	if err != nil {
-		return fmt.Errorf("can't create consumer: %w", err)
+		return fmt.Errorf("can't create dead-letter queue client: %w", err)
 	}
-	logger.FromContext(context.Background()).Infoln("RabbitMQ client (consumer) initialized successfully")
+	defer dlq.Close()
 
-	logger.FromContext(context.Background()).Infoln("queue is listening")
-	err = consumer.Listen()
+	ctx := context.Background()
+	letters, err := dlq.Replay(requestID)
+	for _, letter := range letters {
+		uErr := requestsRepo.UpdateRequestError(ctx, letter.RequestID, repository.RequestStatusQueued, 0, letter.LastError)
+		if uErr != nil {
+			logger.FromContext(ctx).WithField("request_id", letter.RequestID).
+				Errorln(fmt.Errorf("can't update request: %w", uErr))
+		}
+	}
+	logger.FromContext(ctx).WithField("count", len(letters)).Infoln("dead-lettered messages replayed")
 	if err != nil {
-		return fmt.Errorf("can't start listening to the queue: %w", err)
+		return fmt.Errorf("can't replay dead-lettered messages: %w", err)
 	}
 
 	return nil
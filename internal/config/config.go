@@ -2,6 +2,8 @@
 package config
 
 import (
+	"time"
+
 	"github.com/kelseyhightower/envconfig"
 )
 
@@ -16,11 +18,37 @@ type DBConfig struct {
 }
 
 // AWSConfig required to configure the AWS S3 bucket.
+// Endpoint points the client to an S3-compatible store (MinIO, Ceph), such stores usually need ForcePathStyle.
+// Without the static keys the credentials are taken from the shared Profile or the default chain
+// (environment, shared credentials file, IAM role).
+// The files are uploaded in parts of UploadPartSize bytes, UploadConcurrency parts at once.
+// The objects are uploaded with the canned ACL (private by default), the optional StorageClass
+// and the server-side encryption SSE, "AES256" (SSE-S3) or "aws:kms" (SSE-KMS with the optional SSEKMSKeyID).
 type AWSConfig struct {
-	Region          string `envconfig:"REGION"`
-	AccessKeyID     string `envconfig:"ACCESS_KEY_ID"`
-	SecretAccessKey string `envconfig:"SECRET_ACCESS_KEY"`
-	BucketName      string `envconfig:"BUCKET_NAME"`
+	Region            string `envconfig:"REGION"`
+	AccessKeyID       string `envconfig:"ACCESS_KEY_ID"`
+	SecretAccessKey   string `envconfig:"SECRET_ACCESS_KEY"`
+	BucketName        string `envconfig:"BUCKET_NAME"`
+	Endpoint          string `envconfig:"ENDPOINT"`
+	ForcePathStyle    bool   `envconfig:"FORCE_PATH_STYLE" default:"false"`
+	DisableSSL        bool   `envconfig:"DISABLE_SSL" default:"false"`
+	Profile           string `envconfig:"PROFILE"`
+	UploadPartSize    int64  `envconfig:"UPLOAD_PART_SIZE" default:"5242880"`
+	UploadConcurrency int    `envconfig:"UPLOAD_CONCURRENCY" default:"2"`
+	ACL               string `envconfig:"ACL" default:"private"`
+	StorageClass      string `envconfig:"STORAGE_CLASS"`
+	SSE               string `envconfig:"SSE"`
+	SSEKMSKeyID       string `envconfig:"SSE_KMS_KEY_ID"`
+}
+
+// StorageConfig selects the images storage, "s3" or "local".
+// The local storage keeps the files in Dir, its download URLs point to the API server at PublicURL
+// and are signed with SigningKey.
+type StorageConfig struct {
+	Backend    string `envconfig:"BACKEND" default:"s3"`
+	Dir        string `envconfig:"DIR" default:"data"`
+	SigningKey string `envconfig:"SIGNING_KEY"`
+	PublicURL  string `envconfig:"PUBLIC_URL" default:"http://localhost:8080"`
 }
 
 // JWTConfig required for configuring work with JWT.
@@ -29,18 +57,68 @@ type JWTConfig struct {
 }
 
 // RabbitMQConfig required to configure the RabbitMQ.
+// A failed message is retried MaxRetries times, the delay before the n-th retry is RetryDelay * 2^(n-1).
+// The consumer processes up to Workers messages at once, each conversion is limited by ConversionTimeout.
+// The lost connection is restored with the delay starting from ReconnectDelay and doubled on every failed attempt.
+// The producer waits ConfirmTimeout for the publisher confirmation, the outbox is relayed every OutboxInterval.
 type RabbitMQConfig struct {
-	QueueName         string `envconfig:"QUEUE_NAME"`
-	AMQPConnectionURL string `envconfig:"AMQP_CONNECTION_URL"`
+	QueueName         string        `envconfig:"QUEUE_NAME"`
+	AMQPConnectionURL string        `envconfig:"AMQP_CONNECTION_URL"`
+	MaxRetries        int           `envconfig:"MAX_RETRIES" default:"3"`
+	RetryDelay        time.Duration `envconfig:"RETRY_DELAY" default:"5s"`
+	Workers           int           `envconfig:"WORKERS" default:"4"`
+	ConversionTimeout time.Duration `envconfig:"CONVERSION_TIMEOUT" default:"2m"`
+	ReconnectDelay    time.Duration `envconfig:"RECONNECT_DELAY" default:"1s"`
+	ConfirmTimeout    time.Duration `envconfig:"CONFIRM_TIMEOUT" default:"5s"`
+	OutboxInterval    time.Duration `envconfig:"OUTBOX_INTERVAL" default:"1s"`
+}
+
+// QueueConfig selects the queue implementation, "rabbitmq", "postgres" or "memory".
+// The in-memory queue keeps up to Size messages and is consumed by the workers of the API server.
+// EmbeddedWorkers makes the API server run the workers with the other queues as well.
+// The postgres queue leases the job to the worker for LeaseTimeout and checks for new jobs every PollInterval.
+type QueueConfig struct {
+	Backend         string        `envconfig:"BACKEND" default:"rabbitmq"`
+	Size            int           `envconfig:"SIZE" default:"1000"`
+	EmbeddedWorkers bool          `envconfig:"EMBEDDED_WORKERS" default:"false"`
+	LeaseTimeout    time.Duration `envconfig:"LEASE_TIMEOUT" default:"1m"`
+	PollInterval    time.Duration `envconfig:"POLL_INTERVAL" default:"1s"`
+}
+
+// RetentionConfig determines how long the stored images are kept after their requests, zero keeps them forever.
+// The originals are kept for Original and the converted images with their renditions for Converted,
+// the users may have their own retention. The sweeper deletes up to BatchSize expired images at once every Interval,
+// with DryRun it only reports them.
+type RetentionConfig struct {
+	Original  time.Duration `envconfig:"ORIGINAL" default:"0"`
+	Converted time.Duration `envconfig:"CONVERTED" default:"0"`
+	Interval  time.Duration `envconfig:"INTERVAL" default:"1h"`
+	BatchSize int           `envconfig:"BATCH_SIZE" default:"100"`
+	DryRun    bool          `envconfig:"DRY_RUN" default:"false"`
+}
+
+// AccountJobsConfig configures the background account deletion and export jobs.
+// The runner checks for new jobs every PollInterval and leases the job for LeaseTimeout.
+// The failed job is retried after RetryDelay up to MaxAttempts times, the deletion waits
+// for the user's unfinished requests without the limit.
+type AccountJobsConfig struct {
+	PollInterval time.Duration `envconfig:"POLL_INTERVAL" default:"1s"`
+	LeaseTimeout time.Duration `envconfig:"LEASE_TIMEOUT" default:"10m"`
+	RetryDelay   time.Duration `envconfig:"RETRY_DELAY" default:"30s"`
+	MaxAttempts  int           `envconfig:"MAX_ATTEMPTS" default:"5"`
 }
 
 // Config represents the application configurations.
 type Config struct {
-	AppPort      string          `envconfig:"APP_PORT"`
-	DBConf       *DBConfig       `envconfig:"DB"`
-	JWTConf      *JWTConfig      `envconfig:"JWT"`
-	AWSConf      *AWSConfig      `envconfig:"AWS"`
-	RabbitMQConf *RabbitMQConfig `envconfig:"RABBITMQ"`
+	AppPort       string             `envconfig:"APP_PORT"`
+	DBConf        *DBConfig          `envconfig:"DB"`
+	JWTConf       *JWTConfig         `envconfig:"JWT"`
+	AWSConf       *AWSConfig         `envconfig:"AWS"`
+	StorageConf   *StorageConfig     `envconfig:"STORAGE"`
+	RabbitMQConf  *RabbitMQConfig    `envconfig:"RABBITMQ"`
+	QueueConf     *QueueConfig       `envconfig:"QUEUE"`
+	RetentionConf *RetentionConfig   `envconfig:"RETENTION"`
+	AccountsConf  *AccountJobsConfig `envconfig:"ACCOUNT_JOBS"`
 }
 
 // Load loads the necessary configurations.
@@ -0,0 +1,170 @@
+package converter
+
+import (
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+	"golang.org/x/image/webp"
+)
+
+const (
+	// minRatio is the smallest compression ratio accepted by the built-in codecs.
+	minRatio = 1
+	// maxRatio is the largest compression ratio accepted by the built-in codecs.
+	maxRatio = 99
+	// maxGIFColors is the largest palette a GIF image may have.
+	maxGIFColors = 256
+	// minGIFColors is the smallest palette used for GIF images.
+	minGIFColors = 2
+)
+
+// EncodeOptions represents the parameters passed to the codec encoder.
+type EncodeOptions struct {
+	// Ratio is the compression ratio, its meaning depends on the format.
+	Ratio int
+	// ICCProfile is the color profile to embed, if the format supports it.
+	ICCProfile []byte
+	// EXIF is the EXIF payload (TIFF structure) to embed, if the format supports it.
+	EXIF []byte
+}
+
+// Codec decodes and encodes images of a single format.
+type Codec interface {
+	// Format returns the canonical name of the format.
+	Format() string
+	// Aliases returns alternative names of the format, for example file extensions.
+	Aliases() []string
+	// RatioRange returns the inclusive range of the compression ratio accepted by the encoder.
+	RatioRange() (min, max int)
+	// Decode reads the image from r.
+	Decode(r io.Reader) (image.Image, error)
+	// Encode writes the image to w.
+	Encode(w io.Writer, img image.Image, opts EncodeOptions) error
+}
+
+// DecodeOnlyCodec is implemented by the codecs that have no encoder,
+// such formats are accepted as the source format only.
+type DecodeOnlyCodec interface {
+	DecodeOnly() bool
+}
+
+// ConfigDecoder is implemented by the codecs able to read the image dimensions without decoding the image,
+// the dimensions are checked against MaxPixels before decoding.
+type ConfigDecoder interface {
+	DecodeConfig(r io.Reader) (image.Config, error)
+}
+
+// jpegCodec maps the ratio to the JPEG quality.
+type jpegCodec struct{}
+
+func (jpegCodec) Format() string                          { return FormatJPG }
+func (jpegCodec) Aliases() []string                       { return []string{FormatJPEG} }
+func (jpegCodec) RatioRange() (int, int)                  { return minRatio, maxRatio }
+func (jpegCodec) Decode(r io.Reader) (image.Image, error) { return jpeg.Decode(r) }
+
+func (jpegCodec) DecodeConfig(r io.Reader) (image.Config, error) { return jpeg.DecodeConfig(r) }
+
+func (jpegCodec) Encode(w io.Writer, img image.Image, opts EncodeOptions) error {
+	md := metadata{exif: opts.EXIF, icc: opts.ICCProfile}
+	mw := newMetadataWriter(w, 2, func(head []byte) []byte { return embedJPEGMetadata(head, md) })
+	if err := jpeg.Encode(mw, img, &jpeg.Options{Quality: opts.Ratio}); err != nil {
+		return err
+	}
+	return mw.Close()
+}
+
+// pngCodec maps the ratio to the compression level:
+// the higher the ratio, the less effort is spent on compression.
+type pngCodec struct{}
+
+func (pngCodec) Format() string                          { return FormatPNG }
+func (pngCodec) Aliases() []string                       { return nil }
+func (pngCodec) RatioRange() (int, int)                  { return minRatio, maxRatio }
+func (pngCodec) Decode(r io.Reader) (image.Image, error) { return png.Decode(r) }
+
+func (pngCodec) DecodeConfig(r io.Reader) (image.Config, error) { return png.DecodeConfig(r) }
+
+func (pngCodec) Encode(w io.Writer, img image.Image, opts EncodeOptions) error {
+	enc := png.Encoder{CompressionLevel: png.BestCompression}
+	switch {
+	case opts.Ratio > 2*maxRatio/3:
+		enc.CompressionLevel = png.BestSpeed
+	case opts.Ratio > maxRatio/3:
+		enc.CompressionLevel = png.DefaultCompression
+	}
+
+	md := metadata{exif: opts.EXIF, icc: opts.ICCProfile}
+	mw := newMetadataWriter(w, pngIHDREnd, func(head []byte) []byte { return embedPNGMetadata(head, md) })
+	if err := enc.Encode(mw, img); err != nil {
+		return err
+	}
+	return mw.Close()
+}
+
+// webpCodec only decodes WebP images, there is no WebP encoder.
+type webpCodec struct{}
+
+func (webpCodec) Format() string                          { return FormatWebP }
+func (webpCodec) Aliases() []string                       { return nil }
+func (webpCodec) RatioRange() (int, int)                  { return minRatio, maxRatio }
+func (webpCodec) Decode(r io.Reader) (image.Image, error) { return webp.Decode(r) }
+
+func (webpCodec) DecodeConfig(r io.Reader) (image.Config, error) { return webp.DecodeConfig(r) }
+func (webpCodec) DecodeOnly() bool                               { return true }
+
+func (webpCodec) Encode(io.Writer, image.Image, EncodeOptions) error {
+	return ErrDecodeOnly
+}
+
+// gifCodec maps the ratio to the number of palette colors.
+type gifCodec struct{}
+
+func (gifCodec) Format() string                          { return FormatGIF }
+func (gifCodec) Aliases() []string                       { return nil }
+func (gifCodec) RatioRange() (int, int)                  { return minRatio, maxRatio }
+func (gifCodec) Decode(r io.Reader) (image.Image, error) { return gif.Decode(r) }
+
+func (gifCodec) DecodeConfig(r io.Reader) (image.Config, error) { return gif.DecodeConfig(r) }
+
+func (gifCodec) Encode(w io.Writer, img image.Image, opts EncodeOptions) error {
+	return gif.Encode(w, img, &gif.Options{
+		NumColors: minGIFColors + (maxGIFColors-minGIFColors)*opts.Ratio/maxRatio,
+	})
+}
+
+// bmpCodec ignores the ratio, BMP images are never compressed. The ratio is still validated,
+// so that the request doesn't depend on the target format.
+type bmpCodec struct{}
+
+func (bmpCodec) Format() string                          { return FormatBMP }
+func (bmpCodec) Aliases() []string                       { return nil }
+func (bmpCodec) RatioRange() (int, int)                  { return minRatio, maxRatio }
+func (bmpCodec) Decode(r io.Reader) (image.Image, error) { return bmp.Decode(r) }
+
+func (bmpCodec) DecodeConfig(r io.Reader) (image.Config, error) { return bmp.DecodeConfig(r) }
+
+func (bmpCodec) Encode(w io.Writer, img image.Image, _ EncodeOptions) error {
+	return bmp.Encode(w, img)
+}
+
+// tiffCodec keeps the image uncompressed for high ratios and uses Deflate with a predictor for the rest.
+type tiffCodec struct{}
+
+func (tiffCodec) Format() string                          { return FormatTIFF }
+func (tiffCodec) Aliases() []string                       { return []string{FormatTIF} }
+func (tiffCodec) RatioRange() (int, int)                  { return minRatio, maxRatio }
+func (tiffCodec) Decode(r io.Reader) (image.Image, error) { return tiff.Decode(r) }
+
+func (tiffCodec) DecodeConfig(r io.Reader) (image.Config, error) { return tiff.DecodeConfig(r) }
+
+func (tiffCodec) Encode(w io.Writer, img image.Image, opts EncodeOptions) error {
+	if opts.Ratio > 2*maxRatio/3 {
+		return tiff.Encode(w, img, &tiff.Options{Compression: tiff.Uncompressed})
+	}
+	return tiff.Encode(w, img, &tiff.Options{Compression: tiff.Deflate, Predictor: true})
+}
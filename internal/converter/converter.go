@@ -1,12 +1,11 @@
 // Package converter implements functionality for converting and compressing images.
+//
+// Every supported format is handled by a Codec kept in a Registry, new formats are added by registering
+// their codecs. The package level functions use DefaultRegistry, which holds the built-in codecs.
 package converter
 
 import (
-	"bytes"
-	"fmt"
-	"image"
-	"image/jpeg"
-	"image/png"
+	"context"
 	"io"
 )
 
@@ -17,35 +16,34 @@ const (
 	FormatJPG = "jpg"
 	// FormatPNG represents PNG image format.
 	FormatPNG = "png"
+	// FormatWebP represents WebP image format.
+	FormatWebP = "webp"
+	// FormatGIF represents GIF image format.
+	FormatGIF = "gif"
+	// FormatBMP represents BMP image format.
+	FormatBMP = "bmp"
+	// FormatTIFF represents TIFF image format.
+	FormatTIFF = "tiff"
+	// FormatTIF represents TIF image format.
+	FormatTIF = "tif"
 )
 
-// Convert converts and compresses the given image file according to the target format and compression ratio.
-func Convert(reader io.Reader, targetFormat string, ratio int) (io.ReadSeeker, error) {
-	imageData, _, err := image.Decode(reader)
-	if err != nil {
-		return nil, fmt.Errorf("can't decode source file: %w", err)
-	}
+// Convert converts and compresses the given image file with the codecs of the default registry.
+func Convert(ctx context.Context, reader io.Reader, sourceFormat, targetFormat string, ratio int, opts Options) (io.ReadSeeker, error) {
+	return DefaultRegistry.Convert(ctx, reader, sourceFormat, targetFormat, ratio, opts)
+}
 
-	buf := new(bytes.Buffer)
+// Decode reads the source image with the codec of the default registry.
+func Decode(ctx context.Context, reader io.Reader, sourceFormat string) (*Source, error) {
+	return DefaultRegistry.Decode(ctx, reader, sourceFormat)
+}
 
-	switch targetFormat {
-	case FormatPNG:
-		var enc png.Encoder
-		enc.CompressionLevel = png.CompressionLevel(ratio)
-		err := enc.Encode(buf, imageData)
-		if err != nil {
-			return nil, fmt.Errorf("can't convert image to %s format: %w", FormatJPG, err)
-		}
-	case FormatJPEG, FormatJPG:
-		err := jpeg.Encode(buf, imageData, &jpeg.Options{
-			Quality: ratio,
-		})
-		if err != nil {
-			return nil, fmt.Errorf("can't convert image to %s format: %w", FormatJPG, err)
-		}
-	default:
-		return nil, fmt.Errorf("unsupported format: %s", targetFormat)
-	}
+// Encode encodes the decoded image with the codec of the default registry.
+func Encode(ctx context.Context, src *Source, targetFormat string, ratio int, opts Options) (io.ReadSeeker, error) {
+	return DefaultRegistry.Encode(ctx, src, targetFormat, ratio, opts)
+}
 
-	return bytes.NewReader(buf.Bytes()), nil
+// EncodeTo encodes the decoded image to w with the codec of the default registry.
+func EncodeTo(ctx context.Context, w io.Writer, src *Source, targetFormat string, ratio int, opts Options) error {
+	return DefaultRegistry.EncodeTo(ctx, w, src, targetFormat, ratio, opts)
 }
@@ -0,0 +1,397 @@
+package converter
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestImage(t *testing.T) *bytes.Buffer {
+	img := image.NewNRGBA(image.Rect(0, 0, 30, 20))
+	for x := 0; x < 30; x++ {
+		for y := 0; y < 20; y++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x * 8), G: uint8(y * 12), B: uint8(x * y), A: 0xff})
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	err := png.Encode(buf, img)
+	require.NoError(t, err)
+
+	return buf
+}
+
+func TestConvert(t *testing.T) {
+	testTable := []struct {
+		name            string
+		targetFormat    string
+		ratio           int
+		expectedFormat  string
+		isErrorExpected bool
+	}{
+		{name: "JPEG", targetFormat: FormatJPEG, ratio: 90, expectedFormat: "jpeg"},
+		{name: "JPG", targetFormat: FormatJPG, ratio: 10, expectedFormat: "jpeg"},
+		{name: "PNG", targetFormat: FormatPNG, ratio: 5, expectedFormat: "png"},
+		{name: "GIF", targetFormat: FormatGIF, ratio: 50, expectedFormat: "gif"},
+		{name: "BMP", targetFormat: FormatBMP, ratio: 50, expectedFormat: "bmp"},
+		{name: "TIFF", targetFormat: FormatTIFF, ratio: 90, expectedFormat: "tiff"},
+		{name: "TIF", targetFormat: FormatTIF, ratio: 10, expectedFormat: "tiff"},
+		{name: "Unsupported format", targetFormat: "svg", ratio: 50, isErrorExpected: true},
+		{name: "Decode-only format", targetFormat: FormatWebP, ratio: 50, isErrorExpected: true},
+		{name: "Ratio out of range", targetFormat: FormatJPEG, ratio: 100, isErrorExpected: true},
+	}
+
+	for _, tc := range testTable {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := Convert(context.Background(), newTestImage(t), FormatPNG, tc.targetFormat, tc.ratio, Options{})
+			if tc.isErrorExpected {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			img, format, err := image.Decode(result)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedFormat, format)
+			assert.Equal(t, image.Rect(0, 0, 30, 20), img.Bounds())
+		})
+	}
+}
+
+// testWebP is the lossless 3x2 WebP image with red, green and blue pixels in the first row
+// and black, white and gray pixels in the second one.
+var testWebP = []byte{0x52, 0x49, 0x46, 0x46, 0x84, 0x0, 0x0, 0x0, 0x57, 0x45, 0x42, 0x50, 0x56, 0x50, 0x38, 0x4c,
+	0x77, 0x0, 0x0, 0x0, 0x2f, 0x2, 0x40, 0x0, 0x0, 0x10, 0x40, 0x24, 0x1, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0,
+	0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x6, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0,
+	0x0, 0x6, 0x0, 0x0, 0x10, 0x40, 0x24, 0x1, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0,
+	0x0, 0x0, 0x6, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x16, 0x40, 0x24,
+	0x1, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x6, 0x0, 0x0, 0x0, 0x0, 0x0,
+	0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0xee, 0x7f, 0xd8, 0x30, 0xfe, 0xa, 0x0}
+
+func TestConvert_WebPSource(t *testing.T) {
+	result, err := Convert(context.Background(), bytes.NewReader(testWebP), FormatWebP, FormatPNG, 50, Options{})
+	require.NoError(t, err)
+
+	img, format, err := image.Decode(result)
+	require.NoError(t, err)
+	assert.Equal(t, "png", format)
+	assert.Equal(t, image.Rect(0, 0, 3, 2), img.Bounds())
+
+	expected := [][]color.NRGBA{
+		{{R: 0xff, A: 0xff}, {G: 0xff, A: 0xff}, {B: 0xff, A: 0xff}},
+		{{A: 0xff}, {R: 0xff, G: 0xff, B: 0xff, A: 0xff}, {R: 0x80, G: 0x80, B: 0x80, A: 0xff}},
+	}
+	for y, row := range expected {
+		for x, c := range row {
+			assert.Equal(t, c, color.NRGBAModel.Convert(img.At(x, y)))
+		}
+	}
+}
+
+func TestConvert_Transform(t *testing.T) {
+	testTable := []struct {
+		name            string
+		opts            Options
+		expectedBounds  image.Rectangle
+		isErrorExpected bool
+	}{
+		{name: "Width only", opts: Options{Width: 15}, expectedBounds: image.Rect(0, 0, 15, 10)},
+		{name: "Height only", opts: Options{Height: 40}, expectedBounds: image.Rect(0, 0, 60, 40)},
+		{name: "Contain", opts: Options{Width: 10, Height: 10, Fit: FitContain}, expectedBounds: image.Rect(0, 0, 10, 6)},
+		{name: "Cover", opts: Options{Width: 10, Height: 10, Fit: FitCover}, expectedBounds: image.Rect(0, 0, 10, 10)},
+		{name: "Fill", opts: Options{Width: 7, Height: 9, Fit: FitFill}, expectedBounds: image.Rect(0, 0, 7, 9)},
+		{name: "Crop", opts: Options{Crop: &Crop{X: 5, Y: 5, Width: 10, Height: 4}}, expectedBounds: image.Rect(0, 0, 10, 4)},
+		{name: "Rotation", opts: Options{Rotation: 90}, expectedBounds: image.Rect(0, 0, 20, 30)},
+		{name: "Flip", opts: Options{Flip: FlipVertical}, expectedBounds: image.Rect(0, 0, 30, 20)},
+		{
+			name:           "Crop, rotate and resize",
+			opts:           Options{Crop: &Crop{Width: 20, Height: 10}, Rotation: 270, Width: 5},
+			expectedBounds: image.Rect(0, 0, 5, 10),
+		},
+		{name: "Crop out of bounds", opts: Options{Crop: &Crop{X: 25, Width: 10, Height: 4}}, isErrorExpected: true},
+		{name: "Invalid rotation", opts: Options{Rotation: 45}, isErrorExpected: true},
+		{name: "Invalid fit", opts: Options{Width: 5, Height: 5, Fit: "stretch"}, isErrorExpected: true},
+		{name: "Too large", opts: Options{Height: 10000}, isErrorExpected: true},
+	}
+
+	for _, tc := range testTable {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := Convert(context.Background(), newTestImage(t), FormatPNG, FormatPNG, 50, tc.opts)
+			if tc.isErrorExpected {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			img, _, err := image.Decode(result)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedBounds, img.Bounds())
+		})
+	}
+}
+
+func TestTransform_CoverExtremeAspectRatio(t *testing.T) {
+	src, err := png.Decode(newTestImage(t))
+	require.NoError(t, err)
+
+	testTable := []struct {
+		name   string
+		width  int
+		height int
+	}{
+		{name: "Narrow box", width: 1, height: 10000},
+		{name: "Wide box", width: 10000, height: 1},
+	}
+
+	for _, tc := range testTable {
+		t.Run(tc.name, func(t *testing.T) {
+			img, err := Transform(src, Options{Width: tc.width, Height: tc.height, Fit: FitCover})
+			require.NoError(t, err)
+			assert.Equal(t, image.Rect(0, 0, tc.width, tc.height), img.Bounds())
+
+			// The source part is at least 1px, so the image is filled with the opaque source pixels.
+			_, _, _, a := img.At(tc.width/2, tc.height/2).RGBA()
+			assert.Equal(t, uint32(0xffff), a)
+		})
+	}
+}
+
+func TestTransform_RotateAndFlip(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	red, blue := color.NRGBA{R: 0xff, A: 0xff}, color.NRGBA{B: 0xff, A: 0xff}
+	img.Set(0, 0, red)
+	img.Set(1, 0, blue)
+
+	rotated, err := Transform(img, Options{Rotation: 90})
+	require.NoError(t, err)
+	assert.Equal(t, red, rotated.At(0, 0))
+	assert.Equal(t, blue, rotated.At(0, 1))
+
+	flipped, err := Transform(img, Options{Flip: FlipHorizontal})
+	require.NoError(t, err)
+	assert.Equal(t, blue, flipped.At(0, 0))
+	assert.Equal(t, red, flipped.At(1, 0))
+}
+
+// newTestEXIF builds a little-endian EXIF payload with the orientation tag and a GPS IFD.
+func newTestEXIF(orientation uint16) []byte {
+	buf := make([]byte, 56)
+	copy(buf, "II*\x00")
+	binary.LittleEndian.PutUint32(buf[4:], 8)
+
+	// IFD0: orientation and GPS IFD pointer.
+	binary.LittleEndian.PutUint16(buf[8:], 2)
+	binary.LittleEndian.PutUint16(buf[10:], tagOrientation)
+	binary.LittleEndian.PutUint16(buf[12:], 3)
+	binary.LittleEndian.PutUint32(buf[14:], 1)
+	binary.LittleEndian.PutUint16(buf[18:], orientation)
+	binary.LittleEndian.PutUint16(buf[22:], tagGPSInfo)
+	binary.LittleEndian.PutUint16(buf[24:], 4)
+	binary.LittleEndian.PutUint32(buf[26:], 1)
+	binary.LittleEndian.PutUint32(buf[30:], 38)
+
+	// GPS IFD: latitude reference.
+	binary.LittleEndian.PutUint16(buf[38:], 1)
+	binary.LittleEndian.PutUint16(buf[40:], 1)
+	binary.LittleEndian.PutUint16(buf[42:], 2)
+	binary.LittleEndian.PutUint32(buf[44:], 2)
+	copy(buf[48:], "N\x00")
+
+	return buf
+}
+
+func newTestJPEGWithMetadata(t *testing.T, md metadata) *bytes.Buffer {
+	img, err := png.Decode(newTestImage(t))
+	require.NoError(t, err)
+
+	buf := new(bytes.Buffer)
+	err = jpeg.Encode(buf, img, nil)
+	require.NoError(t, err)
+
+	return bytes.NewBuffer(embedJPEGMetadata(buf.Bytes(), md))
+}
+
+func TestConvert_Metadata(t *testing.T) {
+	icc := []byte("test icc profile")
+
+	testTable := []struct {
+		name         string
+		targetFormat string
+		mode         string
+		expectEXIF   bool
+		expectGPS    bool
+	}{
+		{name: "Strip by default", targetFormat: FormatPNG},
+		{name: "Strip", targetFormat: FormatJPEG, mode: MetadataStrip},
+		{name: "Keep", targetFormat: FormatPNG, mode: MetadataKeep, expectEXIF: true, expectGPS: true},
+		{name: "Safe", targetFormat: FormatJPEG, mode: MetadataSafe, expectEXIF: true},
+	}
+
+	for _, tc := range testTable {
+		t.Run(tc.name, func(t *testing.T) {
+			source := newTestJPEGWithMetadata(t, metadata{exif: newTestEXIF(6), icc: icc})
+
+			result, err := Convert(context.Background(), source, FormatJPEG, tc.targetFormat, 90, Options{Metadata: tc.mode})
+			require.NoError(t, err)
+
+			data, err := ioutil.ReadAll(result)
+			require.NoError(t, err)
+
+			img, _, err := image.Decode(bytes.NewReader(data))
+			require.NoError(t, err)
+			assert.Equal(t, image.Rect(0, 0, 20, 30), img.Bounds())
+
+			md := readMetadata(data)
+			assert.Equal(t, icc, md.icc)
+			assert.Equal(t, 1, md.orientation)
+			if !tc.expectEXIF {
+				assert.Nil(t, md.exif)
+				return
+			}
+
+			e, ok := parseEXIF(md.exif)
+			require.True(t, ok)
+			_, hasGPS := e.findEntry(tagGPSInfo)
+			assert.Equal(t, tc.expectGPS, hasGPS)
+		})
+	}
+}
+
+func TestAutoOrient(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	red, blue := color.NRGBA{R: 0xff, A: 0xff}, color.NRGBA{B: 0xff, A: 0xff}
+	img.Set(0, 0, red)
+	img.Set(1, 0, blue)
+
+	testTable := []struct {
+		orientation int
+		bounds      image.Rectangle
+		redAt       image.Point
+	}{
+		{orientation: 1, bounds: image.Rect(0, 0, 2, 1), redAt: image.Pt(0, 0)},
+		{orientation: 2, bounds: image.Rect(0, 0, 2, 1), redAt: image.Pt(1, 0)},
+		{orientation: 3, bounds: image.Rect(0, 0, 2, 1), redAt: image.Pt(1, 0)},
+		{orientation: 4, bounds: image.Rect(0, 0, 2, 1), redAt: image.Pt(0, 0)},
+		{orientation: 5, bounds: image.Rect(0, 0, 1, 2), redAt: image.Pt(0, 0)},
+		{orientation: 6, bounds: image.Rect(0, 0, 1, 2), redAt: image.Pt(0, 0)},
+		{orientation: 7, bounds: image.Rect(0, 0, 1, 2), redAt: image.Pt(0, 1)},
+		{orientation: 8, bounds: image.Rect(0, 0, 1, 2), redAt: image.Pt(0, 1)},
+	}
+
+	for _, tc := range testTable {
+		t.Run(fmt.Sprintf("Orientation %d", tc.orientation), func(t *testing.T) {
+			oriented := autoOrient(img, tc.orientation)
+			assert.Equal(t, tc.bounds, oriented.Bounds())
+			assert.Equal(t, red, oriented.At(tc.redAt.X, tc.redAt.Y))
+		})
+	}
+}
+
+func TestEncode_Renditions(t *testing.T) {
+	src, err := Decode(context.Background(), newTestImage(t), FormatPNG)
+	require.NoError(t, err)
+
+	base := Options{Rotation: 90, Width: 5}
+	testTable := []struct {
+		name           string
+		rendition      Rendition
+		expectedFormat string
+		expectedBounds image.Rectangle
+	}{
+		{
+			name:           "Small",
+			rendition:      Rendition{Name: "small", Width: 10, Height: 10, Format: FormatTIFF, Ratio: 80},
+			expectedFormat: "tiff",
+			expectedBounds: image.Rect(0, 0, 6, 10),
+		},
+		{
+			name:           "Large",
+			rendition:      Rendition{Name: "large", Width: 40, Format: FormatJPEG, Ratio: 90},
+			expectedFormat: "jpeg",
+			expectedBounds: image.Rect(0, 0, 40, 60),
+		},
+	}
+
+	for _, tc := range testTable {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := Encode(context.Background(), src, tc.rendition.Format, tc.rendition.Ratio, tc.rendition.Options(base))
+			require.NoError(t, err)
+
+			img, format, err := image.Decode(result)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedFormat, format)
+			assert.Equal(t, tc.expectedBounds, img.Bounds())
+		})
+	}
+}
+
+func TestDecode_Limits(t *testing.T) {
+	// The IHDR chunk of the test image declares 10000x10000 pixels, only the header is read.
+	huge := newTestImage(t).Bytes()
+	binary.BigEndian.PutUint32(huge[16:20], 10000)
+	binary.BigEndian.PutUint32(huge[20:24], 10000)
+	binary.BigEndian.PutUint32(huge[29:33], crc32.ChecksumIEEE(huge[12:29]))
+
+	testTable := []struct {
+		name          string
+		data          []byte
+		expectedError error
+	}{
+		{name: "Ok", data: newTestImage(t).Bytes()},
+		{name: "Too many pixels", data: huge, expectedError: ErrSourceTooLarge},
+		{name: "Too large file", data: make([]byte, MaxSourceSize+1), expectedError: ErrSourceTooLarge},
+	}
+
+	for _, tc := range testTable {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Decode(context.Background(), bytes.NewReader(tc.data), FormatPNG)
+			if tc.expectedError != nil {
+				assert.True(t, errors.Is(err, tc.expectedError), err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestEncodeTo(t *testing.T) {
+	src, err := Decode(context.Background(), newTestImage(t), FormatPNG)
+	require.NoError(t, err)
+
+	buffered, err := Encode(context.Background(), src, FormatJPG, 80, Options{})
+	require.NoError(t, err)
+	expected, err := ioutil.ReadAll(buffered)
+	require.NoError(t, err)
+
+	streamed := new(bytes.Buffer)
+	require.NoError(t, EncodeTo(context.Background(), streamed, src, FormatJPG, 80, Options{}))
+	assert.Equal(t, expected, streamed.Bytes())
+}
+
+func TestConvert_Canceled(t *testing.T) {
+	src, err := Decode(context.Background(), newTestImage(t), FormatPNG)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = Decode(ctx, newTestImage(t), FormatPNG)
+	assert.True(t, errors.Is(err, context.Canceled), err)
+
+	buf := new(bytes.Buffer)
+	err = EncodeTo(ctx, buf, src, FormatJPG, 80, Options{})
+	assert.True(t, errors.Is(err, context.Canceled), err)
+	assert.Zero(t, buf.Len())
+}
@@ -0,0 +1,152 @@
+package converter
+
+import (
+	"encoding/binary"
+)
+
+const (
+	// tagOrientation is the EXIF tag holding the image orientation.
+	tagOrientation = 0x0112
+	// tagGPSInfo is the EXIF tag pointing to the GPS IFD.
+	tagGPSInfo = 0x8825
+	// ifdEntrySize is the size of a single IFD entry in bytes.
+	ifdEntrySize = 12
+)
+
+// exifTypeSizes maps the TIFF field types to the size of a single value in bytes.
+var exifTypeSizes = map[uint16]uint32{
+	1:  1, // BYTE
+	2:  1, // ASCII
+	3:  2, // SHORT
+	4:  4, // LONG
+	5:  8, // RATIONAL
+	6:  1, // SBYTE
+	7:  1, // UNDEFINED
+	8:  2, // SSHORT
+	9:  4, // SLONG
+	10: 8, // SRATIONAL
+	11: 4, // FLOAT
+	12: 8, // DOUBLE
+}
+
+// exifData provides access to the TIFF structure of an EXIF payload.
+type exifData struct {
+	buf   []byte
+	order binary.ByteOrder
+	ifd0  uint32
+}
+
+// parseEXIF parses the TIFF header of the EXIF payload.
+func parseEXIF(buf []byte) (*exifData, bool) {
+	if len(buf) < 8 {
+		return nil, false
+	}
+
+	var order binary.ByteOrder
+	switch string(buf[:4]) {
+	case "II*\x00":
+		order = binary.LittleEndian
+	case "MM\x00*":
+		order = binary.BigEndian
+	default:
+		return nil, false
+	}
+
+	e := &exifData{buf: buf, order: order, ifd0: order.Uint32(buf[4:8])}
+	if _, ok := e.entryCount(e.ifd0); !ok {
+		return nil, false
+	}
+	return e, true
+}
+
+// entryCount returns the number of entries of the IFD at the given offset.
+func (e *exifData) entryCount(offset uint32) (uint32, bool) {
+	if uint64(offset)+2 > uint64(len(e.buf)) {
+		return 0, false
+	}
+	n := uint32(e.order.Uint16(e.buf[offset:]))
+	if uint64(offset)+2+uint64(n)*ifdEntrySize+4 > uint64(len(e.buf)) {
+		return 0, false
+	}
+	return n, true
+}
+
+// findEntry returns the offset of the IFD0 entry with the given tag.
+func (e *exifData) findEntry(tag uint16) (uint32, bool) {
+	n, _ := e.entryCount(e.ifd0)
+	for i := uint32(0); i < n; i++ {
+		entry := e.ifd0 + 2 + i*ifdEntrySize
+		if e.order.Uint16(e.buf[entry:]) == tag {
+			return entry, true
+		}
+	}
+	return 0, false
+}
+
+// orientation returns the value of the orientation tag, 1 if it is missing or invalid.
+func (e *exifData) orientation() int {
+	entry, ok := e.findEntry(tagOrientation)
+	if !ok {
+		return 1
+	}
+	v := int(e.order.Uint16(e.buf[entry+8:]))
+	if v < 1 || v > 8 {
+		return 1
+	}
+	return v
+}
+
+// resetOrientation marks the pixels as already oriented.
+func (e *exifData) resetOrientation() {
+	if entry, ok := e.findEntry(tagOrientation); ok {
+		e.order.PutUint16(e.buf[entry+8:], 1)
+	}
+}
+
+// removeGPS drops the GPS IFD pointer from IFD0 and wipes the GPS data itself.
+func (e *exifData) removeGPS() {
+	entry, ok := e.findEntry(tagGPSInfo)
+	if !ok {
+		return
+	}
+	gps := e.order.Uint32(e.buf[entry+8:])
+
+	// Shift the following entries and the next IFD offset over the removed entry.
+	n, _ := e.entryCount(e.ifd0)
+	end := e.ifd0 + 2 + n*ifdEntrySize + 4
+	copy(e.buf[entry:end], e.buf[entry+ifdEntrySize:end])
+	for i := end - ifdEntrySize; i < end; i++ {
+		e.buf[i] = 0
+	}
+	e.order.PutUint16(e.buf[e.ifd0:], uint16(n-1))
+
+	if gps != e.ifd0 {
+		e.wipeIFD(gps)
+	}
+}
+
+// wipeIFD zeroes the IFD at the given offset together with the values it points to.
+func (e *exifData) wipeIFD(offset uint32) {
+	n, ok := e.entryCount(offset)
+	if !ok {
+		return
+	}
+
+	for i := uint32(0); i < n; i++ {
+		entry := offset + 2 + i*ifdEntrySize
+		size := exifTypeSizes[e.order.Uint16(e.buf[entry+2:])] * e.order.Uint32(e.buf[entry+4:])
+		if size <= 4 {
+			continue
+		}
+		valueOffset := e.order.Uint32(e.buf[entry+8:])
+		if uint64(valueOffset)+uint64(size) <= uint64(len(e.buf)) {
+			for j := valueOffset; j < valueOffset+size; j++ {
+				e.buf[j] = 0
+			}
+		}
+	}
+
+	for j := offset; j < offset+2+n*ifdEntrySize+4; j++ {
+		e.buf[j] = 0
+	}
+}
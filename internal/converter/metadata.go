@@ -0,0 +1,340 @@
+package converter
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"io"
+	"io/ioutil"
+)
+
+const (
+	// MetadataStrip drops the EXIF metadata from the converted image.
+	MetadataStrip = "strip"
+	// MetadataKeep copies the EXIF metadata to the converted image.
+	MetadataKeep = "keep"
+	// MetadataSafe copies the EXIF metadata without the GPS location.
+	MetadataSafe = "safe"
+)
+
+const (
+	jpegMarkerSOI  = 0xd8
+	jpegMarkerSOS  = 0xda
+	jpegMarkerEOI  = 0xd9
+	jpegMarkerAPP1 = 0xe1
+	jpegMarkerAPP2 = 0xe2
+	// jpegMaxSegmentLength is the largest payload of a JPEG segment (length field included).
+	jpegMaxSegmentLength = 0xffff
+	// pngSignatureLength is the size of the PNG file signature.
+	pngSignatureLength = 8
+	// pngIHDREnd is the offset right after the IHDR chunk, which is always first.
+	pngIHDREnd = pngSignatureLength + 8 + 13 + 4
+)
+
+var (
+	jpegEXIFHeader = []byte("Exif\x00\x00")
+	jpegICCHeader  = []byte("ICC_PROFILE\x00")
+)
+
+// metadata represents the metadata of the source image that survives the conversion.
+type metadata struct {
+	exif        []byte
+	icc         []byte
+	orientation int
+}
+
+// readMetadata extracts EXIF, ICC profile and orientation from the encoded image.
+func readMetadata(data []byte) metadata {
+	var md metadata
+
+	switch {
+	case len(data) > 2 && data[0] == 0xff && data[1] == jpegMarkerSOI:
+		md = readJPEGMetadata(data)
+	case len(data) > pngSignatureLength && string(data[:pngSignatureLength]) == "\x89PNG\r\n\x1a\n":
+		md = readPNGMetadata(data)
+	case len(data) > 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		md = readWebPMetadata(data)
+	case len(data) > 4 && (string(data[:4]) == "II*\x00" || string(data[:4]) == "MM\x00*"):
+		// The TIFF file itself is the EXIF structure, only the orientation is taken from it.
+		if e, ok := parseEXIF(data); ok {
+			md.orientation = e.orientation()
+		}
+		return md
+	}
+
+	md.orientation = 1
+	if e, ok := parseEXIF(md.exif); ok {
+		md.orientation = e.orientation()
+	} else {
+		md.exif = nil
+	}
+
+	return md
+}
+
+// readJPEGMetadata reads the APP1 (EXIF) and APP2 (ICC profile) segments.
+func readJPEGMetadata(data []byte) metadata {
+	var md metadata
+	iccChunks := map[byte][]byte{}
+	var iccCount byte
+
+	for pos := 2; pos+4 <= len(data); {
+		if data[pos] != 0xff {
+			break
+		}
+		marker := data[pos+1]
+		if marker == jpegMarkerSOS || marker == jpegMarkerEOI {
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 2 || pos+2+length > len(data) {
+			break
+		}
+		payload := data[pos+4 : pos+2+length]
+
+		switch {
+		case marker == jpegMarkerAPP1 && bytes.HasPrefix(payload, jpegEXIFHeader):
+			md.exif = append([]byte(nil), payload[len(jpegEXIFHeader):]...)
+		case marker == jpegMarkerAPP2 && bytes.HasPrefix(payload, jpegICCHeader) && len(payload) > len(jpegICCHeader)+2:
+			seq := payload[len(jpegICCHeader)]
+			iccCount = payload[len(jpegICCHeader)+1]
+			iccChunks[seq] = payload[len(jpegICCHeader)+2:]
+		}
+
+		pos += 2 + length
+	}
+
+	// ICC profile chunks are numbered from 1.
+	for seq := byte(1); seq <= iccCount; seq++ {
+		chunk, ok := iccChunks[seq]
+		if !ok {
+			md.icc = nil
+			break
+		}
+		md.icc = append(md.icc, chunk...)
+	}
+
+	return md
+}
+
+// readPNGMetadata reads the eXIf and iCCP chunks.
+func readPNGMetadata(data []byte) metadata {
+	var md metadata
+
+	for pos := pngSignatureLength; pos+8 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		chunkType := string(data[pos+4 : pos+8])
+		if length < 0 || pos+12+length > len(data) || chunkType == "IDAT" {
+			break
+		}
+		payload := data[pos+8 : pos+8+length]
+
+		switch chunkType {
+		case "eXIf":
+			md.exif = append([]byte(nil), payload...)
+		case "iCCP":
+			// Profile name, null separator, compression method and zlib stream.
+			if i := bytes.IndexByte(payload, 0); i > 0 && i+2 <= len(payload) {
+				if r, err := zlib.NewReader(bytes.NewReader(payload[i+2:])); err == nil {
+					md.icc, _ = ioutil.ReadAll(r)
+				}
+			}
+		}
+
+		pos += 12 + length
+	}
+
+	return md
+}
+
+// readWebPMetadata reads the EXIF and ICCP chunks of an extended WebP file.
+func readWebPMetadata(data []byte) metadata {
+	var md metadata
+
+	for pos := 12; pos+8 <= len(data); {
+		length := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		if length < 0 || pos+8+length > len(data) {
+			break
+		}
+		payload := data[pos+8 : pos+8+length]
+
+		switch string(data[pos : pos+4]) {
+		case "EXIF":
+			md.exif = append([]byte(nil), bytes.TrimPrefix(payload, jpegEXIFHeader)...)
+		case "ICCP":
+			md.icc = append([]byte(nil), payload...)
+		}
+
+		pos += 8 + length + length&1
+	}
+
+	return md
+}
+
+// forMode returns the metadata to be written according to the metadata mode.
+// The orientation is always reset because the pixels are rotated during the conversion.
+func (md metadata) forMode(mode string) metadata {
+	out := metadata{icc: md.icc, orientation: 1}
+	if mode != MetadataKeep && mode != MetadataSafe {
+		return out
+	}
+
+	e, ok := parseEXIF(append([]byte(nil), md.exif...))
+	if !ok {
+		return out
+	}
+	e.resetOrientation()
+	if mode == MetadataSafe {
+		e.removeGPS()
+	}
+	out.exif = e.buf
+
+	return out
+}
+
+// autoOrient rotates and flips the image according to the EXIF orientation.
+func autoOrient(img image.Image, orientation int) image.Image {
+	switch orientation {
+	case 2:
+		return flip(img, FlipHorizontal)
+	case 3:
+		return rotate(img, 180)
+	case 4:
+		return flip(img, FlipVertical)
+	case 5:
+		return flip(rotate(img, 90), FlipHorizontal)
+	case 6:
+		return rotate(img, 90)
+	case 7:
+		return flip(rotate(img, 270), FlipHorizontal)
+	case 8:
+		return rotate(img, 270)
+	default:
+		return img
+	}
+}
+
+// embedJPEGMetadata inserts the APP1 and APP2 segments right after the SOI marker.
+func embedJPEGMetadata(data []byte, md metadata) []byte {
+	if len(data) < 2 || md.exif == nil && md.icc == nil {
+		return data
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)+len(md.exif)+len(md.icc)+64))
+	out.Write(data[:2])
+
+	if md.exif != nil && 2+len(jpegEXIFHeader)+len(md.exif) <= jpegMaxSegmentLength {
+		writeJPEGSegment(out, jpegMarkerAPP1, jpegEXIFHeader, md.exif)
+	}
+
+	const iccChunkSize = jpegMaxSegmentLength - 2 - 14
+	count := (len(md.icc) + iccChunkSize - 1) / iccChunkSize
+	if count <= 0xff {
+		for i := 0; i < count; i++ {
+			end := (i + 1) * iccChunkSize
+			if end > len(md.icc) {
+				end = len(md.icc)
+			}
+			header := append(append([]byte(nil), jpegICCHeader...), byte(i+1), byte(count))
+			writeJPEGSegment(out, jpegMarkerAPP2, header, md.icc[i*iccChunkSize:end])
+		}
+	}
+
+	out.Write(data[2:])
+	return out.Bytes()
+}
+
+func writeJPEGSegment(out *bytes.Buffer, marker byte, header, payload []byte) {
+	var length [2]byte
+	binary.BigEndian.PutUint16(length[:], uint16(2+len(header)+len(payload)))
+	out.Write([]byte{0xff, marker})
+	out.Write(length[:])
+	out.Write(header)
+	out.Write(payload)
+}
+
+// embedPNGMetadata inserts the iCCP and eXIf chunks right after the IHDR chunk.
+func embedPNGMetadata(data []byte, md metadata) []byte {
+	if len(data) < pngIHDREnd || md.exif == nil && md.icc == nil {
+		return data
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)+len(md.exif)+len(md.icc)+64))
+	out.Write(data[:pngIHDREnd])
+
+	if md.icc != nil {
+		var compressed bytes.Buffer
+		zw := zlib.NewWriter(&compressed)
+		_, _ = zw.Write(md.icc)
+		_ = zw.Close()
+		writePNGChunk(out, "iCCP", append([]byte("ICC profile\x00\x00"), compressed.Bytes()...))
+	}
+	if md.exif != nil {
+		writePNGChunk(out, "eXIf", md.exif)
+	}
+
+	out.Write(data[pngIHDREnd:])
+	return out.Bytes()
+}
+
+func writePNGChunk(out *bytes.Buffer, chunkType string, payload []byte) {
+	var header [8]byte
+	binary.BigEndian.PutUint32(header[:4], uint32(len(payload)))
+	copy(header[4:], chunkType)
+
+	crc := crc32.NewIEEE()
+	_, _ = crc.Write(header[4:])
+	_, _ = crc.Write(payload)
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc.Sum32())
+
+	out.Write(header[:])
+	out.Write(payload)
+	out.Write(sum[:])
+}
+
+// metadataWriter passes the encoded image through to the underlying writer,
+// the first n bytes are held back until embed inserts the metadata into them.
+type metadataWriter struct {
+	w     io.Writer
+	n     int
+	head  []byte
+	embed func(head []byte) []byte
+	done  bool
+}
+
+func newMetadataWriter(w io.Writer, n int, embed func(head []byte) []byte) *metadataWriter {
+	return &metadataWriter{w: w, n: n, head: make([]byte, 0, n), embed: embed}
+}
+
+func (mw *metadataWriter) Write(p []byte) (int, error) {
+	if mw.done {
+		return mw.w.Write(p)
+	}
+
+	need := mw.n - len(mw.head)
+	if len(p) < need {
+		mw.head = append(mw.head, p...)
+		return len(p), nil
+	}
+
+	mw.head = append(mw.head, p[:need]...)
+	mw.done = true
+	if _, err := mw.w.Write(mw.embed(mw.head)); err != nil {
+		return 0, err
+	}
+	n, err := mw.w.Write(p[need:])
+	return need + n, err
+}
+
+// Close writes the image shorter than n bytes as is.
+func (mw *metadataWriter) Close() error {
+	if mw.done {
+		return nil
+	}
+	mw.done = true
+	_, err := mw.w.Write(mw.head)
+	return err
+}
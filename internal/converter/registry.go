@@ -0,0 +1,315 @@
+package converter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"io/ioutil"
+	"sort"
+	"sync"
+)
+
+const (
+	// MaxSourceSize is the largest size of the source file accepted by the decoder.
+	MaxSourceSize = 64 << 20
+	// MaxPixels is the largest number of pixels of the source image, it bounds the memory of the decoded image.
+	MaxPixels = 40000000
+)
+
+var (
+	// ErrSourceTooLarge notifies that the source file or the source image dimensions exceed the limits.
+	ErrSourceTooLarge = errors.New("source image is too large")
+
+	// ErrTargetTooLarge notifies that the size of the transformed image exceeds MaxPixels.
+	ErrTargetTooLarge = errors.New("target image is too large")
+
+	// ErrDecodeOnly notifies that the images of the format can be decoded but not encoded.
+	ErrDecodeOnly = errors.New("format can only be decoded")
+)
+
+// DefaultRegistry is the registry with the built-in codecs used by the package level functions.
+var DefaultRegistry = newDefaultRegistry()
+
+// Registry holds the codecs of the supported formats.
+type Registry struct {
+	mu      sync.RWMutex
+	codecs  map[string]Codec
+	aliases map[string]string
+}
+
+// NewRegistry creates new empty codec registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		codecs:  make(map[string]Codec),
+		aliases: make(map[string]string),
+	}
+}
+
+func newDefaultRegistry() *Registry {
+	r := NewRegistry()
+	for _, c := range []Codec{jpegCodec{}, pngCodec{}, webpCodec{}, gifCodec{}, bmpCodec{}, tiffCodec{}} {
+		if err := r.Register(c); err != nil {
+			panic(err)
+		}
+	}
+	return r
+}
+
+// Register adds the codec to the registry. The format and its aliases must not be taken by another codec.
+func (r *Registry) Register(c Codec) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := append([]string{c.Format()}, c.Aliases()...)
+	for _, name := range names {
+		if _, ok := r.aliases[name]; ok {
+			return fmt.Errorf("format %s is already registered", name)
+		}
+	}
+
+	r.codecs[c.Format()] = c
+	for _, name := range names {
+		r.aliases[name] = c.Format()
+	}
+
+	return nil
+}
+
+// Lookup returns the codec registered for the given format name or alias.
+func (r *Registry) Lookup(format string) (Codec, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	name, ok := r.aliases[format]
+	if !ok {
+		return nil, false
+	}
+	return r.codecs[name], true
+}
+
+// Formats returns the sorted canonical names of the registered formats.
+func (r *Registry) Formats() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	formats := make([]string, 0, len(r.codecs))
+	for name := range r.codecs {
+		formats = append(formats, name)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// TargetFormats returns the sorted canonical names of the registered formats that can be encoded.
+func (r *Registry) TargetFormats() []string {
+	var formats []string
+	for _, format := range r.Formats() {
+		if r.CanEncode(format) {
+			formats = append(formats, format)
+		}
+	}
+	return formats
+}
+
+// CanEncode checks if the format is registered and its codec is able to encode the images.
+func (r *Registry) CanEncode(format string) bool {
+	codec, ok := r.Lookup(format)
+	if !ok {
+		return false
+	}
+	do, ok := codec.(DecodeOnlyCodec)
+	return !ok || !do.DecodeOnly()
+}
+
+// CanConvert checks if both formats are registered, differ from each other and the target format can be encoded.
+func (r *Registry) CanConvert(sourceFormat, targetFormat string) bool {
+	source, ok := r.Lookup(sourceFormat)
+	if !ok {
+		return false
+	}
+	target, ok := r.Lookup(targetFormat)
+	if !ok {
+		return false
+	}
+	return source.Format() != target.Format() && r.CanEncode(targetFormat)
+}
+
+// Source represents the decoded source image, it can be encoded into several targets.
+type Source struct {
+	img image.Image
+	md  metadata
+}
+
+// Decode reads the source image of the given format and rotates it according to its EXIF orientation.
+// The source file larger than MaxSourceSize and the image with more than MaxPixels pixels are rejected
+// with ErrSourceTooLarge, the image dimensions are checked before decoding if the codec implements ConfigDecoder.
+// The canceled context stops reading the source file and is checked again before and after decoding.
+func (r *Registry) Decode(ctx context.Context, reader io.Reader, sourceFormat string) (*Source, error) {
+	source, ok := r.Lookup(sourceFormat)
+	if !ok {
+		return nil, fmt.Errorf("unsupported format: %s", sourceFormat)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(&contextReader{ctx: ctx, r: reader}, MaxSourceSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("can't read source file: %w", err)
+	}
+	if len(data) > MaxSourceSize {
+		return nil, fmt.Errorf("%w: the file is larger than %d bytes", ErrSourceTooLarge, MaxSourceSize)
+	}
+	md := readMetadata(data)
+
+	if cd, ok := source.(ConfigDecoder); ok {
+		conf, err := cd.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("can't decode source file: %w", err)
+		}
+		if int64(conf.Width)*int64(conf.Height) > MaxPixels {
+			return nil, fmt.Errorf("%w: %dx%d is more than %d pixels", ErrSourceTooLarge, conf.Width, conf.Height, MaxPixels)
+		}
+	}
+
+	if err = ctx.Err(); err != nil {
+		return nil, fmt.Errorf("conversion canceled: %w", err)
+	}
+
+	img, err := source.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("can't decode source file: %w", err)
+	}
+
+	if err = ctx.Err(); err != nil {
+		return nil, fmt.Errorf("conversion canceled: %w", err)
+	}
+
+	return &Source{img: autoOrient(img, md.orientation), md: md}, nil
+}
+
+// Encode converts the decoded image to the target format according to the compression ratio,
+// applying the given operations before encoding.
+// The ICC profile is preserved whenever the target format supports it.
+func (r *Registry) Encode(ctx context.Context, src *Source, targetFormat string, ratio int, opts Options) (io.ReadSeeker, error) {
+	buf := new(bytes.Buffer)
+	if err := r.EncodeTo(ctx, buf, src, targetFormat, ratio, opts); err != nil {
+		return nil, err
+	}
+
+	return bytes.NewReader(buf.Bytes()), nil
+}
+
+// EncodeTo is like Encode but streams the encoded image to w instead of keeping it in memory.
+// The canceled context is checked before and after the transformation and stops the encoder at its next write.
+func (r *Registry) EncodeTo(ctx context.Context, w io.Writer, src *Source, targetFormat string, ratio int, opts Options) error {
+	target, ok := r.Lookup(targetFormat)
+	if !ok {
+		return fmt.Errorf("unsupported format: %s", targetFormat)
+	}
+	if !r.CanEncode(targetFormat) {
+		return fmt.Errorf("unsupported target format %s: %w", targetFormat, ErrDecodeOnly)
+	}
+	if min, max := target.RatioRange(); ratio < min || ratio > max {
+		return fmt.Errorf("ratio %d is out of range from %d to %d for %s format", ratio, min, max, targetFormat)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("conversion canceled: %w", err)
+	}
+
+	img, err := Transform(src.img, opts)
+	if err != nil {
+		return fmt.Errorf("can't transform image: %w", err)
+	}
+
+	if err = ctx.Err(); err != nil {
+		return fmt.Errorf("conversion canceled: %w", err)
+	}
+
+	md := src.md.forMode(opts.Metadata)
+	err = target.Encode(&contextWriter{ctx: ctx, w: w}, img, EncodeOptions{
+		Ratio:      ratio,
+		ICCProfile: md.icc,
+		EXIF:       md.exif,
+	})
+	if err != nil {
+		return fmt.Errorf("can't convert image to %s format: %w", targetFormat, err)
+	}
+
+	return nil
+}
+
+// Convert converts and compresses the given image file from the source to the target format
+// according to the compression ratio, applying the given operations before encoding.
+func (r *Registry) Convert(ctx context.Context, reader io.Reader, sourceFormat, targetFormat string, ratio int, opts Options) (io.ReadSeeker, error) {
+	if _, ok := r.Lookup(targetFormat); !ok {
+		return nil, fmt.Errorf("unsupported format: %s", targetFormat)
+	}
+	if !r.CanEncode(targetFormat) {
+		return nil, fmt.Errorf("unsupported target format %s: %w", targetFormat, ErrDecodeOnly)
+	}
+
+	src, err := r.Decode(ctx, reader, sourceFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.Encode(ctx, src, targetFormat, ratio, opts)
+}
+
+// Register adds the codec to the default registry.
+func Register(c Codec) error {
+	return DefaultRegistry.Register(c)
+}
+
+// Lookup returns the codec registered in the default registry for the given format name or alias.
+func Lookup(format string) (Codec, bool) {
+	return DefaultRegistry.Lookup(format)
+}
+
+// Formats returns the sorted canonical names of the formats registered in the default registry.
+func Formats() []string {
+	return DefaultRegistry.Formats()
+}
+
+// TargetFormats returns the sorted canonical names of the formats the default registry can encode.
+func TargetFormats() []string {
+	return DefaultRegistry.TargetFormats()
+}
+
+// CanEncode checks if the default registry can encode images of the given format.
+func CanEncode(format string) bool {
+	return DefaultRegistry.CanEncode(format)
+}
+
+// CanConvert checks if the default registry can convert images between the given formats.
+func CanConvert(sourceFormat, targetFormat string) bool {
+	return DefaultRegistry.CanConvert(sourceFormat, targetFormat)
+}
+
+// contextReader fails the reads once the context is canceled.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr *contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, fmt.Errorf("conversion canceled: %w", err)
+	}
+	return cr.r.Read(p)
+}
+
+// contextWriter fails the writes once the context is canceled, so that the encoder stops early.
+type contextWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (cw *contextWriter) Write(p []byte) (int, error) {
+	if err := cw.ctx.Err(); err != nil {
+		return 0, fmt.Errorf("conversion canceled: %w", err)
+	}
+	return cw.w.Write(p)
+}
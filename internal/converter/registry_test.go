@@ -0,0 +1,97 @@
+package converter
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rawCodec stores the image size only, it is used to check custom codec registration.
+type rawCodec struct{}
+
+func (rawCodec) Format() string         { return "raw" }
+func (rawCodec) Aliases() []string      { return []string{"bin"} }
+func (rawCodec) RatioRange() (int, int) { return 1, 10 }
+
+func (rawCodec) Decode(r io.Reader) (image.Image, error) {
+	var size [2]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, err
+	}
+	return image.NewNRGBA(image.Rect(0, 0, int(size[0]), int(size[1]))), nil
+}
+
+func (rawCodec) Encode(w io.Writer, img image.Image, _ EncodeOptions) error {
+	_, err := w.Write([]byte{byte(img.Bounds().Dx()), byte(img.Bounds().Dy())})
+	return err
+}
+
+func TestRegistry_Register(t *testing.T) {
+	r := NewRegistry()
+	require.NoError(t, r.Register(pngCodec{}))
+	require.NoError(t, r.Register(rawCodec{}))
+
+	assert.Error(t, r.Register(rawCodec{}))
+	assert.Equal(t, []string{"png", "raw"}, r.Formats())
+
+	codec, ok := r.Lookup("bin")
+	require.True(t, ok)
+	assert.Equal(t, "raw", codec.Format())
+
+	_, ok = r.Lookup("jpg")
+	assert.False(t, ok)
+}
+
+func TestRegistry_CanConvert(t *testing.T) {
+	testTable := []struct {
+		name         string
+		sourceFormat string
+		targetFormat string
+		expected     bool
+	}{
+		{name: "Ok", sourceFormat: FormatPNG, targetFormat: FormatTIFF, expected: true},
+		{name: "Decode-only source format", sourceFormat: FormatWebP, targetFormat: FormatPNG, expected: true},
+		{name: "Alias", sourceFormat: FormatJPEG, targetFormat: FormatTIF, expected: true},
+		{name: "Same format", sourceFormat: FormatJPEG, targetFormat: FormatJPG, expected: false},
+		{name: "Unsupported source format", sourceFormat: "svg", targetFormat: FormatPNG, expected: false},
+		{name: "Unsupported target format", sourceFormat: FormatPNG, targetFormat: "svg", expected: false},
+		{name: "Decode-only target format", sourceFormat: FormatPNG, targetFormat: FormatWebP, expected: false},
+	}
+
+	for _, tc := range testTable {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, CanConvert(tc.sourceFormat, tc.targetFormat))
+		})
+	}
+}
+
+func TestRegistry_TargetFormats(t *testing.T) {
+	assert.Equal(t, []string{"bmp", "gif", "jpg", "png", "tiff"}, TargetFormats())
+	assert.True(t, CanEncode(FormatJPEG))
+	assert.False(t, CanEncode(FormatWebP))
+	assert.False(t, CanEncode("svg"))
+}
+
+func TestRegistry_Convert(t *testing.T) {
+	r := NewRegistry()
+	require.NoError(t, r.Register(pngCodec{}))
+	require.NoError(t, r.Register(rawCodec{}))
+
+	result, err := r.Convert(context.Background(), newTestImage(t), FormatPNG, "bin", 5, Options{Rotation: 90})
+	require.NoError(t, err)
+
+	img, err := rawCodec{}.Decode(result)
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 20, 30), img.Bounds())
+
+	_, err = r.Convert(context.Background(), newTestImage(t), FormatPNG, "raw", 50, Options{})
+	assert.Error(t, err)
+
+	_, err = r.Convert(context.Background(), bytes.NewReader([]byte{1, 1}), FormatJPEG, FormatPNG, 50, Options{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,21 @@
+package converter
+
+// Rendition represents an additional size of the converted image produced from the same source.
+type Rendition struct {
+	Name   string `json:"name"`
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+	Format string `json:"format"`
+	Ratio  int    `json:"ratio"`
+}
+
+// Options returns the operations for the rendition: the ones of the main conversion
+// with the size of the rendition. The image is fit into the box if both sides are given.
+func (r Rendition) Options(base Options) Options {
+	opts := base
+	opts.Width, opts.Height, opts.Fit = r.Width, r.Height, ""
+	if r.Width > 0 && r.Height > 0 {
+		opts.Fit = FitContain
+	}
+	return opts
+}
@@ -0,0 +1,200 @@
+package converter
+
+import (
+	"fmt"
+	"image"
+
+	"golang.org/x/image/draw"
+)
+
+const (
+	// FitContain scales the image to fit inside the given box preserving the aspect ratio.
+	FitContain = "contain"
+	// FitCover scales the image to cover the given box preserving the aspect ratio and crops the overflow.
+	FitCover = "cover"
+	// FitFill stretches the image to the exact size of the given box.
+	FitFill = "fill"
+)
+
+const (
+	// FlipHorizontal mirrors the image along the vertical axis.
+	FlipHorizontal = "horizontal"
+	// FlipVertical mirrors the image along the horizontal axis.
+	FlipVertical = "vertical"
+)
+
+// Crop represents the rectangle cut out of the source image.
+type Crop struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// Options represents the operations applied to the image before encoding.
+// Crop is applied first, then rotation (clockwise), flip and resizing.
+// Metadata sets how the source EXIF metadata is carried over, it is stripped by default.
+type Options struct {
+	Width    int    `json:"width,omitempty"`
+	Height   int    `json:"height,omitempty"`
+	Fit      string `json:"fit,omitempty"`
+	Crop     *Crop  `json:"crop,omitempty"`
+	Rotation int    `json:"rotation,omitempty"`
+	Flip     string `json:"flip,omitempty"`
+	Metadata string `json:"metadata,omitempty"`
+}
+
+// Transform applies the given operations to the image.
+func Transform(img image.Image, opts Options) (image.Image, error) {
+	if opts.Crop != nil {
+		var err error
+		img, err = crop(img, *opts.Crop)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch opts.Rotation {
+	case 0:
+	case 90, 180, 270:
+		img = rotate(img, opts.Rotation)
+	default:
+		return nil, fmt.Errorf("unsupported rotation: %d", opts.Rotation)
+	}
+
+	switch opts.Flip {
+	case "":
+	case FlipHorizontal, FlipVertical:
+		img = flip(img, opts.Flip)
+	default:
+		return nil, fmt.Errorf("unsupported flip: %s", opts.Flip)
+	}
+
+	if opts.Width > 0 || opts.Height > 0 {
+		return resize(img, opts.Width, opts.Height, opts.Fit)
+	}
+
+	return img, nil
+}
+
+// crop cuts the given rectangle out of the image.
+func crop(img image.Image, c Crop) (image.Image, error) {
+	b := img.Bounds()
+	rect := image.Rect(c.X, c.Y, c.X+c.Width, c.Y+c.Height).Add(b.Min)
+	if c.Width <= 0 || c.Height <= 0 || !rect.In(b) {
+		return nil, fmt.Errorf("crop rectangle %v is out of the image bounds %v", rect, b)
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, c.Width, c.Height))
+	draw.Draw(dst, dst.Bounds(), img, rect.Min, draw.Src)
+	return dst, nil
+}
+
+// rotate rotates the image clockwise by 90, 180 or 270 degrees.
+func rotate(img image.Image, degrees int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	var dst *image.NRGBA
+	if degrees == 180 {
+		dst = image.NewNRGBA(image.Rect(0, 0, w, h))
+	} else {
+		dst = image.NewNRGBA(image.Rect(0, 0, h, w))
+	}
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := img.At(b.Min.X+x, b.Min.Y+y)
+			switch degrees {
+			case 90:
+				dst.Set(h-1-y, x, c)
+			case 180:
+				dst.Set(w-1-x, h-1-y, c)
+			case 270:
+				dst.Set(y, w-1-x, c)
+			}
+		}
+	}
+	return dst
+}
+
+// flip mirrors the image in the given direction.
+func flip(img image.Image, direction string) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := img.At(b.Min.X+x, b.Min.Y+y)
+			if direction == FlipHorizontal {
+				dst.Set(w-1-x, y, c)
+			} else {
+				dst.Set(x, h-1-y, c)
+			}
+		}
+	}
+	return dst
+}
+
+// resize scales the image to the given box according to the fit mode.
+// If only one side is given, the other one is calculated preserving the aspect ratio.
+func resize(img image.Image, width, height int, fit string) (image.Image, error) {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	switch {
+	case height == 0:
+		height = max(1, h*width/w)
+		fit = FitFill
+	case width == 0:
+		width = max(1, w*height/h)
+		fit = FitFill
+	}
+
+	src := b
+	switch fit {
+	case FitFill:
+	case FitContain, "":
+		if w*height > h*width {
+			height = max(1, h*width/w)
+		} else {
+			width = max(1, w*height/h)
+		}
+	case FitCover:
+		// Cut the central part of the source with the aspect ratio of the box, then scale it.
+		// The part is at least 1px wide and high even for the extreme aspect ratios.
+		if w*height > h*width {
+			cw := max(1, h*width/height)
+			src.Min.X += (w - cw) / 2
+			src.Max.X = src.Min.X + cw
+		} else {
+			ch := max(1, w*height/width)
+			src.Min.Y += (h - ch) / 2
+			src.Max.Y = src.Min.Y + ch
+		}
+	default:
+		return nil, fmt.Errorf("unsupported fit mode: %s", fit)
+	}
+
+	// The side calculated from the aspect ratio may be much larger than the requested one.
+	if int64(width)*int64(height) > MaxPixels {
+		return nil, fmt.Errorf("%w: %dx%d is more than %d pixels", ErrTargetTooLarge, width, height, MaxPixels)
+	}
+
+	return scale(img, src, width, height), nil
+}
+
+// scale scales the given part of the image to the given size.
+func scale(img image.Image, src image.Rectangle, width, height int) image.Image {
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, src, draw.Src, nil)
+	return dst
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -1,138 +1,186 @@
-// Package queue implements the message queue functionality using RabbitMQ.
+// Package queue implements the message queue functionality using RabbitMQ or the in-memory queue.
 package queue
 
 import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sync"
 
 	"github.com/Konstantsiy/image-converter/internal/config"
-	"github.com/Konstantsiy/image-converter/internal/converter"
 	"github.com/Konstantsiy/image-converter/internal/repository"
 	"github.com/Konstantsiy/image-converter/internal/storage"
+	"github.com/Konstantsiy/image-converter/internal/webhook"
 	"github.com/Konstantsiy/image-converter/pkg/logger"
 	"github.com/streadway/amqp"
 )
 
 // RabbitMQConsumer listens to the queue and processes outgoing messages.
 type RabbitMQConsumer struct {
-	client       *rabbitMQClient
-	requestsRepo *repository.RequestsRepository
-	imagesRepo   *repository.ImagesRepository
-	s3           *storage.S3Storage
+	*processor
+	client *rabbitMQClient
 }
 
 // NewRabbitMQConsumer creates new RabbitMQ queue consumer.
-func NewRabbitMQConsumer(requestsRepo *repository.RequestsRepository, imagesRepo *repository.ImagesRepository, s3 *storage.S3Storage, conf *config.RabbitMQConfig) (*RabbitMQConsumer, error) {
-	client, err := initRabbitMQClient(conf)
+func NewRabbitMQConsumer(requestsRepo *repository.RequestsRepository, imagesRepo *repository.ImagesRepository, s3 storage.Storage, notifier *webhook.Notifier, conf *config.RabbitMQConfig) (*RabbitMQConsumer, error) {
+	client, err := initRabbitMQClient(conf, true)
 	if err != nil {
 		return nil, err
 	}
-	return &RabbitMQConsumer{requestsRepo: requestsRepo, imagesRepo: imagesRepo, s3: s3, client: client}, nil
+	return &RabbitMQConsumer{
+		processor: newProcessor(requestsRepo, imagesRepo, s3, notifier, conf.ConversionTimeout),
+		client:    client}, nil
 }
 
-// Listen listens to the queue channel in a separate goroutine.
-func (c *RabbitMQConsumer) Listen() error {
-	err := c.client.ch.Qos(1, 0, false)
-	if err != nil {
-		return fmt.Errorf("can't configure QoS: %w", err)
-	}
+// consumerTag identifies the consumer on the channel to cancel it on shutdown.
+const consumerTag = "converter"
 
-	msgChannel, err := c.client.ch.Consume(c.client.queue.Name, "", false, false, false, false, nil)
-	if err != nil {
-		return fmt.Errorf("can't register channel: %w", err)
+// Listen processes the messages with the configured number of workers until the context is canceled.
+// After that it stops receiving messages and waits for the in-flight conversions and webhook deliveries.
+// The consumer is registered again when the client restores the lost connection.
+func (c *RabbitMQConsumer) Listen(ctx context.Context) error {
+	workers := c.client.conf.Workers
+	if workers < 1 {
+		workers = 1
 	}
 
-	ctx := context.Background()
+	msgChannel := c.client.consume(ctx, consumerTag, workers)
 
-	for {
-		msg := <-msgChannel
-		logger.FromContext(ctx).Infoln("message received from queue")
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
 		go func() {
-			logger.FromContext(ctx).Infoln("message processing...")
-			err := c.consumeFromQueue(ctx, &msg)
-			if err != nil {
-				nErr := msg.Nack(true, false)
-				if nErr != nil {
-					logger.FromContext(ctx).
-						Errorln(fmt.Errorf("can't make negative acknowledgement: %w, (original error: %v)", nErr, err))
-				}
-				return
-			}
-			aErr := msg.Ack(false)
-			if aErr != nil {
-				logger.FromContext(ctx).Errorln(fmt.Errorf("can't make acknowledgement: %w", aErr))
+			defer wg.Done()
+			for msg := range msgChannel {
+				c.handle(msg)
 			}
-			logger.FromContext(ctx).Infoln("message processed successfully")
 		}()
 	}
-}
 
-// consumeFromQueue wraps the message processing and confirms its completion.
-func (c *RabbitMQConsumer) consumeFromQueue(ctx context.Context, msg *amqp.Delivery) error {
-	var data queueMessage
-	err := json.NewDecoder(bytes.NewReader(msg.Body)).Decode(&data)
-	if err != nil {
-		return fmt.Errorf("can't decode queue message: %w", err)
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		c.pending.Wait()
+		return fmt.Errorf("delivery channel closed")
+	case <-ctx.Done():
 	}
 
-	err = c.process(ctx, data)
-	if err != nil {
-		uErr := c.requestsRepo.UpdateRequest(ctx, data.RequestID, repository.RequestStatusFailed, "")
-		if uErr != nil {
-			logger.FromContext(ctx).WithField("request_id", data.RequestID).
-				Errorln(fmt.Errorf("can't update request: %w, (original error: %v)", err, err))
-		}
-		return fmt.Errorf("error processing a message from the queue: %w", err)
+	logger.FromContext(ctx).Infoln("stopping the consumer, waiting for in-flight conversions")
+	if err := c.client.cancel(consumerTag); err != nil {
+		logger.FromContext(ctx).Errorln(fmt.Errorf("can't cancel the consumer: %w", err))
+	}
+	<-finished
+	c.pending.Wait()
+
+	if err := c.client.close(); err != nil {
+		return fmt.Errorf("can't close AMQP connection: %w", err)
 	}
+	logger.FromContext(ctx).Infoln("consumer stopped")
 
 	return nil
 }
 
-// process the current message from the queue.
-func (c *RabbitMQConsumer) process(ctx context.Context, data queueMessage) error {
-	sourceFile, err := c.s3.DownloadFile(data.FileID)
+// handle processes the message and acknowledges it.
+func (c *RabbitMQConsumer) handle(msg amqp.Delivery) {
+	ctx := context.Background()
+	logger.FromContext(ctx).Infoln("message processing...")
+
+	err := c.consumeFromQueue(ctx, &msg)
 	if err != nil {
-		return fmt.Errorf("s3 error: %w", err)
+		// the work queue sends the rejected message to the dead-letter exchange unless it's requeued
+		requeue := isRequeued(err)
+		nErr := msg.Nack(false, requeue)
+		if nErr != nil {
+			logger.FromContext(ctx).
+				Errorln(fmt.Errorf("can't make negative acknowledgement: %w, (original error: %v)", nErr, err))
+		}
+		if requeue {
+			logger.FromContext(ctx).Errorln(fmt.Errorf("message requeued: %w", err))
+		} else {
+			logger.FromContext(ctx).Errorln(fmt.Errorf("message rejected: %w", err))
+		}
+		return
 	}
-	logger.FromContext(ctx).WithField("file_id", data.FileID).
-		Infoln("original file successfully downloaded from the S3 s3")
 
-	targetFile, err := converter.Convert(sourceFile, data.TargetFormat, data.Ratio)
-	if err != nil {
-		return fmt.Errorf("converter error: %w", err)
+	aErr := msg.Ack(false)
+	if aErr != nil {
+		logger.FromContext(ctx).Errorln(fmt.Errorf("can't make acknowledgement: %w", aErr))
 	}
-	logger.FromContext(ctx).WithField("file_id", data.FileID).
-		Infoln("converter successfully processed the original file")
+	logger.FromContext(ctx).Infoln("message processed successfully")
+}
 
-	err = c.requestsRepo.UpdateRequest(ctx, data.RequestID, repository.RequestStatusProcessing, "")
+// consumeFromQueue wraps the message processing and handles its failure.
+// The returned error means that the message should be rejected.
+func (c *RabbitMQConsumer) consumeFromQueue(ctx context.Context, msg *amqp.Delivery) error {
+	var data queueMessage
+	err := json.NewDecoder(bytes.NewReader(msg.Body)).Decode(&data)
 	if err != nil {
-		return fmt.Errorf("can't update request with id %s: %w", data.RequestID, err)
+		return fmt.Errorf("can't decode queue message: %w", err)
 	}
-	logger.FromContext(ctx).WithField("request_id", data.RequestID).
-		Infoln("request updated to the status \"processing\"")
 
-	targetFileID, err := c.imagesRepo.InsertImage(ctx, data.Filename, data.TargetFormat)
+	err = c.processWithTimeout(ctx, data)
 	if err != nil {
-		return fmt.Errorf("repository error: %w", err)
+		return c.handleFailure(ctx, msg, data, err)
 	}
-	logger.FromContext(ctx).WithField("file_id", targetFileID).
-		Infoln("converted file successfully saved in the database")
 
-	err = c.s3.UploadFile(targetFile, targetFileID)
-	if err != nil {
-		return fmt.Errorf("s3 error: %w", err)
+	return nil
+}
+
+// handleFailure schedules the retry of the failed message or, if the error is permanent or the retries are exhausted,
+// marks the request failed and moves the message to the dead-letter exchange. The message is acknowledged only after
+// the broker confirms its copy, otherwise it's requeued.
+func (c *RabbitMQConsumer) handleFailure(ctx context.Context, msg *amqp.Delivery, data queueMessage, err error) error {
+	log := logger.FromContext(ctx).WithField("request_id", data.RequestID)
+	retries := retryCount(msg.Headers)
+
+	if isRetryable(err) && retries < c.client.conf.MaxRetries {
+		retries++
+		pErr := c.client.publishConfirmed("", retryQueue(c.client.queue, retries), msg.Body,
+			amqp.Table{retryCountHeader: int32(retries)}, msg.Priority)
+		if pErr == nil {
+			c.recordRetry(ctx, data, retries, err)
+			log.WithField("retry", retries).
+				Errorln(fmt.Errorf("message processing failed, retry in %s: %w", retryDelay(c.client.conf.RetryDelay, retries), err))
+			return nil
+		}
+		log.Errorln(fmt.Errorf("can't schedule retry: %w", pErr))
 	}
-	logger.FromContext(ctx).WithField("file_id", targetFileID).
-		Infoln("converted file successfully uploaded to the S3 s3")
 
-	err = c.requestsRepo.UpdateRequest(ctx, data.RequestID, repository.RequestStatusDone, targetFileID)
-	if err != nil {
-		return fmt.Errorf("request updating error: %w", err)
+	pErr := c.client.publishConfirmed(deadLetterExchange(c.client.queue), "", msg.Body,
+		amqp.Table{retryCountHeader: int32(retries), lastErrorHeader: err.Error()}, msg.Priority)
+	if pErr != nil {
+		return &requeueError{fmt.Errorf("can't publish to the dead-letter exchange: %w, (original error: %v)", pErr, err)}
 	}
-	logger.FromContext(ctx).WithField("request_id", data.RequestID).
-		Infoln("request updated to the status \"done\"")
+
+	c.recordFailure(ctx, data, retries, err)
+	log.Errorln(fmt.Errorf("message moved to the dead-letter queue after %d retries: %w", retries, err))
 
 	return nil
 }
+
+// requeueError represents the failure to hand the message over, e.g. the unconfirmed publishing,
+// the message is returned to the work queue to be processed again.
+type requeueError struct {
+	err error
+}
+
+func (e *requeueError) Error() string {
+	return e.err.Error()
+}
+
+func (e *requeueError) Unwrap() error {
+	return e.err
+}
+
+// isRequeued reports whether the failed message should be returned to the work queue.
+func isRequeued(err error) bool {
+	var rErr *requeueError
+	return errors.As(err, &rErr)
+}
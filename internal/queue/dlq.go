@@ -0,0 +1,137 @@
+package queue
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Konstantsiy/image-converter/internal/config"
+	"github.com/streadway/amqp"
+)
+
+// DeadLetter represents the message moved to the dead-letter queue.
+type DeadLetter struct {
+	RequestID  string    `json:"request_id"`
+	RetryCount int       `json:"retry_count"`
+	LastError  string    `json:"last_error"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// DeadLetterQueue allows to inspect and replay the messages that couldn't be processed.
+type DeadLetterQueue struct {
+	client *rabbitMQClient
+}
+
+// NewDeadLetterQueue creates new dead-letter queue client.
+func NewDeadLetterQueue(conf *config.RabbitMQConfig) (*DeadLetterQueue, error) {
+	client, err := initRabbitMQClient(conf, false)
+	if err != nil {
+		return nil, err
+	}
+	return &DeadLetterQueue{client: client}, nil
+}
+
+// List returns up to limit dead-lettered messages, the messages stay in the queue.
+func (q *DeadLetterQueue) List(limit int) ([]DeadLetter, error) {
+	deliveries, err := q.fetch(limit)
+	defer requeue(deliveries)
+	if err != nil {
+		return nil, err
+	}
+
+	letters := make([]DeadLetter, 0, len(deliveries))
+	for _, d := range deliveries {
+		letters = append(letters, parseDeadLetter(d))
+	}
+
+	return letters, nil
+}
+
+// Replay moves the dead-lettered messages of the request, or all messages if the request id is empty,
+// back to the work queue with the reset retry count and returns the replayed messages.
+func (q *DeadLetterQueue) Replay(requestID string) ([]DeadLetter, error) {
+	deliveries, err := q.fetch(0)
+	if err != nil {
+		requeue(deliveries)
+		return nil, err
+	}
+
+	var replayed []DeadLetter
+	var skipped []amqp.Delivery
+	for _, d := range deliveries {
+		letter := parseDeadLetter(d)
+		if requestID != "" && letter.RequestID != requestID {
+			skipped = append(skipped, d)
+			continue
+		}
+
+		if err = q.client.publish("", q.client.queue, d.Body, nil, d.Priority); err != nil {
+			skipped = append(skipped, d)
+			requeue(skipped)
+			return replayed, fmt.Errorf("can't publish message of request %s: %w", letter.RequestID, err)
+		}
+		if err = d.Ack(false); err != nil {
+			requeue(skipped)
+			return replayed, fmt.Errorf("can't acknowledge message of request %s: %w", letter.RequestID, err)
+		}
+		replayed = append(replayed, letter)
+	}
+	requeue(skipped)
+
+	return replayed, nil
+}
+
+// Close closes the connection.
+func (q *DeadLetterQueue) Close() error {
+	return q.client.close()
+}
+
+// fetch gets up to limit (all if limit is not positive) messages from the dead-letter queue without acknowledgement,
+// so that every message is received once.
+func (q *DeadLetterQueue) fetch(limit int) ([]amqp.Delivery, error) {
+	ch, err := q.client.channel()
+	if err != nil {
+		return nil, err
+	}
+
+	var deliveries []amqp.Delivery
+	for limit <= 0 || len(deliveries) < limit {
+		d, ok, err := ch.Get(deadLetterQueue(q.client.queue), false)
+		if err != nil {
+			return deliveries, fmt.Errorf("can't get dead-lettered message: %w", err)
+		}
+		if !ok {
+			break
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, nil
+}
+
+// requeue returns the messages to the queue.
+func requeue(deliveries []amqp.Delivery) {
+	for _, d := range deliveries {
+		_ = d.Nack(false, true)
+	}
+}
+
+// parseDeadLetter extracts the request id and the failure details from the dead-lettered message.
+// Messages rejected by the consumer have no last error header, the reason is taken from the x-death header.
+func parseDeadLetter(d amqp.Delivery) DeadLetter {
+	letter := DeadLetter{RetryCount: retryCount(d.Headers), Timestamp: d.Timestamp}
+
+	var data queueMessage
+	if err := json.Unmarshal(d.Body, &data); err == nil {
+		letter.RequestID = data.RequestID
+	}
+
+	if lastError, ok := d.Headers[lastErrorHeader].(string); ok {
+		letter.LastError = lastError
+	} else if deaths, ok := d.Headers["x-death"].([]interface{}); ok && len(deaths) > 0 {
+		if death, ok := deaths[0].(amqp.Table); ok {
+			letter.LastError = fmt.Sprintf("%v", death["reason"])
+		}
+	}
+
+	return letter
+}
@@ -0,0 +1,43 @@
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDeadLetter(t *testing.T) {
+	timestamp := time.Date(2021, 11, 6, 21, 35, 7, 0, time.UTC)
+
+	testTable := []struct {
+		name     string
+		delivery amqp.Delivery
+		expected DeadLetter
+	}{
+		{
+			name: "Exhausted retries",
+			delivery: amqp.Delivery{
+				Headers:   amqp.Table{retryCountHeader: int32(3), lastErrorHeader: "s3 error: timeout"},
+				Timestamp: timestamp,
+				Body:      []byte(`{"RequestID":"1","FileID":"2"}`),
+			},
+			expected: DeadLetter{RequestID: "1", RetryCount: 3, LastError: "s3 error: timeout", Timestamp: timestamp},
+		},
+		{
+			name: "Rejected message",
+			delivery: amqp.Delivery{
+				Headers: amqp.Table{"x-death": []interface{}{amqp.Table{"reason": "rejected", "queue": "converter"}}},
+				Body:    []byte(`not a json`),
+			},
+			expected: DeadLetter{LastError: "rejected"},
+		},
+	}
+
+	for _, tc := range testTable {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, parseDeadLetter(tc.delivery))
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package queue
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Konstantsiy/image-converter/internal/config"
+	"github.com/Konstantsiy/image-converter/internal/converter"
+	"github.com/Konstantsiy/image-converter/internal/repository"
+	"github.com/Konstantsiy/image-converter/internal/storage"
+	"github.com/Konstantsiy/image-converter/internal/webhook"
+	"github.com/Konstantsiy/image-converter/pkg/logger"
+)
+
+// ErrQueueFull notifies that the in-memory queue has no room for the message.
+var ErrQueueFull = errors.New("queue is full")
+
+// memoryMessage represents the message of the in-memory queue.
+type memoryMessage struct {
+	data    queueMessage
+	retries int
+	seq     uint64
+}
+
+// memoryMessages is the heap of the messages ordered by priority, then by the sending order.
+type memoryMessages []memoryMessage
+
+func (m memoryMessages) Len() int { return len(m) }
+
+func (m memoryMessages) Less(i, j int) bool {
+	if m[i].data.Priority != m[j].data.Priority {
+		return m[i].data.Priority > m[j].data.Priority
+	}
+	return m[i].seq < m[j].seq
+}
+
+func (m memoryMessages) Swap(i, j int) { m[i], m[j] = m[j], m[i] }
+
+func (m *memoryMessages) Push(x interface{}) { *m = append(*m, x.(memoryMessage)) }
+
+func (m *memoryMessages) Pop() interface{} {
+	old := *m
+	msg := old[len(old)-1]
+	*m = old[:len(old)-1]
+	return msg
+}
+
+// MemoryQueue implements the queue producer keeping the messages in the process memory,
+// it's consumed by MemoryConsumer in the same process. The messages are lost when the process stops,
+// the unfinished requests are sent once again on startup through the outbox.
+// The messages of higher priority are consumed first.
+type MemoryQueue struct {
+	mu       sync.Mutex
+	messages memoryMessages
+	size     int
+	seq      uint64
+	// ready holds a token for every message in the heap, the consumers wait on it.
+	ready chan struct{}
+}
+
+// NewMemoryQueue creates new in-memory queue holding up to size messages.
+func NewMemoryQueue(size int) *MemoryQueue {
+	if size < 1 {
+		size = 1
+	}
+	return &MemoryQueue{size: size, ready: make(chan struct{}, size)}
+}
+
+// SendToQueue sends messages to the queue, ErrQueueFull is returned if the queue has no room for the message.
+func (q *MemoryQueue) SendToQueue(fileID, filename, sourceFormat, targetFormat, requestID string, ratio, priority int, opts converter.Options, renditions []converter.Rendition) error {
+	return q.push(memoryMessage{data: queueMessage{
+		FileID:       fileID,
+		Filename:     filename,
+		SourceFormat: sourceFormat,
+		TargetFormat: targetFormat,
+		RequestID:    requestID,
+		Ratio:        ratio,
+		Priority:     priority,
+		Options:      opts,
+		Renditions:   renditions,
+	}})
+}
+
+func (q *MemoryQueue) push(msg memoryMessage) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.messages) >= q.size {
+		return ErrQueueFull
+	}
+
+	q.seq++
+	msg.seq = q.seq
+	heap.Push(&q.messages, msg)
+	q.ready <- struct{}{}
+
+	return nil
+}
+
+// pop takes the message of the highest priority, it must be called after receiving the token from ready.
+func (q *MemoryQueue) pop() memoryMessage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return heap.Pop(&q.messages).(memoryMessage)
+}
+
+func (q *MemoryQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.messages)
+}
+
+// MemoryConsumer processes the messages of the in-memory queue.
+// The failed messages are retried like in the RabbitMQ queue, the exhausted ones only mark the request failed.
+type MemoryConsumer struct {
+	*processor
+	queue *MemoryQueue
+	conf  *config.RabbitMQConfig
+}
+
+// NewMemoryConsumer creates new in-memory queue consumer,
+// the number of workers, the retries and the conversion timeout are taken from the RabbitMQ configuration.
+func NewMemoryConsumer(q *MemoryQueue, requestsRepo *repository.RequestsRepository, imagesRepo *repository.ImagesRepository, s3 storage.Storage, notifier *webhook.Notifier, conf *config.RabbitMQConfig) *MemoryConsumer {
+	return &MemoryConsumer{
+		processor: newProcessor(requestsRepo, imagesRepo, s3, notifier, conf.ConversionTimeout),
+		queue:     q,
+		conf:      conf,
+	}
+}
+
+// Listen processes the messages with the configured number of workers until the context is canceled,
+// then it waits for the in-flight conversions and webhook deliveries.
+func (c *MemoryConsumer) Listen(ctx context.Context) error {
+	workers := c.conf.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-c.queue.ready:
+					c.handle(c.queue.pop())
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	c.pending.Wait()
+	logger.FromContext(ctx).WithField("unprocessed", c.queue.len()).Infoln("consumer stopped")
+
+	return nil
+}
+
+// handle processes the message and schedules its retry or marks the request failed on error.
+func (c *MemoryConsumer) handle(msg memoryMessage) {
+	ctx := context.Background()
+	log := logger.FromContext(ctx).WithField("request_id", msg.data.RequestID)
+
+	err := c.processWithTimeout(ctx, msg.data)
+	if err == nil {
+		log.Infoln("message processed successfully")
+		return
+	}
+
+	if isRetryable(err) && msg.retries < c.conf.MaxRetries {
+		msg.retries++
+		delay := retryDelay(c.conf.RetryDelay, msg.retries)
+		c.recordRetry(ctx, msg.data, msg.retries, err)
+		log.WithField("retry", msg.retries).Errorln(fmt.Errorf("message processing failed, retry in %s: %w", delay, err))
+
+		time.AfterFunc(delay, func() {
+			if pErr := c.queue.push(msg); pErr != nil {
+				c.recordFailure(ctx, msg.data, msg.retries, fmt.Errorf("can't schedule retry: %w, (original error: %v)", pErr, err))
+			}
+		})
+		return
+	}
+
+	c.recordFailure(ctx, msg.data, msg.retries, err)
+	log.Errorln(fmt.Errorf("message processing failed after %d retries: %w", msg.retries, err))
+}
@@ -0,0 +1,62 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Konstantsiy/image-converter/internal/config"
+	"github.com/Konstantsiy/image-converter/internal/converter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryQueue_SendToQueue(t *testing.T) {
+	q := NewMemoryQueue(1)
+
+	err := q.SendToQueue("1", "cat", "jpg", "png", "2", 90, 5, converter.Options{}, nil)
+	require.NoError(t, err)
+
+	err = q.SendToQueue("3", "dog", "jpg", "png", "4", 90, 5, converter.Options{}, nil)
+	assert.Equal(t, ErrQueueFull, err)
+
+	<-q.ready
+	msg := q.pop()
+	assert.Equal(t, "2", msg.data.RequestID)
+	assert.Equal(t, 0, msg.retries)
+}
+
+func TestMemoryQueue_Priority(t *testing.T) {
+	q := NewMemoryQueue(4)
+
+	require.NoError(t, q.SendToQueue("1", "a", "jpg", "png", "batch-1", 90, 1, converter.Options{}, nil))
+	require.NoError(t, q.SendToQueue("2", "b", "jpg", "png", "batch-2", 90, 1, converter.Options{}, nil))
+	require.NoError(t, q.SendToQueue("3", "c", "jpg", "png", "single", 90, 5, converter.Options{}, nil))
+	require.NoError(t, q.SendToQueue("4", "d", "jpg", "png", "premium", 90, 9, converter.Options{}, nil))
+
+	var order []string
+	for i := 0; i < 4; i++ {
+		<-q.ready
+		order = append(order, q.pop().data.RequestID)
+	}
+	assert.Equal(t, []string{"premium", "single", "batch-1", "batch-2"}, order)
+	assert.Equal(t, 0, q.len())
+}
+
+func TestMemoryConsumer_Listen(t *testing.T) {
+	c := NewMemoryConsumer(NewMemoryQueue(1), nil, nil, nil, nil, &config.RabbitMQConfig{Workers: 2})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- c.Listen(ctx)
+	}()
+	cancel()
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("consumer is not stopped after the context cancellation")
+	}
+}
@@ -0,0 +1,61 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Konstantsiy/image-converter/internal/config"
+	"github.com/streadway/amqp"
+)
+
+// MigrateQueue moves the messages left in the work queue of the first topology version, declared
+// without arguments under the configured name, to the current versioned work queue and deletes the old queue.
+// It returns the number of moved messages, the missing old queue is not an error.
+func MigrateQueue(conf *config.RabbitMQConfig) (int, error) {
+	client, err := initRabbitMQClient(conf, true)
+	if err != nil {
+		return 0, err
+	}
+	defer client.close()
+
+	ch, err := client.channel()
+	if err != nil {
+		return 0, err
+	}
+
+	legacy := conf.QueueName
+	if _, err = ch.QueueInspect(legacy); err != nil {
+		var amqpErr *amqp.Error
+		if errors.As(err, &amqpErr) && amqpErr.Code == amqp.NotFound {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("can't inspect %s queue: %w", legacy, err)
+	}
+
+	moved := 0
+	for {
+		d, ok, err := ch.Get(legacy, false)
+		if err != nil {
+			return moved, fmt.Errorf("can't get message from %s queue: %w", legacy, err)
+		}
+		if !ok {
+			break
+		}
+
+		if err = client.publishConfirmed("", client.queue, d.Body, d.Headers, d.Priority); err != nil {
+			_ = d.Nack(false, true)
+			return moved, fmt.Errorf("can't publish message to %s queue: %w", client.queue, err)
+		}
+		if err = d.Ack(false); err != nil {
+			return moved, fmt.Errorf("can't acknowledge message of %s queue: %w", legacy, err)
+		}
+		moved++
+	}
+
+	// The queue that got new messages meanwhile, e.g. from the producer of the previous version, is kept.
+	if _, err = ch.QueueDelete(legacy, false, true, false); err != nil {
+		return moved, fmt.Errorf("can't delete %s queue: %w", legacy, err)
+	}
+
+	return moved, nil
+}
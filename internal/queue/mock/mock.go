@@ -5,8 +5,10 @@
 package mock_queue
 
 import (
+	context "context"
 	"reflect"
 
+	converter "github.com/Konstantsiy/image-converter/internal/converter"
 	gomock "github.com/golang/mock/gomock"
 )
 
@@ -34,17 +36,17 @@ func (m *MockProducer) EXPECT() *MockProducerMockRecorder {
 }
 
 // SendToQueue mocks base method.
-func (m *MockProducer) SendToQueue(fileID, filename, sourceFormat, targetFormat, requestID string, ratio int) error {
+func (m *MockProducer) SendToQueue(fileID, filename, sourceFormat, targetFormat, requestID string, ratio, priority int, opts converter.Options, renditions []converter.Rendition) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SendToQueue", fileID, filename, sourceFormat, targetFormat, requestID, ratio)
+	ret := m.ctrl.Call(m, "SendToQueue", fileID, filename, sourceFormat, targetFormat, requestID, ratio, priority, opts, renditions)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // SendToQueue indicates an expected call of SendToQueue.
-func (mr *MockProducerMockRecorder) SendToQueue(fileID, filename, sourceFormat, targetFormat, requestID, ratio interface{}) *gomock.Call {
+func (mr *MockProducerMockRecorder) SendToQueue(fileID, filename, sourceFormat, targetFormat, requestID, ratio, priority, opts, renditions interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendToQueue", reflect.TypeOf((*MockProducer)(nil).SendToQueue), fileID, filename, sourceFormat, targetFormat, requestID, ratio)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendToQueue", reflect.TypeOf((*MockProducer)(nil).SendToQueue), fileID, filename, sourceFormat, targetFormat, requestID, ratio, priority, opts, renditions)
 }
 
 // MockConsumer is a mock of Consumer interface.
@@ -71,15 +73,15 @@ func (m *MockConsumer) EXPECT() *MockConsumerMockRecorder {
 }
 
 // Listen mocks base method.
-func (m *MockConsumer) Listen() error {
+func (m *MockConsumer) Listen(ctx context.Context) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Listen")
+	ret := m.ctrl.Call(m, "Listen", ctx)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // Listen indicates an expected call of Listen.
-func (mr *MockConsumerMockRecorder) Listen() *gomock.Call {
+func (mr *MockConsumerMockRecorder) Listen(ctx interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Listen", reflect.TypeOf((*MockConsumer)(nil).Listen))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Listen", reflect.TypeOf((*MockConsumer)(nil).Listen), ctx)
 }
@@ -0,0 +1,115 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Konstantsiy/image-converter/internal/repository"
+	"github.com/Konstantsiy/image-converter/pkg/logger"
+)
+
+const (
+	// outboxBatchSize is the number of outbox entries claimed at once.
+	outboxBatchSize = 100
+	// outboxLease is the time the claimed entries are hidden from the other relays while they are sent.
+	outboxLease = 5 * time.Minute
+	// maxOutboxRetryDelay limits the delay before the failed entry is sent again.
+	maxOutboxRetryDelay = 5 * time.Minute
+)
+
+// OutboxRelay sends the conversion requests saved in the outbox to the queue.
+type OutboxRelay struct {
+	outboxRepo repository.Outbox
+	producer   Producer
+	interval   time.Duration
+}
+
+// NewOutboxRelay creates new outbox relay.
+func NewOutboxRelay(outboxRepo repository.Outbox, producer Producer, interval time.Duration) *OutboxRelay {
+	return &OutboxRelay{outboxRepo: outboxRepo, producer: producer, interval: interval}
+}
+
+// Run relays the outbox every interval until the context is canceled.
+func (r *OutboxRelay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		r.relay(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// relay sends the due outbox entries batch by batch until none is left. The entry that fails to be sent
+// is retried later with the growing delay, so that it doesn't block the other entries.
+func (r *OutboxRelay) relay(ctx context.Context) {
+	for {
+		entries, err := r.outboxRepo.ClaimOutbox(ctx, outboxBatchSize, outboxLease)
+		if err != nil {
+			logger.FromContext(ctx).Errorln(fmt.Errorf("can't relay outbox: %w", err))
+			return
+		}
+
+		sent := r.sendBatch(ctx, entries)
+		if len(sent) > 0 {
+			if err = r.outboxRepo.CompleteOutbox(ctx, sent); err != nil {
+				logger.FromContext(ctx).Errorln(fmt.Errorf("can't relay outbox: %w", err))
+				return
+			}
+			logger.FromContext(ctx).WithField("count", len(sent)).Infoln("outbox entries have been sent to the queue")
+		}
+
+		if len(entries) < outboxBatchSize {
+			return
+		}
+	}
+}
+
+// sendBatch sends the claimed entries to the queue and returns the ids of the sent ones.
+// The failed entries are recorded with the delay before the next attempt.
+func (r *OutboxRelay) sendBatch(ctx context.Context, entries []repository.OutboxEntry) []string {
+	var sent []string
+	for _, e := range entries {
+		err := r.send(e)
+		if err == nil {
+			sent = append(sent, e.ID)
+			continue
+		}
+
+		delay := outboxRetryDelay(r.interval, e.Attempts+1)
+		logger.FromContext(ctx).WithField("request_id", e.RequestID).WithField("retry_in", delay).
+			Errorln(fmt.Errorf("can't send outbox entry: %w", err))
+		if fErr := r.outboxRepo.FailOutbox(ctx, e.ID, err.Error(), delay); fErr != nil {
+			logger.FromContext(ctx).WithField("request_id", e.RequestID).Errorln(fErr)
+		}
+	}
+	return sent
+}
+
+func (r *OutboxRelay) send(e repository.OutboxEntry) error {
+	return r.producer.SendToQueue(e.SourceID, e.Filename, e.SourceFormat, e.TargetFormat, e.RequestID, e.Ratio, e.Priority, e.Options, e.Renditions)
+}
+
+// outboxRetryDelay returns the delay before the next attempt to send the failed entry,
+// it doubles with every attempt up to the limit.
+func outboxRetryDelay(base time.Duration, attempt int) time.Duration {
+	if base <= 0 {
+		base = time.Second
+	}
+
+	delay := base
+	for i := 1; i < attempt && delay < maxOutboxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxOutboxRetryDelay {
+		delay = maxOutboxRetryDelay
+	}
+
+	return delay
+}
@@ -0,0 +1,79 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	mockqueue "github.com/Konstantsiy/image-converter/internal/queue/mock"
+	"github.com/Konstantsiy/image-converter/internal/repository"
+	"github.com/golang/mock/gomock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutboxRelay_Relay(t *testing.T) {
+	const (
+		entriesQuery  = "SELECT (.+) FROM converter.outbox (.+) FOR UPDATE OF o SKIP LOCKED"
+		claimQuery    = "UPDATE converter.outbox SET next_attempt = (.+) WHERE id = ANY"
+		failQuery     = "UPDATE converter.outbox SET attempts = (.+) WHERE id = (.+)"
+		completeQuery = "DELETE FROM converter.outbox WHERE id = ANY"
+	)
+
+	columns := []string{"id", "request_id", "attempts", "source_id", "name", "source_format", "target_format", "ratio", "priority",
+		"width", "height", "fit", "crop_x", "crop_y", "crop_width", "crop_height", "rotation", "flip", "metadata"}
+
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	outboxRepo, err := repository.NewOutboxRepository(db)
+	require.NoError(t, err)
+	producer := mockqueue.NewMockProducer(c)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(entriesQuery).WithArgs(outboxBatchSize).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow("1", "11", 2, "21", "cat", "jpg", "png", 90, 5, 0, 0, "", 0, 0, 0, 0, 0, "", "").
+			AddRow("2", "12", 0, "22", "dog", "png", "gif", 80, 5, 0, 0, "", 0, 0, 0, 0, 0, "", ""))
+	mock.ExpectQuery("SELECT (.+) FROM converter.renditions").WithArgs("11").
+		WillReturnRows(sqlmock.NewRows([]string{"name", "width", "height", "format", "ratio"}))
+	mock.ExpectQuery("SELECT (.+) FROM converter.renditions").WithArgs("12").
+		WillReturnRows(sqlmock.NewRows([]string{"name", "width", "height", "format", "ratio"}))
+	mock.ExpectExec(claimQuery).WithArgs(pq.Array([]string{"1", "2"}), outboxLease.Seconds()).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	producer.EXPECT().SendToQueue("21", "cat", "jpg", "png", "11", 90, 5, gomock.Any(), gomock.Any()).
+		Return(fmt.Errorf("message is rejected by the broker"))
+	mock.ExpectExec(failQuery).WithArgs("1", "message is rejected by the broker", (4 * time.Second).Seconds()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	producer.EXPECT().SendToQueue("22", "dog", "png", "gif", "12", 80, 5, gomock.Any(), gomock.Any()).Return(nil)
+	mock.ExpectExec(completeQuery).WithArgs(pq.Array([]string{"2"})).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	NewOutboxRelay(outboxRepo, producer, time.Second).relay(context.Background())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOutboxRetryDelay(t *testing.T) {
+	testTable := []struct {
+		base     time.Duration
+		attempt  int
+		expected time.Duration
+	}{
+		{base: time.Second, attempt: 1, expected: time.Second},
+		{base: time.Second, attempt: 3, expected: 4 * time.Second},
+		{base: time.Second, attempt: 20, expected: maxOutboxRetryDelay},
+		{base: 0, attempt: 1, expected: time.Second},
+	}
+
+	for _, tc := range testTable {
+		assert.Equal(t, tc.expected, outboxRetryDelay(tc.base, tc.attempt))
+	}
+}
@@ -0,0 +1,210 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Konstantsiy/image-converter/internal/config"
+	"github.com/Konstantsiy/image-converter/internal/converter"
+	"github.com/Konstantsiy/image-converter/internal/repository"
+	"github.com/Konstantsiy/image-converter/internal/storage"
+	"github.com/Konstantsiy/image-converter/internal/webhook"
+	"github.com/Konstantsiy/image-converter/pkg/logger"
+)
+
+// PostgresProducer implements the queue producer storing the messages as the jobs of the postgres queue.
+type PostgresProducer struct {
+	jobsRepo *repository.JobsRepository
+}
+
+// NewPostgresProducer creates new postgres queue producer.
+func NewPostgresProducer(jobsRepo *repository.JobsRepository) *PostgresProducer {
+	return &PostgresProducer{jobsRepo: jobsRepo}
+}
+
+// SendToQueue sends messages to the queue.
+func (p *PostgresProducer) SendToQueue(fileID, filename, sourceFormat, targetFormat, requestID string, ratio, priority int, opts converter.Options, renditions []converter.Rendition) error {
+	msg := queueMessage{
+		FileID:       fileID,
+		Filename:     filename,
+		SourceFormat: sourceFormat,
+		TargetFormat: targetFormat,
+		RequestID:    requestID,
+		Ratio:        ratio,
+		Priority:     priority,
+		Options:      opts,
+		Renditions:   renditions,
+	}
+
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("can't marshal queue message: %w", err)
+	}
+
+	return p.jobsRepo.InsertJob(context.Background(), requestID, priority, payload)
+}
+
+// PostgresConsumer claims the jobs of the postgres queue with SELECT ... FOR UPDATE SKIP LOCKED.
+// The claimed job is leased to the worker, the lease is extended while the job is processed
+// and the job of the died worker is claimed again once its lease expires.
+type PostgresConsumer struct {
+	*processor
+	jobsRepo  *repository.JobsRepository
+	conf      *config.RabbitMQConfig
+	queueConf *config.QueueConfig
+}
+
+// NewPostgresConsumer creates new postgres queue consumer,
+// the number of workers, the retries and the conversion timeout are taken from the RabbitMQ configuration.
+func NewPostgresConsumer(jobsRepo *repository.JobsRepository, requestsRepo *repository.RequestsRepository, imagesRepo *repository.ImagesRepository, s3 storage.Storage, notifier *webhook.Notifier, conf *config.RabbitMQConfig, queueConf *config.QueueConfig) *PostgresConsumer {
+	return &PostgresConsumer{
+		processor: newProcessor(requestsRepo, imagesRepo, s3, notifier, conf.ConversionTimeout),
+		jobsRepo:  jobsRepo,
+		conf:      conf,
+		queueConf: queueConf,
+	}
+}
+
+// Listen processes the jobs with the configured number of workers until the context is canceled,
+// then it waits for the in-flight conversions and webhook deliveries.
+func (c *PostgresConsumer) Listen(ctx context.Context) error {
+	workers := c.conf.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "worker"
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(worker string) {
+			defer wg.Done()
+			c.work(ctx, worker)
+		}(fmt.Sprintf("%s-%d-%d", hostname, os.Getpid(), i))
+	}
+
+	wg.Wait()
+	c.pending.Wait()
+	logger.FromContext(ctx).Infoln("consumer stopped")
+
+	return nil
+}
+
+// work claims and processes the jobs until the context is canceled, it waits for the poll interval
+// when there are no jobs available.
+func (c *PostgresConsumer) work(ctx context.Context, worker string) {
+	for ctx.Err() == nil {
+		job, err := c.jobsRepo.ClaimJob(ctx, worker, c.queueConf.LeaseTimeout)
+		if err == nil {
+			c.handle(worker, job)
+			continue
+		}
+
+		if !errors.Is(err, repository.ErrNoJobs) && ctx.Err() == nil {
+			logger.FromContext(ctx).WithField("worker", worker).Errorln(err)
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(c.queueConf.PollInterval):
+		}
+	}
+}
+
+// handle processes the job and deletes it, or releases it for the retry.
+// The job claimed more times than the retries allow is failed, its previous workers died while processing it.
+func (c *PostgresConsumer) handle(worker string, job repository.Job) {
+	ctx := context.Background()
+	log := logger.FromContext(ctx).WithField("request_id", job.RequestID).WithField("worker", worker)
+
+	var data queueMessage
+	err := json.Unmarshal(job.Payload, &data)
+	if err != nil {
+		log.Errorln(fmt.Errorf("can't decode job payload: %w", err))
+		c.deleteJob(ctx, job, worker)
+		return
+	}
+
+	if job.Attempts > c.conf.MaxRetries+1 {
+		err = fmt.Errorf("job lease expired %d times", job.Attempts-1)
+		c.recordFailure(ctx, data, job.Attempts-1, err)
+		c.deleteJob(ctx, job, worker)
+		log.Errorln(fmt.Errorf("job failed: %w", err))
+		return
+	}
+
+	stopHeartbeat := c.heartbeat(job, worker)
+	err = c.processWithTimeout(ctx, data)
+	stopHeartbeat()
+
+	if err == nil {
+		c.deleteJob(ctx, job, worker)
+		log.Infoln("job processed successfully")
+		return
+	}
+
+	if isRetryable(err) && job.Attempts <= c.conf.MaxRetries {
+		delay := retryDelay(c.conf.RetryDelay, job.Attempts)
+		c.recordRetry(ctx, data, job.Attempts, err)
+		if rErr := c.jobsRepo.ReleaseJob(ctx, job.ID, worker, delay, err.Error()); rErr != nil {
+			log.Errorln(fmt.Errorf("can't release job: %w", rErr))
+		}
+		log.WithField("retry", job.Attempts).Errorln(fmt.Errorf("job processing failed, retry in %s: %w", delay, err))
+		return
+	}
+
+	c.recordFailure(ctx, data, job.Attempts-1, err)
+	c.deleteJob(ctx, job, worker)
+	log.Errorln(fmt.Errorf("job processing failed after %d retries: %w", job.Attempts-1, err))
+}
+
+// heartbeat extends the job lease every third of the lease timeout until the returned function is called.
+func (c *PostgresConsumer) heartbeat(job repository.Job, worker string) func() {
+	interval := c.queueConf.LeaseTimeout / 3
+	if interval <= 0 {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				err := c.jobsRepo.ExtendLease(context.Background(), job.ID, worker, c.queueConf.LeaseTimeout)
+				if err != nil {
+					logger.FromContext(context.Background()).WithField("request_id", job.RequestID).
+						Errorln(fmt.Errorf("can't extend job lease: %w", err))
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+func (c *PostgresConsumer) deleteJob(ctx context.Context, job repository.Job, worker string) {
+	if err := c.jobsRepo.DeleteJob(ctx, job.ID, worker); err != nil {
+		logger.FromContext(ctx).WithField("request_id", job.RequestID).
+			Errorln(fmt.Errorf("can't delete job: %w", err))
+	}
+}
@@ -0,0 +1,271 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/Konstantsiy/image-converter/internal/converter"
+	"github.com/Konstantsiy/image-converter/internal/repository"
+	"github.com/Konstantsiy/image-converter/internal/storage"
+	"github.com/Konstantsiy/image-converter/internal/webhook"
+	"github.com/Konstantsiy/image-converter/pkg/logger"
+)
+
+// processor converts the images of the queue messages and records the results, it's shared by the consumers.
+type processor struct {
+	requestsRepo *repository.RequestsRepository
+	imagesRepo   *repository.ImagesRepository
+	s3           storage.Storage
+	notifier     *webhook.Notifier
+	timeout      time.Duration
+
+	// pending tracks the webhook deliveries running in the background.
+	pending sync.WaitGroup
+}
+
+func newProcessor(requestsRepo *repository.RequestsRepository, imagesRepo *repository.ImagesRepository, s3 storage.Storage, notifier *webhook.Notifier, timeout time.Duration) *processor {
+	return &processor{requestsRepo: requestsRepo, imagesRepo: imagesRepo, s3: s3, notifier: notifier, timeout: timeout}
+}
+
+// processWithTimeout limits the message processing by the conversion timeout.
+// The timed out processing has its context canceled, which stops the converter between the steps
+// and at its next read or write, and the timeout is reported as the permanent error.
+// The processing runs in the worker itself, so the worker slot is held until the conversion actually stops.
+func (p *processor) processWithTimeout(ctx context.Context, data queueMessage) error {
+	timeout := p.timeout
+	if timeout <= 0 {
+		return p.process(ctx, data)
+	}
+
+	processCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := p.process(processCtx, data)
+	if err != nil && processCtx.Err() == context.DeadlineExceeded {
+		return &permanentError{fmt.Errorf("conversion timed out after %s", timeout)}
+	}
+
+	return err
+}
+
+// recordRetry keeps the request queued until the next retry and records the processing error.
+func (p *processor) recordRetry(ctx context.Context, data queueMessage, retries int, err error) {
+	uErr := p.requestsRepo.UpdateRequestError(ctx, data.RequestID, repository.RequestStatusQueued, retries, err.Error())
+	if uErr != nil {
+		logger.FromContext(ctx).WithField("request_id", data.RequestID).
+			Errorln(fmt.Errorf("can't update request: %w, (original error: %v)", uErr, err))
+	}
+}
+
+// recordFailure marks the request failed and notifies the request webhooks.
+func (p *processor) recordFailure(ctx context.Context, data queueMessage, retries int, err error) {
+	uErr := p.requestsRepo.UpdateRequestError(ctx, data.RequestID, repository.RequestStatusFailed, retries, err.Error())
+	if uErr != nil {
+		logger.FromContext(ctx).WithField("request_id", data.RequestID).
+			Errorln(fmt.Errorf("can't update request: %w, (original error: %v)", uErr, err))
+		return
+	}
+	p.notify(ctx, data.RequestID, repository.RequestStatusFailed, "")
+}
+
+// process the current message from the queue.
+// The converted images created by the failed processing are discarded, so that the retries don't leave them behind.
+func (p *processor) process(ctx context.Context, data queueMessage) (err error) {
+	if !converter.CanConvert(data.SourceFormat, data.TargetFormat) {
+		return &permanentError{fmt.Errorf("unsupported conversion from %s to %s", data.SourceFormat, data.TargetFormat)}
+	}
+
+	reusedFileID, err := p.requestsRepo.ReuseConversion(ctx, data.RequestID)
+	if err != nil {
+		return fmt.Errorf("repository error: %w", err)
+	}
+	if reusedFileID != "" {
+		logger.FromContext(ctx).WithField("request_id", data.RequestID).WithField("file_id", reusedFileID).
+			Infoln("request served from the equal conversion")
+		p.notify(ctx, data.RequestID, repository.RequestStatusDone, reusedFileID)
+		return nil
+	}
+
+	sourceFile, err := p.s3.DownloadFile(data.FileID)
+	if err != nil {
+		return fmt.Errorf("s3 error: %w", err)
+	}
+	logger.FromContext(ctx).WithField("file_id", data.FileID).
+		Infoln("original file successfully downloaded from the S3 s3")
+
+	source, err := converter.Decode(ctx, sourceFile, data.SourceFormat)
+	sourceFile.Close()
+	if err != nil {
+		return &permanentError{fmt.Errorf("converter error: %w", err)}
+	}
+	logger.FromContext(ctx).WithField("file_id", data.FileID).
+		Infoln("converter successfully decoded the original file")
+
+	err = p.requestsRepo.UpdateRequest(ctx, data.RequestID, repository.RequestStatusProcessing, "")
+	if err != nil {
+		return fmt.Errorf("can't update request with id %s: %w", data.RequestID, err)
+	}
+	logger.FromContext(ctx).WithField("request_id", data.RequestID).
+		Infoln("request updated to the status \"processing\"")
+
+	var imageIDs []string
+	defer func() {
+		if err != nil && len(imageIDs) > 0 {
+			p.discard(ctx, data.RequestID, imageIDs)
+		}
+	}()
+
+	// The converted image may be reused by the requests of other users, so it's named after the shared source
+	// image instead of the filename of the user.
+	targetFileID, err := p.imagesRepo.InsertImage(ctx, data.FileID, data.TargetFormat)
+	if err != nil {
+		return fmt.Errorf("repository error: %w", err)
+	}
+	imageIDs = append(imageIDs, targetFileID)
+	logger.FromContext(ctx).WithField("file_id", targetFileID).
+		Infoln("converted file successfully saved in the database")
+
+	err = p.upload(ctx, source, data.TargetFormat, data.Ratio, data.Options, targetFileID)
+	if err != nil {
+		return err
+	}
+	logger.FromContext(ctx).WithField("file_id", targetFileID).
+		Infoln("converted file successfully uploaded to the S3 s3")
+
+	for _, rendition := range data.Renditions {
+		renditionFileID, err := p.imagesRepo.InsertImage(ctx, data.FileID+"_"+rendition.Name, rendition.Format)
+		if err != nil {
+			return fmt.Errorf("rendition %s: repository error: %w", rendition.Name, err)
+		}
+		imageIDs = append(imageIDs, renditionFileID)
+
+		err = p.processRendition(ctx, data, source, rendition, renditionFileID)
+		if err != nil {
+			return fmt.Errorf("rendition %s: %w", rendition.Name, err)
+		}
+	}
+
+	err = p.requestsRepo.UpdateRequest(ctx, data.RequestID, repository.RequestStatusDone, targetFileID)
+	if err != nil {
+		return fmt.Errorf("request updating error: %w", err)
+	}
+	logger.FromContext(ctx).WithField("request_id", data.RequestID).
+		Infoln("request updated to the status \"done\"")
+
+	p.notify(ctx, data.RequestID, repository.RequestStatusDone, targetFileID)
+
+	return nil
+}
+
+// notify delivers the final request status to the request webhooks in the background,
+// so that slow receivers do not delay the message acknowledgement.
+// The delivery outlives the processing context, Listen waits for it on shutdown.
+func (p *processor) notify(_ context.Context, requestID, status, targetID string) {
+	if p.notifier == nil {
+		return
+	}
+
+	p.pending.Add(1)
+	go func() {
+		defer p.pending.Done()
+		p.notifier.Notify(context.Background(), requestID, status, targetID)
+	}()
+}
+
+// discard marks deleted the converted images of the failed processing, their files are removed by the sweeper.
+// The processing context may be already canceled by the timeout, so the images are discarded without it.
+func (p *processor) discard(ctx context.Context, requestID string, imageIDs []string) {
+	err := p.imagesRepo.DiscardImages(context.Background(), requestID, imageIDs)
+	if err != nil {
+		logger.FromContext(ctx).WithField("request_id", requestID).
+			Errorln(fmt.Errorf("can't discard converted images: %w", err))
+		return
+	}
+	logger.FromContext(ctx).WithField("request_id", requestID).WithField("count", len(imageIDs)).
+		Infoln("converted images of the failed processing discarded")
+}
+
+// processRendition produces the rendition from the decoded source and links it with the request.
+func (p *processor) processRendition(ctx context.Context, data queueMessage, source *converter.Source, rendition converter.Rendition, renditionFileID string) error {
+	err := p.upload(ctx, source, rendition.Format, rendition.Ratio, rendition.Options(data.Options), renditionFileID)
+	if err != nil {
+		return err
+	}
+
+	err = p.requestsRepo.UpdateRendition(ctx, data.RequestID, rendition.Name, renditionFileID)
+	if err != nil {
+		return fmt.Errorf("can't update rendition: %w", err)
+	}
+	logger.FromContext(ctx).WithField("file_id", renditionFileID).WithField("rendition", rendition.Name).
+		Infoln("rendition successfully uploaded to the S3 s3")
+
+	return nil
+}
+
+// upload encodes the image straight into the storage, so that the encoded file is never held in memory.
+// The encoder writes to the pipe which is read by the storage upload, the upload errors are retryable,
+// while the encoder errors are permanent unless they are caused by the closed pipe.
+func (p *processor) upload(ctx context.Context, source *converter.Source, targetFormat string, ratio int, opts converter.Options, fileID string) error {
+	pr, pw := io.Pipe()
+	tw := &trackingWriter{w: pw}
+
+	encoded := make(chan error, 1)
+	go func() {
+		err := converter.EncodeTo(ctx, tw, source, targetFormat, ratio, opts)
+		pw.CloseWithError(err)
+		encoded <- err
+	}()
+
+	uploadErr := p.s3.UploadFile(pr, fileID)
+	pr.CloseWithError(io.ErrClosedPipe)
+	encodeErr := <-encoded
+
+	if encodeErr != nil && tw.err == nil {
+		return &permanentError{fmt.Errorf("converter error: %w", encodeErr)}
+	}
+	if uploadErr != nil {
+		return fmt.Errorf("s3 error: %w", uploadErr)
+	}
+	if encodeErr != nil {
+		return fmt.Errorf("s3 error: %w", encodeErr)
+	}
+
+	return nil
+}
+
+// trackingWriter remembers the write error to tell the failed encoder from the failed upload.
+type trackingWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (w *trackingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	if err != nil && w.err == nil {
+		w.err = err
+	}
+	return n, err
+}
+
+// permanentError represents the processing error that can't be fixed by retrying, e.g. the corrupted image.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// isRetryable reports whether the message processing failed with the transient error, e.g. the storage timeout.
+func isRetryable(err error) bool {
+	var pErr *permanentError
+	return !errors.As(err, &pErr)
+}
@@ -5,7 +5,7 @@ import (
 	"fmt"
 
 	"github.com/Konstantsiy/image-converter/internal/config"
-	"github.com/streadway/amqp"
+	"github.com/Konstantsiy/image-converter/internal/converter"
 )
 
 // MIMEContentType represents the content type of publishing message.
@@ -18,7 +18,7 @@ type RabbitMQProducer struct {
 
 // NewRabbitMQProducer creates new RabbitMQ producer.
 func NewRabbitMQProducer(conf *config.RabbitMQConfig) (*RabbitMQProducer, error) {
-	client, err := initRabbitMQClient(conf)
+	client, err := initRabbitMQClient(conf, true)
 	if err != nil {
 		return nil, err
 	}
@@ -26,8 +26,9 @@ func NewRabbitMQProducer(conf *config.RabbitMQConfig) (*RabbitMQProducer, error)
 	return &RabbitMQProducer{client: client}, nil
 }
 
-// SendToQueue sends messages to the queue.
-func (p *RabbitMQProducer) SendToQueue(fileID, filename, sourceFormat, targetFormat, requestID string, ratio int) error {
+// SendToQueue sends messages with the priority of the request to the queue and waits for the publisher confirmation,
+// ErrDisconnected is returned while the connection is being restored.
+func (p *RabbitMQProducer) SendToQueue(fileID, filename, sourceFormat, targetFormat, requestID string, ratio, priority int, opts converter.Options, renditions []converter.Rendition) error {
 	msg := queueMessage{
 		FileID:       fileID,
 		Filename:     filename,
@@ -35,6 +36,9 @@ func (p *RabbitMQProducer) SendToQueue(fileID, filename, sourceFormat, targetFor
 		TargetFormat: targetFormat,
 		RequestID:    requestID,
 		Ratio:        ratio,
+		Priority:     priority,
+		Options:      opts,
+		Renditions:   renditions,
 	}
 
 	body, err := json.Marshal(msg)
@@ -42,12 +46,7 @@ func (p *RabbitMQProducer) SendToQueue(fileID, filename, sourceFormat, targetFor
 		return fmt.Errorf("can't marshal queue message: %w", err)
 	}
 
-	err = p.client.ch.Publish("", p.client.queue.Name, false, false,
-		amqp.Publishing{
-			DeliveryMode: amqp.Persistent,
-			ContentType:  MIMEContentType,
-			Body:         body,
-		})
+	err = p.client.publishConfirmed("", p.client.queue, body, nil, uint8(priority))
 	if err != nil {
 		return fmt.Errorf("can't publish queue message: %w", err)
 	}
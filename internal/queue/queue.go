@@ -1,11 +1,28 @@
 package queue
 
+import (
+	"context"
+
+	"github.com/Konstantsiy/image-converter/internal/converter"
+)
+
+const (
+	// BackendRabbitMQ selects the RabbitMQ queue.
+	BackendRabbitMQ = "rabbitmq"
+
+	// BackendPostgres selects the queue of the jobs stored in postgres.
+	BackendPostgres = "postgres"
+
+	// BackendMemory selects the in-memory queue, the API server runs the workers then.
+	BackendMemory = "memory"
+)
+
 // Producer represents queue producer.
 type Producer interface {
-	SendToQueue(fileID, filename, sourceFormat, targetFormat, requestID string, ratio int) error
+	SendToQueue(fileID, filename, sourceFormat, targetFormat, requestID string, ratio, priority int, opts converter.Options, renditions []converter.Rendition) error
 }
 
 // Consumer represents queue consumer.
 type Consumer interface {
-	Listen() error
+	Listen(ctx context.Context) error
 }
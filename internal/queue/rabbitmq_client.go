@@ -1,12 +1,26 @@
 package queue
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/Konstantsiy/image-converter/internal/config"
+	"github.com/Konstantsiy/image-converter/internal/converter"
+	"github.com/Konstantsiy/image-converter/internal/repository"
+	"github.com/Konstantsiy/image-converter/pkg/logger"
 	"github.com/streadway/amqp"
 )
 
+const (
+	// retryCountHeader contains the number of retries made for the message.
+	retryCountHeader = "x-retry-count"
+	// lastErrorHeader contains the error of the last processing attempt of the dead-lettered message.
+	lastErrorHeader = "x-last-error"
+)
+
 // queueMessage represents a message that is passed to the queue.
 type queueMessage struct {
 	FileID       string
@@ -15,35 +29,477 @@ type queueMessage struct {
 	TargetFormat string
 	RequestID    string
 	Ratio        int
+	Priority     int
+	Options      converter.Options
+	Renditions   []converter.Rendition
 }
 
+// ErrDisconnected notifies that the connection to RabbitMQ is lost and the client is reconnecting.
+var ErrDisconnected = errors.New("RabbitMQ connection is lost, reconnecting")
+
+// errClientClosed notifies that the client has been closed.
+var errClientClosed = errors.New("RabbitMQ client is closed")
+
+// maxReconnectDelay limits the delay between the reconnection attempts.
+const maxReconnectDelay = 30 * time.Second
+
+// queueVersion is the version of the queue topology, it's a part of the queue names.
+// RabbitMQ refuses to redeclare a queue with other arguments, so the version is increased
+// whenever they change and the messages of the previous version are moved by MigrateQueue.
+const queueVersion = 2
+
 // rabbitMQClient provides connection to the queue via a specific channel.
+// The client watches the connection and restores it together with the queue topology when it's lost.
 type rabbitMQClient struct {
-	conn  *amqp.Connection
-	ch    *amqp.Channel
-	queue *amqp.Queue
+	conf *config.RabbitMQConfig
+	// queue is the versioned name of the work queue, the names of the retry and dead-letter queues are derived from it.
+	queue string
+	// confirm puts the channel into the confirm mode, see publishConfirmed.
+	confirm bool
+
+	mu      sync.RWMutex
+	session *session
+	// ready is closed while the client is connected.
+	ready chan struct{}
+	// done is closed when the client is closed.
+	done chan struct{}
+
+	// confirmMu serializes the confirmed publishing to match the confirmations with the messages.
+	confirmMu sync.Mutex
+}
+
+// session represents the connection with the channel opened on it.
+type session struct {
+	conn *amqp.Connection
+	ch   *amqp.Channel
+	// confirms receives the publisher confirms of the channel in the confirm mode.
+	confirms <-chan amqp.Confirmation
+	// published counts the messages published on the channel, it's the delivery tag of the last message.
+	published uint64
 }
 
-// initRabbitMQClient initializes the queue client.
-func initRabbitMQClient(conf *config.RabbitMQConfig) (*rabbitMQClient, error) {
+// initRabbitMQClient connects to RabbitMQ and starts watching the connection.
+// The first connection isn't retried, so that the misconfiguration is reported at once.
+func initRabbitMQClient(conf *config.RabbitMQConfig, confirm bool) (*rabbitMQClient, error) {
 	if conf.AMQPConnectionURL == "" || conf.QueueName == "" {
 		return nil, fmt.Errorf("RabbitMQ configurations should not be empty")
 	}
 
-	conn, err := amqp.Dial(conf.AMQPConnectionURL)
+	c := &rabbitMQClient{
+		conf:    conf,
+		queue:   workQueue(conf.QueueName),
+		confirm: confirm,
+		ready:   make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	s, err := c.connect()
+	if err != nil {
+		return nil, err
+	}
+	c.setSession(s)
+	go c.watch(s)
+
+	return c, nil
+}
+
+// connect dials RabbitMQ, opens the channel and declares the queue topology.
+func (c *rabbitMQClient) connect() (*session, error) {
+	conn, err := amqp.Dial(c.conf.AMQPConnectionURL)
 	if err != nil {
 		return nil, fmt.Errorf("can't connect to AMQP: %w", err)
 	}
 
 	ch, err := conn.Channel()
 	if err != nil {
+		conn.Close()
 		return nil, fmt.Errorf("can't create an AMQP channel: %w", err)
 	}
 
-	queue, err := ch.QueueDeclare(conf.QueueName, true, false, false, false, nil)
+	err = declareTopology(ch, c.queue, c.conf)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	s := &session{conn: conn, ch: ch}
+	if c.confirm {
+		if err = ch.Confirm(false); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("can't put the channel into confirm mode: %w", err)
+		}
+		s.confirms = ch.NotifyPublish(make(chan amqp.Confirmation, 1))
+	}
+
+	return s, nil
+}
+
+// declareTopology declares the work queue, one delay queue per retry that returns the expired messages
+// to the work queue, and the dead-letter exchange with the queue for the messages that can't be processed.
+func declareTopology(ch *amqp.Channel, queue string, conf *config.RabbitMQConfig) error {
+	err := ch.ExchangeDeclare(deadLetterExchange(queue), amqp.ExchangeFanout, true, false, false, false, nil)
+	if err != nil {
+		return fmt.Errorf("can't declare %s exchange: %w", deadLetterExchange(queue), err)
+	}
+
+	_, err = ch.QueueDeclare(deadLetterQueue(queue), true, false, false, false, nil)
+	if err != nil {
+		return fmt.Errorf("can't declare %s queue: %w", deadLetterQueue(queue), err)
+	}
+
+	err = ch.QueueBind(deadLetterQueue(queue), "", deadLetterExchange(queue), false, nil)
+	if err != nil {
+		return fmt.Errorf("can't bind %s queue: %w", deadLetterQueue(queue), err)
+	}
+
+	for retry := 1; retry <= conf.MaxRetries; retry++ {
+		_, err = ch.QueueDeclare(retryQueue(queue, retry), true, false, false, false, amqp.Table{
+			"x-message-ttl":             retryDelay(conf.RetryDelay, retry).Milliseconds(),
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": queue,
+		})
+		if err != nil {
+			return fmt.Errorf("can't declare %s queue: %w", retryQueue(queue, retry), err)
+		}
+	}
+
+	_, err = ch.QueueDeclare(queue, true, false, false, false, amqp.Table{
+		"x-dead-letter-exchange": deadLetterExchange(queue),
+		"x-max-priority":         int32(repository.MaxPriority),
+	})
 	if err != nil {
-		return nil, fmt.Errorf("can't declare %s queue", conf.QueueName)
+		return fmt.Errorf("can't declare %s queue: %w", queue, err)
 	}
 
-	return &rabbitMQClient{conn: conn, ch: ch, queue: &queue}, nil
+	return nil
+}
+
+// setSession makes the session current and wakes up the goroutines waiting for it.
+func (c *rabbitMQClient) setSession(s *session) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.session = s
+	close(c.ready)
+}
+
+// resetSession marks the client disconnected.
+func (c *rabbitMQClient) resetSession() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.session = nil
+	c.ready = make(chan struct{})
+}
+
+// watch waits until the connection or the channel is closed and reconnects until the client is closed.
+func (c *rabbitMQClient) watch(s *session) {
+	for {
+		connClosed := s.conn.NotifyClose(make(chan *amqp.Error, 1))
+		chClosed := s.ch.NotifyClose(make(chan *amqp.Error, 1))
+
+		var reason *amqp.Error
+		select {
+		case reason = <-connClosed:
+		case reason = <-chClosed:
+		case <-c.done:
+			return
+		}
+
+		c.resetSession()
+		// the channel may be closed by the broker alone, the connection is restored anyway
+		s.conn.Close()
+
+		select {
+		case <-c.done:
+			return
+		default:
+		}
+		logger.FromContext(context.Background()).Errorln(fmt.Errorf("RabbitMQ connection is lost: %v", reason))
+
+		s = c.reconnect()
+		if s == nil {
+			return
+		}
+		c.setSession(s)
+	}
+}
+
+// reconnect makes connection attempts with the growing delay, it returns nil session if the client is closed.
+func (c *rabbitMQClient) reconnect() *session {
+	for attempt := 1; ; attempt++ {
+		delay := reconnectDelay(c.conf.ReconnectDelay, attempt)
+		select {
+		case <-c.done:
+			return nil
+		case <-time.After(delay):
+		}
+
+		s, err := c.connect()
+		if err != nil {
+			logger.FromContext(context.Background()).WithField("attempt", attempt).
+				Errorln(fmt.Errorf("can't reconnect to RabbitMQ: %w", err))
+			continue
+		}
+		logger.FromContext(context.Background()).WithField("attempt", attempt).Infoln("reconnected to RabbitMQ")
+
+		return s
+	}
+}
+
+// current returns the current session, ErrDisconnected is returned while the client is reconnecting.
+func (c *rabbitMQClient) current() (*session, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	select {
+	case <-c.done:
+		return nil, errClientClosed
+	default:
+	}
+
+	if c.session == nil {
+		return nil, ErrDisconnected
+	}
+
+	return c.session, nil
+}
+
+// channel returns the channel of the current session.
+func (c *rabbitMQClient) channel() (*amqp.Channel, error) {
+	s, err := c.current()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.ch, nil
+}
+
+// connected returns the channel that is closed once the client is connected.
+func (c *rabbitMQClient) connected() <-chan struct{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.ready
+}
+
+// publish publishes the persistent JSON message, it fails fast while the client is reconnecting.
+func (c *rabbitMQClient) publish(exchange, key string, body []byte, headers amqp.Table, priority uint8) error {
+	ch, err := c.channel()
+	if err != nil {
+		return err
+	}
+
+	return ch.Publish(exchange, key, false, false, persistentMessage(body, headers, priority))
+}
+
+// publishConfirmed publishes the message and waits until the broker confirms that the message is stored.
+// The late confirmations of the messages timed out before are skipped.
+func (c *rabbitMQClient) publishConfirmed(exchange, key string, body []byte, headers amqp.Table, priority uint8) error {
+	c.confirmMu.Lock()
+	defer c.confirmMu.Unlock()
+
+	s, err := c.current()
+	if err != nil {
+		return err
+	}
+	if s.confirms == nil {
+		return fmt.Errorf("the channel isn't in confirm mode")
+	}
+
+	err = s.ch.Publish(exchange, key, false, false, persistentMessage(body, headers, priority))
+	if err != nil {
+		return err
+	}
+	s.published++
+
+	timeout := time.After(c.conf.ConfirmTimeout)
+	for {
+		select {
+		case confirm, ok := <-s.confirms:
+			if !ok {
+				return ErrDisconnected
+			}
+			if confirm.DeliveryTag < s.published {
+				continue
+			}
+			if !confirm.Ack {
+				return fmt.Errorf("message is rejected by the broker")
+			}
+			return nil
+		case <-timeout:
+			return fmt.Errorf("message isn't confirmed within %s", c.conf.ConfirmTimeout)
+		}
+	}
+}
+
+// persistentMessage builds the persistent JSON message, the queue delivers the messages of higher priority first.
+func persistentMessage(body []byte, headers amqp.Table, priority uint8) amqp.Publishing {
+	return amqp.Publishing{
+		Headers:      headers,
+		DeliveryMode: amqp.Persistent,
+		Priority:     priority,
+		ContentType:  MIMEContentType,
+		Timestamp:    time.Now(),
+		Body:         body,
+	}
+}
+
+// consume registers the consumer of the work queue and registers it again after every reconnection.
+// The returned channel receives the deliveries of all connections, it's closed when the context is canceled
+// or the client is closed. The deliveries of the lost connection can't be acknowledged, the broker redelivers them.
+func (c *rabbitMQClient) consume(ctx context.Context, tag string, prefetch int) <-chan amqp.Delivery {
+	out := make(chan amqp.Delivery)
+
+	go func() {
+		defer close(out)
+
+		for {
+			deliveries, err := c.register(tag, prefetch)
+			if err != nil {
+				var wait <-chan time.Time
+				var reconnected <-chan struct{}
+				if errors.Is(err, ErrDisconnected) {
+					reconnected = c.connected()
+				} else {
+					logger.FromContext(ctx).Errorln(err)
+					wait = time.After(reconnectDelay(c.conf.ReconnectDelay, 1))
+				}
+
+				select {
+				case <-ctx.Done():
+					return
+				case <-c.done:
+					return
+				case <-reconnected:
+				case <-wait:
+				}
+				continue
+			}
+
+			for d := range deliveries {
+				select {
+				case out <- d:
+				case <-ctx.Done():
+					_ = d.Nack(false, true)
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-c.done:
+				return
+			default:
+			}
+			logger.FromContext(ctx).Infoln("delivery channel closed, registering the consumer again")
+		}
+	}()
+
+	return out
+}
+
+// register configures the prefetch count and starts consuming the work queue on the current channel.
+func (c *rabbitMQClient) register(tag string, prefetch int) (<-chan amqp.Delivery, error) {
+	ch, err := c.channel()
+	if err != nil {
+		return nil, err
+	}
+
+	err = ch.Qos(prefetch, 0, false)
+	if err != nil {
+		return nil, fmt.Errorf("can't configure QoS: %w", err)
+	}
+
+	deliveries, err := ch.Consume(c.queue, tag, false, false, false, false, nil)
+	if err != nil {
+		return nil, fmt.Errorf("can't register channel: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+// cancel stops the consumer, the deliveries channel is closed after the sent messages are delivered.
+func (c *rabbitMQClient) cancel(tag string) error {
+	ch, err := c.channel()
+	if err != nil {
+		return err
+	}
+
+	return ch.Cancel(tag, false)
+}
+
+// close stops the reconnection and closes the connection.
+func (c *rabbitMQClient) close() error {
+	c.mu.Lock()
+	select {
+	case <-c.done:
+		c.mu.Unlock()
+		return nil
+	default:
+	}
+	close(c.done)
+	s := c.session
+	c.mu.Unlock()
+
+	if s == nil {
+		return nil
+	}
+
+	return s.conn.Close()
+}
+
+// workQueue returns the versioned name of the work queue.
+func workQueue(queueName string) string {
+	return fmt.Sprintf("%s.v%d", queueName, queueVersion)
+}
+
+// deadLetterExchange returns the name of the exchange the exhausted messages of the queue are sent to.
+func deadLetterExchange(queueName string) string {
+	return queueName + ".dlx"
+}
+
+// deadLetterQueue returns the name of the queue keeping the exhausted messages of the queue.
+func deadLetterQueue(queueName string) string {
+	return queueName + ".dead"
+}
+
+// retryQueue returns the name of the delay queue of the retry.
+func retryQueue(queueName string, retry int) string {
+	return fmt.Sprintf("%s.retry.%d", queueName, retry)
+}
+
+// retryDelay returns the delay before the retry, it doubles with every retry.
+func retryDelay(base time.Duration, retry int) time.Duration {
+	return base << uint(retry-1)
+}
+
+// reconnectDelay returns the delay before the reconnection attempt, it doubles with every attempt up to the limit.
+func reconnectDelay(base time.Duration, attempt int) time.Duration {
+	if base <= 0 {
+		base = time.Second
+	}
+
+	delay := base
+	for i := 1; i < attempt && delay < maxReconnectDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxReconnectDelay {
+		delay = maxReconnectDelay
+	}
+
+	return delay
+}
+
+// retryCount returns the number of retries made for the message.
+func retryCount(headers amqp.Table) int {
+	switch v := headers[retryCountHeader].(type) {
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case int:
+		return v
+	}
+	return 0
 }
@@ -0,0 +1,115 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Konstantsiy/image-converter/internal/config"
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryDelay(t *testing.T) {
+	testTable := []struct {
+		retry    int
+		expected time.Duration
+	}{
+		{retry: 1, expected: 5 * time.Second},
+		{retry: 2, expected: 10 * time.Second},
+		{retry: 3, expected: 20 * time.Second},
+	}
+
+	for _, tc := range testTable {
+		assert.Equal(t, tc.expected, retryDelay(5*time.Second, tc.retry))
+		assert.Equal(t, fmt.Sprintf("converter.retry.%d", tc.retry), retryQueue("converter", tc.retry))
+	}
+}
+
+func TestWorkQueue(t *testing.T) {
+	queue := workQueue("converter")
+	assert.Equal(t, "converter.v2", queue)
+	assert.Equal(t, "converter.v2.dlx", deadLetterExchange(queue))
+	assert.Equal(t, "converter.v2.dead", deadLetterQueue(queue))
+	assert.Equal(t, "converter.v2.retry.1", retryQueue(queue, 1))
+}
+
+func TestReconnectDelay(t *testing.T) {
+	testTable := []struct {
+		base     time.Duration
+		attempt  int
+		expected time.Duration
+	}{
+		{base: time.Second, attempt: 1, expected: time.Second},
+		{base: time.Second, attempt: 4, expected: 8 * time.Second},
+		{base: time.Second, attempt: 10, expected: maxReconnectDelay},
+		{base: 0, attempt: 1, expected: time.Second},
+	}
+
+	for _, tc := range testTable {
+		assert.Equal(t, tc.expected, reconnectDelay(tc.base, tc.attempt))
+	}
+}
+
+func TestRabbitMQClient_Disconnected(t *testing.T) {
+	c := &rabbitMQClient{
+		conf:  &config.RabbitMQConfig{QueueName: "converter"},
+		ready: make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+
+	err := c.publish("", "converter", []byte("{}"), nil, 0)
+	assert.True(t, errors.Is(err, ErrDisconnected))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	deliveries := c.consume(ctx, consumerTag, 1)
+	cancel()
+	select {
+	case _, ok := <-deliveries:
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("deliveries channel is not closed after the context cancellation")
+	}
+
+	assert.NoError(t, c.close())
+	_, err = c.channel()
+	assert.Equal(t, errClientClosed, err)
+}
+
+func TestRetryCount(t *testing.T) {
+	testTable := []struct {
+		name     string
+		headers  amqp.Table
+		expected int
+	}{
+		{name: "No headers", headers: nil, expected: 0},
+		{name: "Int32", headers: amqp.Table{retryCountHeader: int32(2)}, expected: 2},
+		{name: "Int64", headers: amqp.Table{retryCountHeader: int64(3)}, expected: 3},
+		{name: "Invalid type", headers: amqp.Table{retryCountHeader: "3"}, expected: 0},
+	}
+
+	for _, tc := range testTable {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, retryCount(tc.headers))
+		})
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	permanent := &permanentError{fmt.Errorf("converter error: unexpected EOF")}
+
+	assert.True(t, isRetryable(fmt.Errorf("s3 error: timeout")))
+	assert.False(t, isRetryable(permanent))
+	assert.False(t, isRetryable(fmt.Errorf("rendition small: %w", permanent)))
+}
+
+func TestIsRequeued(t *testing.T) {
+	requeue := &requeueError{fmt.Errorf("can't publish to the dead-letter exchange: %w", ErrDisconnected)}
+
+	assert.True(t, isRequeued(requeue))
+	assert.True(t, isRequeued(fmt.Errorf("message handling: %w", requeue)))
+	assert.False(t, isRequeued(fmt.Errorf("can't decode queue message: unexpected EOF")))
+	assert.False(t, isRequeued(&permanentError{fmt.Errorf("converter error: unexpected EOF")}))
+}
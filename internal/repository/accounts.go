@@ -0,0 +1,163 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrNoSuchAccountJob notifies that the needed account job does not exist.
+	ErrNoSuchAccountJob = errors.New("account job with this id does not exist")
+
+	// ErrNoAccountJobs notifies that there are no account jobs available for processing.
+	ErrNoAccountJobs = errors.New("no account jobs available")
+)
+
+const (
+	// AccountJobDelete represents the job deleting the user with all the data.
+	AccountJobDelete = "delete"
+
+	// AccountJobExport represents the job exporting the user's data to the ZIP archive.
+	AccountJobExport = "export"
+)
+
+// AccountJob represents the background job deleting or exporting the user's account.
+// FileID is the id of the exported archive in the storage, DownloadURL is set by the service for the done export.
+type AccountJob struct {
+	ID          string    `json:"id"`
+	UserID      string    `json:"user_id"`
+	Kind        string    `json:"kind"`
+	Status      string    `json:"status"`
+	FileID      string    `json:"-"`
+	DownloadURL string    `json:"download_url,omitempty"`
+	Attempts    int       `json:"-"`
+	LastError   string    `json:"last_error,omitempty"`
+	Created     time.Time `json:"created"`
+	Updated     time.Time `json:"updated"`
+}
+
+// accountJobColumns lists the columns scanned by scanAccountJob.
+const accountJobColumns = `id, user_id, kind, status, coalesce(file_id::text, ''), attempts, coalesce(last_error, ''),
+	created, updated`
+
+// AccountJobsRepository represents repository for working with the account jobs.
+type AccountJobsRepository struct {
+	db *sql.DB
+}
+
+// NewAccountJobsRepository creates new account jobs repository.
+func NewAccountJobsRepository(db *sql.DB) (*AccountJobsRepository, error) {
+	if db == nil {
+		return nil, ErrEmptySQLDriver
+	}
+	return &AccountJobsRepository{db: db}, nil
+}
+
+// InsertAccountJob queues the job of the given kind for the user.
+// If the user already has such a job waiting or in progress, it's returned instead of the new one.
+func (ar *AccountJobsRepository) InsertAccountJob(ctx context.Context, userID, kind string) (AccountJob, error) {
+	const query = `WITH active AS (
+			SELECT ` + accountJobColumns + ` FROM converter.account_jobs
+			WHERE user_id = $1 AND kind = $2 AND status IN ('queued', 'processing')
+			ORDER BY created
+			LIMIT 1
+		), inserted AS (
+			INSERT INTO converter.account_jobs (user_id, kind)
+			SELECT $1::uuid, $2::varchar WHERE NOT EXISTS (SELECT 1 FROM active)
+			RETURNING ` + accountJobColumns + `
+		)
+		SELECT * FROM active UNION ALL SELECT * FROM inserted;`
+
+	job, err := scanAccountJob(ar.db.QueryRowContext(ctx, query, userID, kind))
+	if err != nil {
+		return AccountJob{}, fmt.Errorf("can't insert account job: %w", err)
+	}
+
+	return job, nil
+}
+
+// GetAccountJob gets the user's account job by its id.
+func (ar *AccountJobsRepository) GetAccountJob(ctx context.Context, userID, jobID string) (AccountJob, error) {
+	const query = "SELECT " + accountJobColumns + " FROM converter.account_jobs WHERE id = $1 AND user_id = $2;"
+
+	job, err := scanAccountJob(ar.db.QueryRowContext(ctx, query, jobID, userID))
+	if err == sql.ErrNoRows {
+		return AccountJob{}, ErrNoSuchAccountJob
+	}
+	if err != nil {
+		return AccountJob{}, fmt.Errorf("can't get account job: %w", err)
+	}
+
+	return job, nil
+}
+
+// ClaimAccountJob leases the oldest available job to the runner. The job is available if it's queued
+// or its lease has expired, e.g. the runner died. The jobs locked by other runners at the moment are skipped.
+func (ar *AccountJobsRepository) ClaimAccountJob(ctx context.Context, lease time.Duration) (AccountJob, error) {
+	const query = `UPDATE converter.account_jobs SET status = 'processing',
+		locked_until = now() + $1 * interval '1 millisecond', attempts = attempts + 1, updated = default
+		WHERE id = (
+			SELECT id FROM converter.account_jobs
+			WHERE (status = 'queued' AND available_at <= now()) OR (status = 'processing' AND locked_until < now())
+			ORDER BY available_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED)
+		RETURNING ` + accountJobColumns + `;`
+
+	job, err := scanAccountJob(ar.db.QueryRowContext(ctx, query, lease.Milliseconds()))
+	if err == sql.ErrNoRows {
+		return AccountJob{}, ErrNoAccountJobs
+	}
+	if err != nil {
+		return AccountJob{}, fmt.Errorf("can't claim account job: %w", err)
+	}
+
+	return job, nil
+}
+
+// FinishAccountJob sets the final status of the job with the exported file id or the error.
+func (ar *AccountJobsRepository) FinishAccountJob(ctx context.Context, jobID, status, fileID, lastError string) error {
+	const query = `UPDATE converter.account_jobs SET status = $2, file_id = $3, last_error = $4,
+		locked_until = NULL, updated = default
+		WHERE id = $1;`
+
+	_, err := ar.db.ExecContext(ctx, query, jobID, status, nullString(fileID), nullString(lastError))
+	if err != nil {
+		return fmt.Errorf("can't finish account job: %w", err)
+	}
+
+	return nil
+}
+
+// RetryAccountJob returns the job to the queue, the job becomes available after the delay.
+func (ar *AccountJobsRepository) RetryAccountJob(ctx context.Context, jobID string, delay time.Duration, lastError string) error {
+	const query = `UPDATE converter.account_jobs SET status = 'queued', locked_until = NULL,
+		available_at = now() + $2 * interval '1 millisecond', last_error = $3, updated = default
+		WHERE id = $1;`
+
+	_, err := ar.db.ExecContext(ctx, query, jobID, delay.Milliseconds(), nullString(lastError))
+	if err != nil {
+		return fmt.Errorf("can't retry account job: %w", err)
+	}
+
+	return nil
+}
+
+// scanAccountJob scans the account job selected with accountJobColumns.
+func scanAccountJob(row rowScanner) (AccountJob, error) {
+	var job AccountJob
+	err := row.Scan(
+		&job.ID,
+		&job.UserID,
+		&job.Kind,
+		&job.Status,
+		&job.FileID,
+		&job.Attempts,
+		&job.LastError,
+		&job.Created,
+		&job.Updated)
+	return job, err
+}
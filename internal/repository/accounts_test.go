@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var accountJobRows = []string{"id", "user_id", "kind", "status", "file_id", "attempts", "last_error", "created", "updated"}
+
+func TestAccountJobsRepository_InsertAccountJob(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%v' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	accountsRepo, err := NewAccountJobsRepository(db)
+	require.NoError(t, err)
+
+	const query = `WITH active AS (.+) INSERT INTO converter.account_jobs (.+) SELECT \* FROM active UNION ALL SELECT \* FROM inserted`
+	created := time.Date(2021, 8, 1, 0, 0, 0, 0, time.UTC)
+
+	testTable := []struct {
+		name            string
+		mockBehavior    func()
+		expectedJob     AccountJob
+		isErrorExpected bool
+	}{
+		{
+			name: "Ok",
+			mockBehavior: func() {
+				mock.ExpectQuery(query).WithArgs("2", AccountJobExport).
+					WillReturnRows(sqlmock.NewRows(accountJobRows).
+						AddRow("1", "2", AccountJobExport, RequestStatusQueued, "", 0, "", created, created))
+			},
+			expectedJob: AccountJob{ID: "1", UserID: "2", Kind: AccountJobExport, Status: RequestStatusQueued,
+				Created: created, Updated: created},
+		},
+		{
+			name: "Database error",
+			mockBehavior: func() {
+				mock.ExpectQuery(query).WithArgs("2", AccountJobExport).WillReturnError(fmt.Errorf("some error"))
+			},
+			isErrorExpected: true,
+		},
+	}
+
+	for _, tc := range testTable {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.mockBehavior()
+			job, err := accountsRepo.InsertAccountJob(context.TODO(), "2", AccountJobExport)
+			if tc.isErrorExpected {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedJob, job)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestAccountJobsRepository_ClaimAccountJob(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%v' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	accountsRepo, err := NewAccountJobsRepository(db)
+	require.NoError(t, err)
+
+	const query = `UPDATE converter.account_jobs SET status = 'processing'(.+) FOR UPDATE SKIP LOCKED(.+) RETURNING`
+	created := time.Date(2021, 8, 1, 0, 0, 0, 0, time.UTC)
+
+	testTable := []struct {
+		name            string
+		mockBehavior    func()
+		expectedJob     AccountJob
+		expectedError   error
+		isErrorExpected bool
+	}{
+		{
+			name: "Ok",
+			mockBehavior: func() {
+				mock.ExpectQuery(query).WithArgs(int64(600000)).
+					WillReturnRows(sqlmock.NewRows(accountJobRows).
+						AddRow("1", "2", AccountJobDelete, RequestStatusProcessing, "", 2, "request is still processing",
+							created, created))
+			},
+			expectedJob: AccountJob{ID: "1", UserID: "2", Kind: AccountJobDelete, Status: RequestStatusProcessing,
+				Attempts: 2, LastError: "request is still processing", Created: created, Updated: created},
+		},
+		{
+			name: "No jobs",
+			mockBehavior: func() {
+				mock.ExpectQuery(query).WillReturnError(sql.ErrNoRows)
+			},
+			expectedError:   ErrNoAccountJobs,
+			isErrorExpected: true,
+		},
+	}
+
+	for _, tc := range testTable {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.mockBehavior()
+			job, err := accountsRepo.ClaimAccountJob(context.TODO(), 10*time.Minute)
+			if tc.isErrorExpected {
+				assert.Error(t, err)
+				if tc.expectedError != nil {
+					assert.Equal(t, tc.expectedError, err)
+				}
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedJob, job)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
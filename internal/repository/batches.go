@@ -0,0 +1,165 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrNoSuchBatch notifies that needed batch does not exist.
+	ErrNoSuchBatch = errors.New("batch with this id does not exist")
+
+	// ErrEmptyBatch notifies that the batch has no requests.
+	ErrEmptyBatch = errors.New("batch has no requests")
+)
+
+// Batch represents the group of conversion requests created at once.
+// The status is derived from the statuses of the requests.
+type Batch struct {
+	ID       string         `json:"id"`
+	UserID   string         `json:"user_id"`
+	Status   string         `json:"status"`
+	Total    int            `json:"total"`
+	Done     int            `json:"done"`
+	Failed   int            `json:"failed"`
+	Created  time.Time      `json:"created"`
+	Requests []BatchRequest `json:"requests"`
+}
+
+// BatchRequest represents the conversion request of the batch.
+type BatchRequest struct {
+	ID           string `json:"id"`
+	Filename     string `json:"filename"`
+	TargetID     string `json:"target_id"`
+	TargetFormat string `json:"target_format"`
+	Status       string `json:"status"`
+}
+
+// BatchesRepository represents repository for working with batches.
+type BatchesRepository struct {
+	db *sql.DB
+}
+
+// NewBatchesRepository creates new batches repository.
+func NewBatchesRepository(db *sql.DB) (*BatchesRepository, error) {
+	if db == nil {
+		return nil, ErrEmptySQLDriver
+	}
+	return &BatchesRepository{db: db}, nil
+}
+
+// InsertBatch creates the batch with its conversion requests, their renditions and outbox entries
+// in one transaction, so that either the whole batch is queued or nothing. The ids of the batch and
+// of the requests in the given order are returned.
+func (br *BatchesRepository) InsertBatch(ctx context.Context, userID string, requests []QueuedRequest) (string, []string, error) {
+	if len(requests) == 0 {
+		return "", nil, ErrEmptyBatch
+	}
+
+	tx, err := br.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", nil, fmt.Errorf("can't begin transaction: %w", err)
+	}
+
+	var batchID string
+	const query = "INSERT INTO converter.batches (user_id) VALUES ($1) RETURNING id;"
+
+	err = tx.QueryRowContext(ctx, query, userID).Scan(&batchID)
+	if err != nil {
+		_ = tx.Rollback()
+		return "", nil, fmt.Errorf("can't insert batch: %w", err)
+	}
+
+	requestIDs := make([]string, 0, len(requests))
+	for _, r := range requests {
+		requestID, err := insertQueuedRequest(ctx, tx, userID, batchID, r)
+		if err != nil {
+			_ = tx.Rollback()
+			return "", nil, err
+		}
+		requestIDs = append(requestIDs, requestID)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return "", nil, fmt.Errorf("can't commit transaction: %w", err)
+	}
+
+	return batchID, requestIDs, nil
+}
+
+// GetBatch gets the user batch together with its requests.
+func (br *BatchesRepository) GetBatch(ctx context.Context, userID, batchID string) (Batch, error) {
+	batch := Batch{Requests: []BatchRequest{}}
+
+	const batchQuery = "SELECT id, user_id, created FROM converter.batches WHERE id = $1 AND user_id = $2;"
+	err := br.db.QueryRowContext(ctx, batchQuery, batchID, userID).Scan(&batch.ID, &batch.UserID, &batch.Created)
+	if err == sql.ErrNoRows {
+		return Batch{}, ErrNoSuchBatch
+	}
+	if err != nil {
+		return Batch{}, fmt.Errorf("can't get batch: %w", err)
+	}
+
+	const requestsQuery = `SELECT r.id, coalesce(r.filename, ''), coalesce(t.id::text, ''), r.target_format, r.status
+		FROM converter.requests r
+		LEFT JOIN converter.images t ON t.id = r.target_id AND t.deleted IS NULL
+		WHERE r.batch_id = $1
+		ORDER BY r.created, r.id;`
+
+	rows, err := br.db.QueryContext(ctx, requestsQuery, batchID)
+	if err != nil {
+		return Batch{}, fmt.Errorf("can't get batch requests: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var request BatchRequest
+		err = rows.Scan(&request.ID, &request.Filename, &request.TargetID, &request.TargetFormat, &request.Status)
+		if err != nil {
+			return Batch{}, fmt.Errorf("can't scan batch request from rows: %w", err)
+		}
+		batch.Requests = append(batch.Requests, request)
+	}
+
+	if err = rows.Err(); err != nil {
+		return Batch{}, fmt.Errorf("error selecting rows: %w", err)
+	}
+
+	batch.setStatus()
+
+	return batch, nil
+}
+
+// setStatus counts the requests by status and derives the batch status:
+// done when every request is done, failed when every request is finished and some of them failed
+// or the batch has no requests, queued when no request has been picked up yet and processing otherwise.
+func (b *Batch) setStatus() {
+	b.Total, b.Done, b.Failed = len(b.Requests), 0, 0
+	queued := 0
+	for _, r := range b.Requests {
+		switch r.Status {
+		case RequestStatusDone:
+			b.Done++
+		case RequestStatusFailed:
+			b.Failed++
+		case RequestStatusQueued:
+			queued++
+		}
+	}
+
+	switch {
+	case b.Total == 0:
+		b.Status = RequestStatusFailed
+	case b.Done == b.Total:
+		b.Status = RequestStatusDone
+	case b.Done+b.Failed == b.Total:
+		b.Status = RequestStatusFailed
+	case queued == b.Total:
+		b.Status = RequestStatusQueued
+	default:
+		b.Status = RequestStatusProcessing
+	}
+}
@@ -0,0 +1,220 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchesRepository_InsertBatch(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%v' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	batchesRepo, err := NewBatchesRepository(db)
+	require.NoError(t, err)
+
+	requests := []QueuedRequest{
+		{SourceID: "20", Filename: "cat", SourceFormat: "jpg", TargetFormat: "png", Ratio: 90, Priority: 1},
+		{SourceID: "21", Filename: "dog", SourceFormat: "png", TargetFormat: "png", Ratio: 90, Priority: 1},
+	}
+
+	expectRequest := func(sourceID, filename, sourceFormat, requestID string) {
+		mock.ExpectQuery("INSERT INTO converter.requests (.+)").
+			WithArgs("10", sourceID, filename, sourceFormat, "png", 90, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, 1, "1").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(requestID))
+		mock.ExpectExec("INSERT INTO converter.outbox (.+)").
+			WithArgs(requestID).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+
+	testTable := []struct {
+		name               string
+		requests           []QueuedRequest
+		mockBehavior       func()
+		expectedBatchID    string
+		expectedRequestIDs []string
+		expectedError      error
+		isErrorExpected    bool
+	}{
+		{
+			name:     "Ok",
+			requests: requests,
+			mockBehavior: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery("INSERT INTO converter.batches (.+) RETURNING id").WithArgs("10").
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("1"))
+				expectRequest("20", "cat", "jpg", "2")
+				expectRequest("21", "dog", "png", "3")
+				mock.ExpectCommit()
+			},
+			expectedBatchID:    "1",
+			expectedRequestIDs: []string{"2", "3"},
+		},
+		{
+			name:     "Request error",
+			requests: requests,
+			mockBehavior: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery("INSERT INTO converter.batches (.+) RETURNING id").WithArgs("10").
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("1"))
+				expectRequest("20", "cat", "jpg", "2")
+				mock.ExpectQuery("INSERT INTO converter.requests (.+)").
+					WillReturnError(fmt.Errorf("some error"))
+				mock.ExpectRollback()
+			},
+			isErrorExpected: true,
+		},
+		{
+			name:     "Database error",
+			requests: requests,
+			mockBehavior: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery("INSERT INTO converter.batches (.+) RETURNING id").WithArgs("10").
+					WillReturnError(fmt.Errorf("some error"))
+				mock.ExpectRollback()
+			},
+			isErrorExpected: true,
+		},
+		{
+			name:            "Empty batch",
+			mockBehavior:    func() {},
+			expectedError:   ErrEmptyBatch,
+			isErrorExpected: true,
+		},
+	}
+
+	for _, tc := range testTable {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.mockBehavior()
+			batchID, requestIDs, err := batchesRepo.InsertBatch(context.TODO(), "10", tc.requests)
+			if tc.isErrorExpected {
+				assert.Error(t, err)
+				if tc.expectedError != nil {
+					assert.Equal(t, tc.expectedError, err)
+				}
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedBatchID, batchID)
+				assert.Equal(t, tc.expectedRequestIDs, requestIDs)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestBatchesRepository_GetBatch(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%v' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	batchesRepo, err := NewBatchesRepository(db)
+	require.NoError(t, err)
+
+	const (
+		batchQuery    = "SELECT id, user_id, created FROM converter.batches (.+)"
+		requestsQuery = "SELECT (.+) FROM converter.requests r (.+)"
+	)
+	created := time.Date(2021, 11, 6, 21, 35, 7, 0, time.UTC)
+	requestColumns := []string{"id", "filename", "target_id", "target_format", "status"}
+
+	testTable := []struct {
+		name            string
+		mockBehavior    func()
+		expectedStatus  string
+		expectedTotal   int
+		expectedDone    int
+		expectedFailed  int
+		expectedError   error
+		isErrorExpected bool
+	}{
+		{
+			name: "Done",
+			mockBehavior: func() {
+				mock.ExpectQuery(batchQuery).WithArgs("1", "10").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "created"}).AddRow("1", "10", created))
+				mock.ExpectQuery(requestsQuery).WithArgs("1").
+					WillReturnRows(sqlmock.NewRows(requestColumns).
+						AddRow("2", "cat", "20", "png", RequestStatusDone).
+						AddRow("3", "dog", "30", "png", RequestStatusDone))
+			},
+			expectedStatus: RequestStatusDone,
+			expectedTotal:  2,
+			expectedDone:   2,
+		},
+		{
+			name: "Processing",
+			mockBehavior: func() {
+				mock.ExpectQuery(batchQuery).WithArgs("1", "10").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "created"}).AddRow("1", "10", created))
+				mock.ExpectQuery(requestsQuery).WithArgs("1").
+					WillReturnRows(sqlmock.NewRows(requestColumns).
+						AddRow("2", "cat", "20", "png", RequestStatusDone).
+						AddRow("3", "dog", "", "png", RequestStatusQueued))
+			},
+			expectedStatus: RequestStatusProcessing,
+			expectedTotal:  2,
+			expectedDone:   1,
+		},
+		{
+			name: "Failed",
+			mockBehavior: func() {
+				mock.ExpectQuery(batchQuery).WithArgs("1", "10").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "created"}).AddRow("1", "10", created))
+				mock.ExpectQuery(requestsQuery).WithArgs("1").
+					WillReturnRows(sqlmock.NewRows(requestColumns).
+						AddRow("2", "cat", "20", "png", RequestStatusDone).
+						AddRow("3", "dog", "", "png", RequestStatusFailed))
+			},
+			expectedStatus: RequestStatusFailed,
+			expectedTotal:  2,
+			expectedDone:   1,
+			expectedFailed: 1,
+		},
+		{
+			name: "Empty",
+			mockBehavior: func() {
+				mock.ExpectQuery(batchQuery).WithArgs("1", "10").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "created"}).AddRow("1", "10", created))
+				mock.ExpectQuery(requestsQuery).WithArgs("1").
+					WillReturnRows(sqlmock.NewRows(requestColumns))
+			},
+			expectedStatus: RequestStatusFailed,
+		},
+		{
+			name: "No such batch",
+			mockBehavior: func() {
+				mock.ExpectQuery(batchQuery).WithArgs("1", "10").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "created"}))
+			},
+			expectedError:   ErrNoSuchBatch,
+			isErrorExpected: true,
+		},
+	}
+
+	for _, tc := range testTable {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.mockBehavior()
+			batch, err := batchesRepo.GetBatch(context.TODO(), "10", "1")
+			if tc.isErrorExpected {
+				assert.Equal(t, tc.expectedError, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedStatus, batch.Status)
+			assert.Equal(t, tc.expectedTotal, batch.Total)
+			assert.Equal(t, tc.expectedDone, batch.Done)
+			assert.Equal(t, tc.expectedFailed, batch.Failed)
+			assert.Equal(t, created, batch.Created)
+		})
+	}
+}
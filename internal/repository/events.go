@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Konstantsiy/image-converter/internal/config"
+	"github.com/Konstantsiy/image-converter/pkg/logger"
+	"github.com/lib/pq"
+)
+
+// RequestStatusChannel is the postgres notification channel the request status changes are sent to
+// by the converter.requests trigger (see scripts/init.sql).
+const RequestStatusChannel = "request_status"
+
+const (
+	minReconnectInterval = time.Second
+	maxReconnectInterval = time.Minute
+)
+
+// RequestEvent represents the change of the conversion request status.
+type RequestEvent struct {
+	RequestID string `json:"request_id"`
+	UserID    string `json:"user_id"`
+	Status    string `json:"status"`
+	TargetID  string `json:"target_id,omitempty"`
+}
+
+// RequestEventsListener receives the request status changes from postgres.
+// The listener reconnects automatically, the changes made while the connection is lost are not received.
+type RequestEventsListener struct {
+	listener *pq.Listener
+	events   chan RequestEvent
+}
+
+// NewRequestEventsListener opens the dedicated postgres connection and starts listening to the request status changes.
+func NewRequestEventsListener(c *config.DBConfig) (*RequestEventsListener, error) {
+	listener := pq.NewListener(dataSourceName(c), minReconnectInterval, maxReconnectInterval,
+		func(event pq.ListenerEventType, err error) {
+			if err != nil {
+				logger.FromContext(context.Background()).Errorln(fmt.Errorf("postgres listener error: %w", err))
+			}
+		})
+
+	if err := listener.Listen(RequestStatusChannel); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("can't listen to the %s channel: %w", RequestStatusChannel, err)
+	}
+
+	rl := &RequestEventsListener{listener: listener, events: make(chan RequestEvent, 64)}
+	go rl.run()
+
+	return rl, nil
+}
+
+// Events returns the channel of the request status changes, it is closed after the listener is closed.
+func (rl *RequestEventsListener) Events() <-chan RequestEvent {
+	return rl.events
+}
+
+// Close stops listening and closes the connection.
+func (rl *RequestEventsListener) Close() error {
+	return rl.listener.Close()
+}
+
+func (rl *RequestEventsListener) run() {
+	defer close(rl.events)
+
+	for n := range rl.listener.Notify {
+		// nil is sent after the connection is re-established
+		if n == nil {
+			continue
+		}
+
+		var event RequestEvent
+		if err := json.Unmarshal([]byte(n.Extra), &event); err != nil {
+			logger.FromContext(context.Background()).Errorln(fmt.Errorf("can't decode request event: %w", err))
+			continue
+		}
+		rl.events <- event
+	}
+}
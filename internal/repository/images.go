@@ -5,6 +5,17 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// ImageRoleOriginal is the role of the image uploaded by the user.
+	ImageRoleOriginal = "original"
+
+	// ImageRoleConverted is the role of the converted image or rendition.
+	ImageRoleConverted = "converted"
 )
 
 var (
@@ -40,13 +51,134 @@ func (ir *ImagesRepository) InsertImage(ctx context.Context, filename, format st
 	return imageID, nil
 }
 
+// DiscardImages marks deleted the converted images of the request whose processing failed and unlinks them
+// from the renditions, so that the retried processing doesn't leave them behind. Their files, if uploaded,
+// are removed by the sweeper.
+func (ir *ImagesRepository) DiscardImages(ctx context.Context, requestID string, imageIDs []string) error {
+	tx, err := ir.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("can't begin transaction: %w", err)
+	}
+
+	const unlinkQuery = "UPDATE converter.renditions SET image_id = NULL WHERE request_id = $1 AND image_id = ANY($2);"
+	_, err = tx.ExecContext(ctx, unlinkQuery, requestID, pq.Array(imageIDs))
+	if err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("can't unlink renditions: %w", err)
+	}
+
+	const discardQuery = `UPDATE converter.images SET refs = 0, deleted = current_timestamp, updated = default
+		WHERE id = ANY($1) AND deleted IS NULL;`
+	_, err = tx.ExecContext(ctx, discardQuery, pq.Array(imageIDs))
+	if err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("can't discard images: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("can't commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// InsertOriginal inserts the uploaded image with the hex encoded SHA-256 of its content and returns image id.
+// The images with the same content and format are stored once: the existing image gets one more reference instead.
+// The image is named after the hash since it's shared by the users, the filename is kept by every request.
+// The returned flag reports whether the image file is already in the storage.
+func (ir *ImagesRepository) InsertOriginal(ctx context.Context, format, hash string) (string, bool, error) {
+	var imageID string
+	var stored bool
+	const query = `INSERT INTO converter.images (name, format, hash, stored) VALUES ($1, $2, $3, false)
+		ON CONFLICT (hash, format) WHERE hash IS NOT NULL AND deleted IS NULL
+		DO UPDATE SET refs = converter.images.refs + 1, updated = default
+		RETURNING id, stored;`
+
+	err := ir.db.QueryRowContext(ctx, query, hash, format, hash).Scan(&imageID, &stored)
+	if err != nil {
+		return "", false, fmt.Errorf("can't insert image: %w", err)
+	}
+
+	return imageID, stored, nil
+}
+
+// MarkStored records that the image file is uploaded to the storage.
+func (ir *ImagesRepository) MarkStored(ctx context.Context, imageID string) error {
+	const query = "UPDATE converter.images SET stored = true, updated = default WHERE id = $1;"
+	res, err := ir.db.ExecContext(ctx, query, imageID)
+	if err != nil {
+		return fmt.Errorf("can't update image: %w", err)
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("can't get the number of rows affected by an update: %w", err)
+	}
+	if count == 0 {
+		return ErrNoSuchImage
+	}
+
+	return nil
+}
+
+// ReleaseImage drops one reference to the image, e.g. when the request using it can't be created.
+// The image left without references and requests is removed: the row of the image that failed to upload
+// is deleted at once, the uploaded image is marked deleted and its file is removed by the sweeper.
+func (ir *ImagesRepository) ReleaseImage(ctx context.Context, imageID string) error {
+	tx, err := ir.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("can't begin transaction: %w", err)
+	}
+
+	const releaseQuery = "UPDATE converter.images SET refs = refs - 1, updated = default WHERE id = $1 AND refs > 0;"
+	res, err := tx.ExecContext(ctx, releaseQuery, imageID)
+	if err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("can't release image: %w", err)
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("can't get the number of rows affected by an update: %w", err)
+	}
+	if count == 0 {
+		_ = tx.Rollback()
+		return ErrNoSuchImage
+	}
+
+	const unusedCondition = `i.id = $1 AND i.refs = 0
+		AND NOT EXISTS (SELECT 1 FROM converter.requests r WHERE ` + usesImageCondition + `)`
+
+	const deleteQuery = "DELETE FROM converter.images i WHERE NOT i.stored AND " + unusedCondition + ";"
+	if _, err = tx.ExecContext(ctx, deleteQuery, imageID); err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("can't delete image: %w", err)
+	}
+
+	const markQuery = `UPDATE converter.images i SET deleted = coalesce(i.deleted, current_timestamp), updated = default
+		WHERE i.stored AND ` + unusedCondition + ";"
+	if _, err = tx.ExecContext(ctx, markQuery, imageID); err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("can't mark image deleted: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("can't commit transaction: %w", err)
+	}
+
+	return nil
+}
+
 // GetImageIDByUserID returns the image id to the storage.
 func (ir *ImagesRepository) GetImageIDByUserID(ctx context.Context, userID, imageID string) (string, error) {
 	var resImageID string
 	const query = `SELECT i.id FROM converter.requests r
     JOIN converter.images i
     ON i.id = $2
-    AND (r.source_id = i.id OR r.target_id = i.id)
+    AND (r.source_id = i.id OR r.target_id = i.id
+        OR EXISTS (SELECT 1 FROM converter.renditions rd WHERE rd.request_id = r.id AND rd.image_id = i.id))
+    AND i.deleted IS NULL
     AND r.user_id = $1;`
 
 	err := ir.db.QueryRowContext(ctx, query, userID, imageID).Scan(&resImageID)
@@ -59,3 +191,148 @@ func (ir *ImagesRepository) GetImageIDByUserID(ctx context.Context, userID, imag
 
 	return imageID, nil
 }
+
+// ExpiredImage represents the stored image whose retention is over.
+type ExpiredImage struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	Format  string    `json:"format"`
+	Role    string    `json:"role"`
+	Created time.Time `json:"created"`
+}
+
+// expiredImagesCondition selects the stored images whose retention is over for every request using them.
+// The retention of the request depends on the image role and the user, $1 and $2 are the default retentions
+// of the originals and the converted images in seconds, the zero retention keeps the image forever.
+const expiredImagesCondition = `i.deleted IS NULL AND i.stored
+	AND EXISTS (SELECT 1 FROM converter.requests r WHERE ` + usesImageCondition + `)
+	AND NOT EXISTS (SELECT 1 FROM converter.requests r
+		JOIN converter.users u ON u.id = r.user_id
+		CROSS JOIN LATERAL (SELECT CASE WHEN r.source_id = i.id
+			THEN coalesce(u.original_retention, $1 * interval '1 second')
+			ELSE coalesce(u.converted_retention, $2 * interval '1 second') END AS retention) t
+		WHERE (` + usesImageCondition + `)
+		AND (t.retention <= interval '0' OR r.created >= current_timestamp - t.retention))`
+
+// usesImageCondition checks that the request r uses the image i as the source, the target or the rendition.
+const usesImageCondition = `r.source_id = i.id OR r.target_id = i.id
+	OR EXISTS (SELECT 1 FROM converter.renditions rd WHERE rd.request_id = r.id AND rd.image_id = i.id)`
+
+// GetExpiredImages returns up to limit expired images without deleting them.
+func (ir *ImagesRepository) GetExpiredImages(ctx context.Context, original, converted time.Duration, limit int) ([]ExpiredImage, error) {
+	query := `SELECT i.id, i.name, i.format,
+		CASE WHEN EXISTS (SELECT 1 FROM converter.requests r WHERE r.source_id = i.id)
+			THEN '` + ImageRoleOriginal + `' ELSE '` + ImageRoleConverted + `' END,
+		i.created
+		FROM converter.images i
+		WHERE ` + expiredImagesCondition + `
+		ORDER BY i.created
+		LIMIT $3;`
+
+	rows, err := ir.db.QueryContext(ctx, query, original.Seconds(), converted.Seconds(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("can't get expired images: %w", err)
+	}
+	defer rows.Close()
+
+	var images []ExpiredImage
+	for rows.Next() {
+		var image ExpiredImage
+		err = rows.Scan(&image.ID, &image.Name, &image.Format, &image.Role, &image.Created)
+		if err != nil {
+			return nil, fmt.Errorf("can't scan expired image from rows: %w", err)
+		}
+		images = append(images, image)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error selecting rows: %w", err)
+	}
+
+	return images, nil
+}
+
+// MarkExpiredImages marks up to limit expired images deleted and returns the number of marked images.
+// The marked images are not shared with the new requests anymore, their files are removed by the sweeper.
+func (ir *ImagesRepository) MarkExpiredImages(ctx context.Context, original, converted time.Duration, limit int) (int, error) {
+	query := `UPDATE converter.images SET deleted = current_timestamp, updated = default
+		WHERE id IN (SELECT i.id FROM converter.images i
+			WHERE ` + expiredImagesCondition + `
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED);`
+
+	res, err := ir.db.ExecContext(ctx, query, original.Seconds(), converted.Seconds(), limit)
+	if err != nil {
+		return 0, fmt.Errorf("can't mark expired images: %w", err)
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("can't get the number of rows affected by an update: %w", err)
+	}
+
+	return int(count), nil
+}
+
+// GetDeletedImages returns the ids of up to limit deleted images whose files are still in the storage,
+// the skipped images, e.g. the ones that failed to be removed, are left out.
+func (ir *ImagesRepository) GetDeletedImages(ctx context.Context, skipped []string, limit int) ([]string, error) {
+	const query = `SELECT id FROM converter.images WHERE deleted IS NOT NULL AND stored AND NOT id = ANY($1)
+		ORDER BY deleted LIMIT $2;`
+
+	rows, err := ir.db.QueryContext(ctx, query, pq.Array(skipped), limit)
+	if err != nil {
+		return nil, fmt.Errorf("can't get deleted images: %w", err)
+	}
+	defer rows.Close()
+
+	var imageIDs []string
+	for rows.Next() {
+		var imageID string
+		if err = rows.Scan(&imageID); err != nil {
+			return nil, fmt.Errorf("can't scan deleted image from rows: %w", err)
+		}
+		imageIDs = append(imageIDs, imageID)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error selecting rows: %w", err)
+	}
+
+	return imageIDs, nil
+}
+
+// PurgeImage removes the deleted image whose file is removed from the storage. The row is deleted
+// unless the requests still use the image, e.g. the expired one, then the image is marked as not stored.
+func (ir *ImagesRepository) PurgeImage(ctx context.Context, imageID string) error {
+	const deleteQuery = `DELETE FROM converter.images i WHERE i.id = $1 AND i.deleted IS NOT NULL
+		AND NOT EXISTS (SELECT 1 FROM converter.requests r WHERE ` + usesImageCondition + `);`
+	res, err := ir.db.ExecContext(ctx, deleteQuery, imageID)
+	if err != nil {
+		return fmt.Errorf("can't delete image: %w", err)
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("can't get the number of rows affected by a delete: %w", err)
+	}
+	if count > 0 {
+		return nil
+	}
+
+	const updateQuery = "UPDATE converter.images SET stored = false, updated = default WHERE id = $1 AND deleted IS NOT NULL;"
+	res, err = ir.db.ExecContext(ctx, updateQuery, imageID)
+	if err != nil {
+		return fmt.Errorf("can't update image: %w", err)
+	}
+
+	count, err = res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("can't get the number of rows affected by an update: %w", err)
+	}
+	if count == 0 {
+		return ErrNoSuchImage
+	}
+
+	return nil
+}
@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -204,3 +205,174 @@ func TestImagesRepository_GetImageIDByUserID(t *testing.T) {
 		})
 	}
 }
+
+func TestImagesRepository_InsertOriginal(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%v' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	imagesRepo, err := NewImagesRepository(db)
+	require.NoError(t, err)
+
+	const (
+		query = `INSERT INTO converter.images (.+) ON CONFLICT (.+) RETURNING id, stored`
+		hash  = "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"
+	)
+
+	testTable := []struct {
+		name            string
+		mockBehavior    func()
+		expectedImageID string
+		expectedStored  bool
+		isErrorExpected bool
+	}{
+		{
+			name: "New image",
+			mockBehavior: func() {
+				mock.ExpectQuery(query).WithArgs(hash, "jpg", hash).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "stored"}).AddRow("1", false))
+			},
+			expectedImageID: "1",
+		},
+		{
+			name: "Stored image",
+			mockBehavior: func() {
+				mock.ExpectQuery(query).WithArgs(hash, "jpg", hash).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "stored"}).AddRow("1", true))
+			},
+			expectedImageID: "1",
+			expectedStored:  true,
+		},
+		{
+			name: "Database error",
+			mockBehavior: func() {
+				mock.ExpectQuery(query).WithArgs(hash, "jpg", hash).
+					WillReturnError(fmt.Errorf("connection refused"))
+			},
+			isErrorExpected: true,
+		},
+	}
+
+	for _, tc := range testTable {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.mockBehavior()
+			imageID, stored, err := imagesRepo.InsertOriginal(context.TODO(), "jpg", hash)
+			if tc.isErrorExpected {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedImageID, imageID)
+				assert.Equal(t, tc.expectedStored, stored)
+			}
+		})
+	}
+}
+
+func TestImagesRepository_ReleaseImage(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%v' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	imagesRepo, err := NewImagesRepository(db)
+	require.NoError(t, err)
+
+	const (
+		releaseQuery = `UPDATE converter.images SET refs = refs - 1(.+)`
+		deleteQuery  = `DELETE FROM converter.images i WHERE NOT i.stored AND i.id = (.+) AND i.refs = 0`
+		markQuery    = `UPDATE converter.images i SET deleted = (.+) WHERE i.stored AND i.id = (.+) AND i.refs = 0`
+	)
+
+	testTable := []struct {
+		name          string
+		mockBehavior  func()
+		expectedError error
+	}{
+		{
+			name: "Ok",
+			mockBehavior: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(releaseQuery).WithArgs("1").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(deleteQuery).WithArgs("1").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(markQuery).WithArgs("1").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name: "No such image",
+			mockBehavior: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(releaseQuery).WithArgs("1").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+			},
+			expectedError: ErrNoSuchImage,
+		},
+	}
+
+	for _, tc := range testTable {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.mockBehavior()
+			err := imagesRepo.ReleaseImage(context.TODO(), "1")
+			assert.Equal(t, tc.expectedError, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestImagesRepository_DiscardImages(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%v' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	imagesRepo, err := NewImagesRepository(db)
+	require.NoError(t, err)
+
+	const (
+		unlinkQuery  = "UPDATE converter.renditions SET image_id = NULL (.+)"
+		discardQuery = "UPDATE converter.images SET refs = 0, deleted = current_timestamp(.+)"
+	)
+
+	testTable := []struct {
+		name            string
+		mockBehavior    func()
+		isErrorExpected bool
+	}{
+		{
+			name: "Ok",
+			mockBehavior: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(unlinkQuery).WithArgs("1", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(discardQuery).WithArgs(sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name: "Database error",
+			mockBehavior: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(unlinkQuery).WithArgs("1", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(discardQuery).WithArgs(sqlmock.AnyArg()).WillReturnError(fmt.Errorf("some error"))
+				mock.ExpectRollback()
+			},
+			isErrorExpected: true,
+		},
+	}
+
+	for _, tc := range testTable {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.mockBehavior()
+			err := imagesRepo.DiscardImages(context.TODO(), "1", []string{"10", "11"})
+			if tc.isErrorExpected {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrNoJobs notifies that there are no jobs available for processing.
+	ErrNoJobs = errors.New("no jobs available")
+
+	// ErrLeaseLost notifies that the job lease has expired and the job may be claimed by another worker.
+	ErrLeaseLost = errors.New("job lease is lost")
+)
+
+// Job represents the conversion job of the postgres queue.
+// Attempts counts the claims of the job including the current one.
+type Job struct {
+	ID        string
+	RequestID string
+	Payload   []byte
+	Attempts  int
+}
+
+// JobsRepository represents repository for working with the jobs of the postgres queue.
+type JobsRepository struct {
+	db *sql.DB
+}
+
+// NewJobsRepository creates new jobs repository.
+func NewJobsRepository(db *sql.DB) (*JobsRepository, error) {
+	if db == nil {
+		return nil, ErrEmptySQLDriver
+	}
+	return &JobsRepository{db: db}, nil
+}
+
+// InsertJob creates the job available for processing at once.
+func (jr *JobsRepository) InsertJob(ctx context.Context, requestID string, priority int, payload []byte) error {
+	const query = "INSERT INTO converter.jobs (request_id, priority, payload) VALUES ($1, $2, $3);"
+
+	_, err := jr.db.ExecContext(ctx, query, requestID, priority, payload)
+	if err != nil {
+		return fmt.Errorf("can't insert job: %w", err)
+	}
+
+	return nil
+}
+
+// ClaimJob leases the oldest available job of the highest priority to the worker. The job is available if it isn't leased
+// or its lease has expired, e.g. the worker died. The jobs locked by other workers at the moment are skipped.
+func (jr *JobsRepository) ClaimJob(ctx context.Context, worker string, lease time.Duration) (Job, error) {
+	const query = `UPDATE converter.jobs SET locked_by=$1, locked_until=now() + $2 * interval '1 millisecond',
+		attempts=attempts+1
+		WHERE id = (
+			SELECT id FROM converter.jobs
+			WHERE available_at <= now() AND (locked_until IS NULL OR locked_until < now())
+			ORDER BY priority DESC, available_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED)
+		RETURNING id, request_id, payload, attempts;`
+
+	var job Job
+	err := jr.db.QueryRowContext(ctx, query, worker, lease.Milliseconds()).
+		Scan(&job.ID, &job.RequestID, &job.Payload, &job.Attempts)
+	if err == sql.ErrNoRows {
+		return Job{}, ErrNoJobs
+	}
+	if err != nil {
+		return Job{}, fmt.Errorf("can't claim job: %w", err)
+	}
+
+	return job, nil
+}
+
+// ExtendLease prolongs the lease of the job held by the worker.
+func (jr *JobsRepository) ExtendLease(ctx context.Context, jobID, worker string, lease time.Duration) error {
+	const query = `UPDATE converter.jobs SET locked_until=now() + $3 * interval '1 millisecond'
+		WHERE id=$1 AND locked_by=$2;`
+
+	return jr.execLeased(ctx, query, jobID, worker, lease.Milliseconds())
+}
+
+// ReleaseJob returns the job held by the worker to the queue, the job becomes available after the delay.
+func (jr *JobsRepository) ReleaseJob(ctx context.Context, jobID, worker string, delay time.Duration, lastError string) error {
+	const query = `UPDATE converter.jobs SET locked_by=NULL, locked_until=NULL,
+		available_at=now() + $3 * interval '1 millisecond', last_error=$4
+		WHERE id=$1 AND locked_by=$2;`
+
+	return jr.execLeased(ctx, query, jobID, worker, delay.Milliseconds(), nullString(lastError))
+}
+
+// DeleteJob deletes the finished job held by the worker.
+func (jr *JobsRepository) DeleteJob(ctx context.Context, jobID, worker string) error {
+	const query = "DELETE FROM converter.jobs WHERE id=$1 AND locked_by=$2;"
+
+	return jr.execLeased(ctx, query, jobID, worker)
+}
+
+// execLeased executes the query changing the job held by the worker, ErrLeaseLost is returned if no job is changed.
+func (jr *JobsRepository) execLeased(ctx context.Context, query string, args ...interface{}) error {
+	res, err := jr.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("can't update job: %w", err)
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("can't get the number of rows affected by an update: %w", err)
+	}
+	if count == 0 {
+		return ErrLeaseLost
+	}
+
+	return nil
+}
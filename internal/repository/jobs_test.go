@@ -0,0 +1,149 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJobsRepository_ClaimJob(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%v' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	jobsRepo, err := NewJobsRepository(db)
+	require.NoError(t, err)
+
+	const query = "UPDATE converter.jobs SET locked_by=(.+) FOR UPDATE SKIP LOCKED(.+) RETURNING id, request_id, payload, attempts"
+
+	testTable := []struct {
+		name            string
+		mockBehavior    func()
+		expectedJob     Job
+		expectedError   error
+		isErrorExpected bool
+	}{
+		{
+			name: "Ok",
+			mockBehavior: func() {
+				mock.ExpectQuery(query).
+					WithArgs("worker-1", int64(60000)).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "request_id", "payload", "attempts"}).
+						AddRow("1", "2", []byte(`{"RequestID":"2"}`), 1))
+			},
+			expectedJob: Job{ID: "1", RequestID: "2", Payload: []byte(`{"RequestID":"2"}`), Attempts: 1},
+		},
+		{
+			name: "No jobs",
+			mockBehavior: func() {
+				mock.ExpectQuery(query).WillReturnError(sql.ErrNoRows)
+			},
+			expectedError:   ErrNoJobs,
+			isErrorExpected: true,
+		},
+		{
+			name: "Database error",
+			mockBehavior: func() {
+				mock.ExpectQuery(query).WillReturnError(fmt.Errorf("some error"))
+			},
+			isErrorExpected: true,
+		},
+	}
+
+	for _, tc := range testTable {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.mockBehavior()
+			job, err := jobsRepo.ClaimJob(context.TODO(), "worker-1", time.Minute)
+			if tc.isErrorExpected {
+				assert.Error(t, err)
+				if tc.expectedError != nil {
+					assert.Equal(t, tc.expectedError, err)
+				}
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedJob, job)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestJobsRepository_Lease(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%v' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	jobsRepo, err := NewJobsRepository(db)
+	require.NoError(t, err)
+
+	testTable := []struct {
+		name          string
+		mockBehavior  func()
+		call          func() error
+		expectedError error
+	}{
+		{
+			name: "Extend lease",
+			mockBehavior: func() {
+				mock.ExpectExec("UPDATE converter.jobs SET locked_until=(.+) WHERE id=(.+) AND locked_by=(.+)").
+					WithArgs("1", "worker-1", int64(60000)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			call: func() error {
+				return jobsRepo.ExtendLease(context.TODO(), "1", "worker-1", time.Minute)
+			},
+		},
+		{
+			name: "Lease lost",
+			mockBehavior: func() {
+				mock.ExpectExec("UPDATE converter.jobs SET locked_until=(.+)").
+					WithArgs("1", "worker-1", int64(60000)).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			call: func() error {
+				return jobsRepo.ExtendLease(context.TODO(), "1", "worker-1", time.Minute)
+			},
+			expectedError: ErrLeaseLost,
+		},
+		{
+			name: "Release job",
+			mockBehavior: func() {
+				mock.ExpectExec("UPDATE converter.jobs SET locked_by=NULL(.+)").
+					WithArgs("1", "worker-1", int64(5000), "s3 error: timeout").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			call: func() error {
+				return jobsRepo.ReleaseJob(context.TODO(), "1", "worker-1", 5*time.Second, "s3 error: timeout")
+			},
+		},
+		{
+			name: "Delete job",
+			mockBehavior: func() {
+				mock.ExpectExec("DELETE FROM converter.jobs WHERE id=(.+) AND locked_by=(.+)").
+					WithArgs("1", "worker-1").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			call: func() error {
+				return jobsRepo.DeleteJob(context.TODO(), "1", "worker-1")
+			},
+		},
+	}
+
+	for _, tc := range testTable {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.mockBehavior()
+			assert.Equal(t, tc.expectedError, tc.call())
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/Konstantsiy/image-converter/internal/converter"
+	"github.com/lib/pq"
+)
+
+// OutboxEntry represents the conversion request waiting to be sent to the queue.
+type OutboxEntry struct {
+	ID           string
+	RequestID    string
+	Attempts     int
+	SourceID     string
+	Filename     string
+	SourceFormat string
+	TargetFormat string
+	Ratio        int
+	Priority     int
+	Options      converter.Options
+	Renditions   []converter.Rendition
+}
+
+// OutboxRepository represents repository for working with the outbox of the conversion requests.
+type OutboxRepository struct {
+	db *sql.DB
+}
+
+// NewOutboxRepository creates new outbox repository.
+func NewOutboxRepository(db *sql.DB) (*OutboxRepository, error) {
+	if db == nil {
+		return nil, ErrEmptySQLDriver
+	}
+	return &OutboxRepository{db: db}, nil
+}
+
+// ClaimOutbox claims up to limit oldest outbox entries that are due and returns them. The claimed entries aren't
+// due until the lease is over, so that another relay skips them while they are published outside the transaction.
+// The entry that isn't completed or failed within the lease is claimed again, so the queue receives it at least once.
+func (or *OutboxRepository) ClaimOutbox(ctx context.Context, limit int, lease time.Duration) ([]OutboxEntry, error) {
+	tx, err := or.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("can't begin transaction: %w", err)
+	}
+
+	entries, err := getOutboxEntries(ctx, tx, limit)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+
+	if len(entries) > 0 {
+		entryIDs := make([]string, len(entries))
+		for i, e := range entries {
+			entryIDs[i] = e.ID
+		}
+
+		const query = "UPDATE converter.outbox SET next_attempt = current_timestamp + $2 * interval '1 second' WHERE id = ANY($1);"
+		if _, err = tx.ExecContext(ctx, query, pq.Array(entryIDs), lease.Seconds()); err != nil {
+			_ = tx.Rollback()
+			return nil, fmt.Errorf("can't claim outbox entries: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("can't commit transaction: %w", err)
+	}
+
+	return entries, nil
+}
+
+// CompleteOutbox deletes the outbox entries sent to the queue.
+func (or *OutboxRepository) CompleteOutbox(ctx context.Context, entryIDs []string) error {
+	const query = "DELETE FROM converter.outbox WHERE id = ANY($1);"
+	if _, err := or.db.ExecContext(ctx, query, pq.Array(entryIDs)); err != nil {
+		return fmt.Errorf("can't delete outbox entries: %w", err)
+	}
+	return nil
+}
+
+// FailOutbox records the failed attempt to send the outbox entry, the entry is due again after the delay.
+func (or *OutboxRepository) FailOutbox(ctx context.Context, entryID, lastError string, delay time.Duration) error {
+	const query = `UPDATE converter.outbox SET attempts = attempts + 1, last_error = $2,
+		next_attempt = current_timestamp + $3 * interval '1 second' WHERE id = $1;`
+	if _, err := or.db.ExecContext(ctx, query, entryID, lastError, delay.Seconds()); err != nil {
+		return fmt.Errorf("can't update outbox entry: %w", err)
+	}
+	return nil
+}
+
+// RequeueRequests adds the outbox entries for the queued and processing requests that have none.
+// It's used on startup by the queue keeping the messages in memory, so that the requests accepted
+// before the restart are sent to the queue once again.
+func (or *OutboxRepository) RequeueRequests(ctx context.Context) (int, error) {
+	const query = `INSERT INTO converter.outbox (request_id)
+		SELECT r.id FROM converter.requests r
+		WHERE r.status IN ('queued', 'processing')
+		AND NOT EXISTS (SELECT 1 FROM converter.outbox o WHERE o.request_id = r.id)
+		ORDER BY r.created;`
+
+	res, err := or.db.ExecContext(ctx, query)
+	if err != nil {
+		return 0, fmt.Errorf("can't requeue requests: %w", err)
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("can't get requeued requests count: %w", err)
+	}
+
+	return int(count), nil
+}
+
+// getOutboxEntries locks the oldest due outbox entries of the highest priority and gets them together with the requests data.
+func getOutboxEntries(ctx context.Context, q queryer, limit int) ([]OutboxEntry, error) {
+	const query = `SELECT o.id, o.request_id, o.attempts, r.source_id, coalesce(r.filename, ''), r.source_format, r.target_format, r.ratio, r.priority,
+		coalesce(r.width, 0), coalesce(r.height, 0), coalesce(r.fit, ''),
+		coalesce(r.crop_x, 0), coalesce(r.crop_y, 0), coalesce(r.crop_width, 0), coalesce(r.crop_height, 0),
+		coalesce(r.rotation, 0), coalesce(r.flip, ''), coalesce(r.metadata, '')
+		FROM converter.outbox o
+		JOIN converter.requests r ON r.id = o.request_id
+		WHERE o.next_attempt <= current_timestamp
+		ORDER BY r.priority DESC, o.created
+		LIMIT $1
+		FOR UPDATE OF o SKIP LOCKED;`
+
+	rows, err := q.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("can't get outbox entries: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []OutboxEntry
+	for rows.Next() {
+		var e OutboxEntry
+		var crop converter.Crop
+		err = rows.Scan(
+			&e.ID,
+			&e.RequestID,
+			&e.Attempts,
+			&e.SourceID,
+			&e.Filename,
+			&e.SourceFormat,
+			&e.TargetFormat,
+			&e.Ratio,
+			&e.Priority,
+			&e.Options.Width,
+			&e.Options.Height,
+			&e.Options.Fit,
+			&crop.X,
+			&crop.Y,
+			&crop.Width,
+			&crop.Height,
+			&e.Options.Rotation,
+			&e.Options.Flip,
+			&e.Options.Metadata)
+		if err != nil {
+			return nil, fmt.Errorf("can't scan outbox entry from rows: %w", err)
+		}
+		if crop.Width > 0 {
+			e.Options.Crop = &crop
+		}
+		entries = append(entries, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error selecting rows: %w", err)
+	}
+	rows.Close()
+
+	for i := range entries {
+		entries[i].Renditions, err = getOutboxRenditions(ctx, q, entries[i].RequestID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return entries, nil
+}
+
+// getOutboxRenditions gets the renditions declared by the request.
+func getOutboxRenditions(ctx context.Context, q queryer, requestID string) ([]converter.Rendition, error) {
+	const query = `SELECT name, coalesce(width, 0), coalesce(height, 0), format, ratio
+		FROM converter.renditions WHERE request_id = $1 ORDER BY name;`
+
+	rows, err := q.QueryContext(ctx, query, requestID)
+	if err != nil {
+		return nil, fmt.Errorf("can't get request renditions: %w", err)
+	}
+	defer rows.Close()
+
+	var renditions []converter.Rendition
+	for rows.Next() {
+		var r converter.Rendition
+		if err = rows.Scan(&r.Name, &r.Width, &r.Height, &r.Format, &r.Ratio); err != nil {
+			return nil, fmt.Errorf("can't scan request rendition from rows: %w", err)
+		}
+		renditions = append(renditions, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error selecting rows: %w", err)
+	}
+
+	return renditions, nil
+}
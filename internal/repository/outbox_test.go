@@ -0,0 +1,272 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Konstantsiy/image-converter/internal/converter"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestsRepository_InsertQueuedRequest(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%v' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	requestsRepo, err := NewRequestsRepository(db)
+	require.NoError(t, err)
+
+	renditions := []converter.Rendition{{Name: "small", Width: 100, Format: "webp", Ratio: 80}}
+
+	testTable := []struct {
+		name              string
+		mockBehavior      func()
+		expectedRequestID string
+		isErrorExpected   bool
+	}{
+		{
+			name: "Ok",
+			mockBehavior: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery("INSERT INTO converter.requests (.+)").
+					WithArgs("10", "20", "cat", "jpg", "png", 90, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, 2, nil).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("1"))
+				mock.ExpectExec("INSERT INTO converter.renditions (.+)").
+					WithArgs("1", "small", 100, nil, "webp", 80).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("INSERT INTO converter.outbox (.+)").
+					WithArgs("1").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			expectedRequestID: "1",
+		},
+		{
+			name: "Outbox error",
+			mockBehavior: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery("INSERT INTO converter.requests (.+)").
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("1"))
+				mock.ExpectExec("INSERT INTO converter.renditions (.+)").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("INSERT INTO converter.outbox (.+)").
+					WillReturnError(fmt.Errorf("some error"))
+				mock.ExpectRollback()
+			},
+			isErrorExpected: true,
+		},
+	}
+
+	for _, tc := range testTable {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.mockBehavior()
+			result, err := requestsRepo.InsertQueuedRequest(context.TODO(), "10", "20", "cat", "jpg", "png", 90, 2, converter.Options{}, renditions)
+			if tc.isErrorExpected {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedRequestID, result)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestOutboxRepository_ClaimOutbox(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%v' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	outboxRepo, err := NewOutboxRepository(db)
+	require.NoError(t, err)
+
+	const (
+		entriesQuery = "SELECT (.+) FROM converter.outbox (.+) WHERE o.next_attempt <= current_timestamp (.+) FOR UPDATE OF o SKIP LOCKED"
+		claimQuery   = "UPDATE converter.outbox SET next_attempt = (.+) WHERE id = ANY"
+	)
+
+	columns := []string{"id", "request_id", "attempts", "source_id", "name", "source_format", "target_format", "ratio", "priority",
+		"width", "height", "fit", "crop_x", "crop_y", "crop_width", "crop_height", "rotation", "flip", "metadata"}
+
+	expectEntries := func() {
+		mock.ExpectBegin()
+		mock.ExpectQuery(entriesQuery).
+			WithArgs(10).
+			WillReturnRows(sqlmock.NewRows(columns).
+				AddRow("1", "11", 0, "21", "cat", "jpg", "png", 90, 5, 100, 0, "", 0, 0, 0, 0, 0, "", "").
+				AddRow("2", "12", 1, "22", "dog", "png", "webp", 80, 1, 0, 0, "", 0, 0, 0, 0, 90, "", ""))
+		mock.ExpectQuery("SELECT (.+) FROM converter.renditions").WithArgs("11").
+			WillReturnRows(sqlmock.NewRows([]string{"name", "width", "height", "format", "ratio"}).
+				AddRow("small", 100, 0, "webp", 80))
+		mock.ExpectQuery("SELECT (.+) FROM converter.renditions").WithArgs("12").
+			WillReturnRows(sqlmock.NewRows([]string{"name", "width", "height", "format", "ratio"}))
+	}
+
+	testTable := []struct {
+		name            string
+		mockBehavior    func()
+		expectedEntries []OutboxEntry
+		isErrorExpected bool
+	}{
+		{
+			name: "Ok",
+			mockBehavior: func() {
+				expectEntries()
+				mock.ExpectExec(claimQuery).WithArgs(pq.Array([]string{"1", "2"}), time.Minute.Seconds()).
+					WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectCommit()
+			},
+			expectedEntries: []OutboxEntry{
+				{
+					ID: "1", RequestID: "11", SourceID: "21", Filename: "cat", SourceFormat: "jpg", TargetFormat: "png", Ratio: 90, Priority: 5,
+					Options:    converter.Options{Width: 100},
+					Renditions: []converter.Rendition{{Name: "small", Width: 100, Format: "webp", Ratio: 80}},
+				},
+				{
+					ID: "2", RequestID: "12", Attempts: 1, SourceID: "22", Filename: "dog", SourceFormat: "png", TargetFormat: "webp", Ratio: 80, Priority: 1,
+					Options: converter.Options{Rotation: 90},
+				},
+			},
+		},
+		{
+			name: "Empty outbox",
+			mockBehavior: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(entriesQuery).WithArgs(10).WillReturnRows(sqlmock.NewRows(columns))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name: "Claim error",
+			mockBehavior: func() {
+				expectEntries()
+				mock.ExpectExec(claimQuery).WillReturnError(fmt.Errorf("some error"))
+				mock.ExpectRollback()
+			},
+			isErrorExpected: true,
+		},
+		{
+			name: "Database error",
+			mockBehavior: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(entriesQuery).WillReturnError(fmt.Errorf("some error"))
+				mock.ExpectRollback()
+			},
+			isErrorExpected: true,
+		},
+	}
+
+	for _, tc := range testTable {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.mockBehavior()
+			entries, err := outboxRepo.ClaimOutbox(context.TODO(), 10, time.Minute)
+			if tc.isErrorExpected {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedEntries, entries)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestOutboxRepository_CompleteOutbox(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%v' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	outboxRepo, err := NewOutboxRepository(db)
+	require.NoError(t, err)
+
+	mock.ExpectExec("DELETE FROM converter.outbox WHERE id = ANY").WithArgs(pq.Array([]string{"1", "2"})).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	assert.NoError(t, outboxRepo.CompleteOutbox(context.TODO(), []string{"1", "2"}))
+
+	mock.ExpectExec("DELETE FROM converter.outbox WHERE id = ANY").WillReturnError(fmt.Errorf("some error"))
+	assert.Error(t, outboxRepo.CompleteOutbox(context.TODO(), []string{"1"}))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOutboxRepository_FailOutbox(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%v' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	outboxRepo, err := NewOutboxRepository(db)
+	require.NoError(t, err)
+
+	const query = "UPDATE converter.outbox SET attempts = attempts \\+ 1, last_error = (.+), next_attempt = (.+) WHERE id = (.+)"
+
+	mock.ExpectExec(query).WithArgs("1", "connection is lost", (2 * time.Second).Seconds()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(t, outboxRepo.FailOutbox(context.TODO(), "1", "connection is lost", 2*time.Second))
+
+	mock.ExpectExec(query).WillReturnError(fmt.Errorf("some error"))
+	assert.Error(t, outboxRepo.FailOutbox(context.TODO(), "1", "connection is lost", time.Second))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOutboxRepository_RequeueRequests(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%v' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	outboxRepo, err := NewOutboxRepository(db)
+	require.NoError(t, err)
+
+	const query = `INSERT INTO converter.outbox (.+) SELECT r.id FROM converter.requests r WHERE r.status IN (.+)`
+
+	testTable := []struct {
+		name            string
+		mockBehavior    func()
+		expectedCount   int
+		isErrorExpected bool
+	}{
+		{
+			name: "Ok",
+			mockBehavior: func() {
+				mock.ExpectExec(query).WillReturnResult(sqlmock.NewResult(0, 3))
+			},
+			expectedCount: 3,
+		},
+		{
+			name: "Repository error",
+			mockBehavior: func() {
+				mock.ExpectExec(query).WillReturnError(fmt.Errorf("some error"))
+			},
+			isErrorExpected: true,
+		},
+	}
+
+	for _, tc := range testTable {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.mockBehavior()
+			count, err := outboxRepo.RequeueRequests(context.TODO())
+			if tc.isErrorExpected {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedCount, count)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
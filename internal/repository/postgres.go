@@ -9,8 +9,7 @@ import (
 
 // NewPostgresDB opens new postgres connection by configuration struct.
 func NewPostgresDB(c *config.DBConfig) (*sql.DB, error) {
-	db, err := sql.Open("postgres", fmt.Sprintf("host=%s port=%s user=%s dbname=%s password=%s sslmode=%s",
-		c.Host, c.Port, c.User, c.DBName, c.Password, c.SSLMode))
+	db, err := sql.Open("postgres", dataSourceName(c))
 	if err != nil {
 		return nil, fmt.Errorf("error when opening a database connection: %w", err)
 	}
@@ -20,3 +19,9 @@ func NewPostgresDB(c *config.DBConfig) (*sql.DB, error) {
 
 	return db, nil
 }
+
+// dataSourceName builds the postgres connection string from the configuration struct.
+func dataSourceName(c *config.DBConfig) string {
+	return fmt.Sprintf("host=%s port=%s user=%s dbname=%s password=%s sslmode=%s",
+		c.Host, c.Port, c.User, c.DBName, c.Password, c.SSLMode)
+}
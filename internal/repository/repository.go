@@ -1,23 +1,96 @@
 // Package repository provides the logic for working with database.
 package repository
 
-import "context"
+import (
+	"context"
+	"time"
+
+	"github.com/Konstantsiy/image-converter/internal/converter"
+)
 
 // Users represents users repository.
 type Users interface {
 	InsertUser(ctx context.Context, email, password string) (string, error)
 	GetUserByEmail(ctx context.Context, email string) (User, error)
+	GetUserPriority(ctx context.Context, userID string) (int, error)
+	SetUserPriority(ctx context.Context, email string, priority int) error
+	DeleteUser(ctx context.Context, userID string) ([]string, error)
 }
 
 // Images represents images repository.
 type Images interface {
 	InsertImage(ctx context.Context, filename, format string) (string, error)
+	DiscardImages(ctx context.Context, requestID string, imageIDs []string) error
+	InsertOriginal(ctx context.Context, format, hash string) (string, bool, error)
+	MarkStored(ctx context.Context, imageID string) error
+	ReleaseImage(ctx context.Context, imageID string) error
+	GetExpiredImages(ctx context.Context, original, converted time.Duration, limit int) ([]ExpiredImage, error)
+	MarkExpiredImages(ctx context.Context, original, converted time.Duration, limit int) (int, error)
+	GetDeletedImages(ctx context.Context, skipped []string, limit int) ([]string, error)
+	PurgeImage(ctx context.Context, imageID string) error
 	GetImageIDByUserID(ctx context.Context, userID, imageID string) (string, error)
 }
 
+// Batches represents batches repository.
+type Batches interface {
+	InsertBatch(ctx context.Context, userID string, requests []QueuedRequest) (string, []string, error)
+	GetBatch(ctx context.Context, userID, batchID string) (Batch, error)
+}
+
 // Requests represents requests repository.
 type Requests interface {
-	InsertRequest(ctx context.Context, userID, sourceID, sourceFormat, targetFormat string, ratio int) (string, error)
+	InsertRequest(ctx context.Context, userID, sourceID, filename, sourceFormat, targetFormat string, ratio int, opts converter.Options) (string, error)
+	InsertQueuedRequest(ctx context.Context, userID, sourceID, filename, sourceFormat, targetFormat string, ratio, priority int, opts converter.Options, renditions []converter.Rendition) (string, error)
 	GetRequestsByUserID(ctx context.Context, userID string) ([]ConversionRequest, error)
+	GetRequestByID(ctx context.Context, userID, requestID string) (ConversionRequest, error)
 	UpdateRequest(ctx context.Context, requestID, status, targetID string) error
+	UpdateRequestError(ctx context.Context, requestID, status string, retryCount int, lastError string) error
+	InsertRenditions(ctx context.Context, requestID string, renditions []converter.Rendition) error
+	UpdateRendition(ctx context.Context, requestID, name, imageID string) error
+	ReuseConversion(ctx context.Context, requestID string) (string, error)
+	DeleteRequest(ctx context.Context, userID, requestID string) ([]string, error)
+	DeleteImageRequests(ctx context.Context, userID, imageID string) ([]string, error)
+	DeleteUserRequests(ctx context.Context, userID string) ([]string, error)
+}
+
+// Webhooks represents webhooks repository.
+type Webhooks interface {
+	InsertWebhook(ctx context.Context, userID, requestID, url, secret string) (string, error)
+	GetWebhooksByUserID(ctx context.Context, userID string) ([]Webhook, error)
+	GetRequestWebhooks(ctx context.Context, requestID string) ([]Webhook, error)
+	DeleteWebhook(ctx context.Context, userID, webhookID string) error
+	InsertDelivery(ctx context.Context, delivery WebhookDelivery) error
+	GetDeliveries(ctx context.Context, userID, webhookID string) ([]WebhookDelivery, error)
+}
+
+// Outbox represents the outbox of the conversion requests waiting to be sent to the queue.
+type Outbox interface {
+	ClaimOutbox(ctx context.Context, limit int, lease time.Duration) ([]OutboxEntry, error)
+	CompleteOutbox(ctx context.Context, entryIDs []string) error
+	FailOutbox(ctx context.Context, entryID, lastError string, delay time.Duration) error
+}
+
+// Jobs represents the jobs repository of the postgres queue.
+type Jobs interface {
+	InsertJob(ctx context.Context, requestID string, priority int, payload []byte) error
+	ClaimJob(ctx context.Context, worker string, lease time.Duration) (Job, error)
+	ExtendLease(ctx context.Context, jobID, worker string, lease time.Duration) error
+	ReleaseJob(ctx context.Context, jobID, worker string, delay time.Duration, lastError string) error
+	DeleteJob(ctx context.Context, jobID, worker string) error
+}
+
+// AccountJobs represents the repository of the account deletion and export jobs.
+type AccountJobs interface {
+	InsertAccountJob(ctx context.Context, userID, kind string) (AccountJob, error)
+	GetAccountJob(ctx context.Context, userID, jobID string) (AccountJob, error)
+	ClaimAccountJob(ctx context.Context, lease time.Duration) (AccountJob, error)
+	FinishAccountJob(ctx context.Context, jobID, status, fileID, lastError string) error
+	RetryAccountJob(ctx context.Context, jobID string, delay time.Duration, lastError string) error
+}
+
+// RefreshTokens represents the repository of the hashed refresh tokens.
+type RefreshTokens interface {
+	InsertRefreshToken(ctx context.Context, userID, tokenHash string, ttl time.Duration) error
+	RotateRefreshToken(ctx context.Context, tokenHash, newTokenHash string, ttl time.Duration) (string, error)
+	RevokeRefreshToken(ctx context.Context, tokenHash string) error
 }
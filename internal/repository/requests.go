@@ -6,12 +6,23 @@ import (
 	"errors"
 	"fmt"
 	"time"
+
+	"github.com/Konstantsiy/image-converter/internal/converter"
+	"github.com/lib/pq"
 )
 
-// ErrNoSuchRequest notifies that needed request does not exist.
-var ErrNoSuchRequest = errors.New("request with this id does not exists")
+var (
+	// ErrNoSuchRequest notifies that needed request does not exist.
+	ErrNoSuchRequest = errors.New("request with this id does not exists")
+
+	// ErrRequestInProgress notifies that the request can't be deleted until it's done or failed.
+	ErrRequestInProgress = errors.New("request is still processing")
+)
 
 const (
+	// RequestStatusQueued represents the request waiting in the queue.
+	RequestStatusQueued = "queued"
+
 	// RequestStatusProcessing represents that the request is being processed.
 	RequestStatusProcessing = "processing"
 
@@ -22,18 +33,43 @@ const (
 	RequestStatusDone = "done"
 )
 
+const (
+	// MaxPriority is the highest priority of the conversion request.
+	MaxPriority = 9
+
+	// DefaultPriority is the priority of the conversion requests of the users with the default tier.
+	DefaultPriority = 5
+)
+
+// IsFinalStatus reports whether the request with the status will not be processed anymore.
+func IsFinalStatus(status string) bool {
+	return status == RequestStatusDone || status == RequestStatusFailed
+}
+
 // ConversionRequest represents conversion request in the database.
 type ConversionRequest struct {
-	ID           string    `json:"id"`
-	UserID       string    `json:"user_id"`
-	SourceID     string    `json:"source_id"`
-	TargetID     string    `json:"target_id"`
-	SourceFormat string    `json:"source_format"`
-	TargetFormat string    `json:"target_format"`
-	Ratio        int       `json:"ratio"`
-	Created      time.Time `json:"created"`
-	Updated      time.Time `json:"updated"`
-	Status       string    `json:"status"`
+	ID           string      `json:"id"`
+	UserID       string      `json:"user_id"`
+	SourceID     string      `json:"source_id"`
+	TargetID     string      `json:"target_id"`
+	SourceFormat string      `json:"source_format"`
+	TargetFormat string      `json:"target_format"`
+	Ratio        int         `json:"ratio"`
+	Created      time.Time   `json:"created"`
+	Updated      time.Time   `json:"updated"`
+	Status       string      `json:"status"`
+	Priority     int         `json:"priority"`
+	RetryCount   int         `json:"retry_count"`
+	LastError    string      `json:"last_error,omitempty"`
+	Renditions   []Rendition `json:"renditions,omitempty"`
+	converter.Options
+}
+
+// Rendition represents the additional size of the converted image declared by the request.
+// ImageID is empty until the rendition is processed.
+type Rendition struct {
+	converter.Rendition
+	ImageID string `json:"image_id"`
 }
 
 // RequestsRepository represents repository fro working with requests.
@@ -49,15 +85,110 @@ func NewRequestsRepository(db *sql.DB) (*RequestsRepository, error) {
 	return &RequestsRepository{db: db}, nil
 }
 
-// InsertRequest creates the conversion request and returns its id.
-func (rr *RequestsRepository) InsertRequest(ctx context.Context, userID, sourceID, sourceFormat, targetFormat string, ratio int) (string, error) {
+// InsertRequest creates the conversion request with the default priority and returns its id.
+func (rr *RequestsRepository) InsertRequest(ctx context.Context, userID, sourceID, filename, sourceFormat, targetFormat string, ratio int, opts converter.Options) (string, error) {
+	return insertRequest(ctx, rr.db, userID, "", QueuedRequest{
+		SourceID:     sourceID,
+		Filename:     filename,
+		SourceFormat: sourceFormat,
+		TargetFormat: targetFormat,
+		Ratio:        ratio,
+		Priority:     DefaultPriority,
+		Options:      opts,
+	})
+}
+
+// QueuedRequest represents the conversion request queued through the outbox.
+// The filename given by the user is kept by the request since the source image may be shared by other users.
+type QueuedRequest struct {
+	SourceID     string
+	Filename     string
+	SourceFormat string
+	TargetFormat string
+	Ratio        int
+	Priority     int
+	Options      converter.Options
+	Renditions   []converter.Rendition
+}
+
+// InsertQueuedRequest creates the conversion request together with its renditions and the outbox entry
+// in one transaction, so that the request is sent to the queue by the outbox relay even if the queue is unavailable.
+func (rr *RequestsRepository) InsertQueuedRequest(ctx context.Context, userID, sourceID, filename, sourceFormat, targetFormat string, ratio, priority int, opts converter.Options, renditions []converter.Rendition) (string, error) {
+	tx, err := rr.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("can't begin transaction: %w", err)
+	}
+
+	requestID, err := insertQueuedRequest(ctx, tx, userID, "", QueuedRequest{
+		SourceID:     sourceID,
+		Filename:     filename,
+		SourceFormat: sourceFormat,
+		TargetFormat: targetFormat,
+		Ratio:        ratio,
+		Priority:     priority,
+		Options:      opts,
+		Renditions:   renditions,
+	})
+	if err != nil {
+		_ = tx.Rollback()
+		return "", err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return "", fmt.Errorf("can't commit transaction: %w", err)
+	}
+
+	return requestID, nil
+}
+
+// insertQueuedRequest creates the request of the batch, if any, with its renditions and the outbox entry.
+func insertQueuedRequest(ctx context.Context, q queryer, userID, batchID string, r QueuedRequest) (string, error) {
+	requestID, err := insertRequest(ctx, q, userID, batchID, r)
+	if err != nil {
+		return "", err
+	}
+
+	for _, rendition := range r.Renditions {
+		if err = insertRendition(ctx, q, requestID, rendition); err != nil {
+			return "", err
+		}
+	}
+
+	const query = "INSERT INTO converter.outbox (request_id) VALUES ($1);"
+	_, err = q.ExecContext(ctx, query, requestID)
+	if err != nil {
+		return "", fmt.Errorf("can't insert outbox entry: %w", err)
+	}
+
+	return requestID, nil
+}
+
+// queryer is implemented by both *sql.DB and *sql.Tx.
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func insertRequest(ctx context.Context, q queryer, userID, batchID string, r QueuedRequest) (string, error) {
 	var requestID string
+
+	opts := r.Options
+	var crop converter.Crop
+	if opts.Crop != nil {
+		crop = *opts.Crop
+	}
+
 	const query = `INSERT INTO converter.requests 
-		(user_id, source_id, target_id, source_format, target_format, ratio, status)
-		VALUES ($1, $2, NULL, $3, $4, $5, 'queued') 
+		(user_id, source_id, filename, target_id, source_format, target_format, ratio, status,
+		width, height, fit, crop_x, crop_y, crop_width, crop_height, rotation, flip, metadata, priority, batch_id)
+		VALUES ($1, $2, $3, NULL, $4, $5, $6, 'queued', $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18) 
 		RETURNING id;`
 
-	err := rr.db.QueryRowContext(ctx, query, userID, sourceID, sourceFormat, targetFormat, ratio).Scan(&requestID)
+	err := q.QueryRowContext(ctx, query, userID, r.SourceID, r.Filename, r.SourceFormat, r.TargetFormat, r.Ratio,
+		nullInt(opts.Width), nullInt(opts.Height), nullString(opts.Fit),
+		nullInt(crop.X), nullInt(crop.Y), nullInt(crop.Width), nullInt(crop.Height),
+		nullInt(opts.Rotation), nullString(opts.Flip), nullString(opts.Metadata), r.Priority, nullString(batchID)).Scan(&requestID)
 	if err != nil {
 		return "", fmt.Errorf("can't make request: %w", err)
 	}
@@ -65,13 +196,68 @@ func (rr *RequestsRepository) InsertRequest(ctx context.Context, userID, sourceI
 	return requestID, nil
 }
 
+// requestColumns lists the columns scanned by scanRequest.
+const requestColumns = `id, user_id, source_id, target_id, source_format, target_format, ratio, status, created, updated,
+	coalesce(width, 0), coalesce(height, 0), coalesce(fit, ''),
+	coalesce(crop_x, 0), coalesce(crop_y, 0), coalesce(crop_width, 0), coalesce(crop_height, 0),
+	coalesce(rotation, 0), coalesce(flip, ''), coalesce(metadata, ''),
+	retry_count, coalesce(last_error, ''), priority`
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanRequest scans the conversion request selected with requestColumns.
+func scanRequest(row rowScanner) (ConversionRequest, error) {
+	var request ConversionRequest
+	var targetIDNull sql.NullString
+	var crop converter.Crop
+
+	err := row.Scan(
+		&request.ID,
+		&request.UserID,
+		&request.SourceID,
+		&targetIDNull,
+		&request.SourceFormat,
+		&request.TargetFormat,
+		&request.Ratio,
+		&request.Status,
+		&request.Created,
+		&request.Updated,
+		&request.Width,
+		&request.Height,
+		&request.Fit,
+		&crop.X,
+		&crop.Y,
+		&crop.Width,
+		&crop.Height,
+		&request.Rotation,
+		&request.Flip,
+		&request.Metadata,
+		&request.RetryCount,
+		&request.LastError,
+		&request.Priority)
+	if err != nil {
+		return ConversionRequest{}, err
+	}
+
+	if targetIDNull.Valid {
+		request.TargetID = targetIDNull.String
+	}
+
+	if crop.Width > 0 {
+		request.Crop = &crop
+	}
+
+	return request, nil
+}
+
 // GetRequestsByUserID gets the information about requests by given user id.
 func (rr *RequestsRepository) GetRequestsByUserID(ctx context.Context, userID string) ([]ConversionRequest, error) {
 	var requests []ConversionRequest
-	var request ConversionRequest
-	var targetIDNull sql.NullString
-	const query = `SELECT id, user_id, source_id, target_id, source_format, target_format, ratio, status, created, updated
-		FROM converter.requests WHERE user_id = $1;`
+
+	const query = "SELECT " + requestColumns + " FROM converter.requests WHERE user_id = $1;"
 
 	rows, err := rr.db.QueryContext(ctx, query, userID)
 	if err != nil {
@@ -80,25 +266,11 @@ func (rr *RequestsRepository) GetRequestsByUserID(ctx context.Context, userID st
 	defer rows.Close()
 
 	for rows.Next() {
-		err = rows.Scan(
-			&request.ID,
-			&request.UserID,
-			&request.SourceID,
-			&targetIDNull,
-			&request.SourceFormat,
-			&request.TargetFormat,
-			&request.Ratio,
-			&request.Status,
-			&request.Created,
-			&request.Updated)
+		request, err := scanRequest(rows)
 		if err != nil {
 			return nil, fmt.Errorf("can't scan user request from rows: %w", err)
 		}
-		if targetIDNull.Valid {
-			request.TargetID = targetIDNull.String
-		} else {
-			request.TargetID = ""
-		}
+
 		requests = append(requests, request)
 	}
 
@@ -106,9 +278,134 @@ func (rr *RequestsRepository) GetRequestsByUserID(ctx context.Context, userID st
 		return requests, fmt.Errorf("error selecting rows: %w", err)
 	}
 
+	renditions, err := rr.getRenditions(ctx, "r.user_id = $1", userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range requests {
+		requests[i].Renditions = renditions[requests[i].ID]
+	}
+
 	return requests, nil
 }
 
+// GetRequestByID gets the user's conversion request by its id.
+func (rr *RequestsRepository) GetRequestByID(ctx context.Context, userID, requestID string) (ConversionRequest, error) {
+	const query = "SELECT " + requestColumns + " FROM converter.requests WHERE id = $1 AND user_id = $2;"
+
+	request, err := scanRequest(rr.db.QueryRowContext(ctx, query, requestID, userID))
+	if err == sql.ErrNoRows {
+		return ConversionRequest{}, ErrNoSuchRequest
+	}
+	if err != nil {
+		return ConversionRequest{}, fmt.Errorf("can't get request: %w", err)
+	}
+
+	renditions, err := rr.getRenditions(ctx, "r.id = $1", requestID)
+	if err != nil {
+		return ConversionRequest{}, err
+	}
+	request.Renditions = renditions[request.ID]
+
+	return request, nil
+}
+
+// getRenditions gets the renditions of the requests matching the condition grouped by request id.
+func (rr *RequestsRepository) getRenditions(ctx context.Context, condition string, arg string) (map[string][]Rendition, error) {
+	query := `SELECT rd.request_id, rd.name, coalesce(rd.width, 0), coalesce(rd.height, 0), rd.format, rd.ratio,
+		coalesce(rd.image_id::text, '')
+		FROM converter.renditions rd
+		JOIN converter.requests r ON r.id = rd.request_id
+		WHERE ` + condition + `
+		ORDER BY rd.name;`
+
+	rows, err := rr.db.QueryContext(ctx, query, arg)
+	if err != nil {
+		return nil, fmt.Errorf("can't get request renditions: %w", err)
+	}
+	defer rows.Close()
+
+	renditions := make(map[string][]Rendition)
+	for rows.Next() {
+		var requestID string
+		var rendition Rendition
+		err = rows.Scan(
+			&requestID,
+			&rendition.Name,
+			&rendition.Width,
+			&rendition.Height,
+			&rendition.Format,
+			&rendition.Ratio,
+			&rendition.ImageID)
+		if err != nil {
+			return nil, fmt.Errorf("can't scan request rendition from rows: %w", err)
+		}
+		renditions[requestID] = append(renditions[requestID], rendition)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error selecting rows: %w", err)
+	}
+
+	return renditions, nil
+}
+
+// InsertRenditions declares the renditions of the request.
+func (rr *RequestsRepository) InsertRenditions(ctx context.Context, requestID string, renditions []converter.Rendition) error {
+	if len(renditions) == 0 {
+		return nil
+	}
+
+	tx, err := rr.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("can't begin transaction: %w", err)
+	}
+
+	for _, r := range renditions {
+		if err = insertRendition(ctx, tx, requestID, r); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("can't commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func insertRendition(ctx context.Context, q queryer, requestID string, r converter.Rendition) error {
+	const query = `INSERT INTO converter.renditions (request_id, name, width, height, format, ratio)
+		VALUES ($1, $2, $3, $4, $5, $6);`
+
+	_, err := q.ExecContext(ctx, query, requestID, r.Name, nullInt(r.Width), nullInt(r.Height), r.Format, r.Ratio)
+	if err != nil {
+		return fmt.Errorf("can't insert rendition %s: %w", r.Name, err)
+	}
+
+	return nil
+}
+
+// UpdateRendition links the processed rendition with its image.
+func (rr *RequestsRepository) UpdateRendition(ctx context.Context, requestID, name, imageID string) error {
+	const query = "UPDATE converter.renditions SET image_id=$3 WHERE request_id=$1 AND name=$2;"
+	res, err := rr.db.ExecContext(ctx, query, requestID, name, imageID)
+	if err != nil {
+		return fmt.Errorf("can't update rendition: %w", err)
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("can't get the number of rows affected by an update: %w", err)
+	}
+	if count == 0 {
+		return ErrNoSuchRequest
+	}
+
+	return nil
+}
+
 // UpdateRequest updates the request status and the id of the target image.
 func (rr *RequestsRepository) UpdateRequest(ctx context.Context, requestID, status, targetID string) error {
 	var sqlTargetID sql.NullString
@@ -132,3 +429,238 @@ func (rr *RequestsRepository) UpdateRequest(ctx context.Context, requestID, stat
 
 	return nil
 }
+
+// ReuseConversion completes the request with the target image of the done request converting the same source
+// with the same parameters, so that the converter doesn't run again, the reused image gets one more reference.
+// It returns the id of the reused image, or an empty string if there is no such request
+// or the request declares renditions.
+func (rr *RequestsRepository) ReuseConversion(ctx context.Context, requestID string) (string, error) {
+	tx, err := rr.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("can't begin transaction: %w", err)
+	}
+
+	var targetID string
+	const findQuery = `SELECT p.target_id FROM converter.requests r
+		JOIN converter.requests p
+		ON p.source_id = r.source_id AND p.id <> r.id AND p.status = 'done' AND p.target_id IS NOT NULL
+		AND p.target_format = r.target_format AND p.ratio = r.ratio
+		AND p.width IS NOT DISTINCT FROM r.width AND p.height IS NOT DISTINCT FROM r.height
+		AND p.fit IS NOT DISTINCT FROM r.fit
+		AND p.crop_x IS NOT DISTINCT FROM r.crop_x AND p.crop_y IS NOT DISTINCT FROM r.crop_y
+		AND p.crop_width IS NOT DISTINCT FROM r.crop_width AND p.crop_height IS NOT DISTINCT FROM r.crop_height
+		AND p.rotation IS NOT DISTINCT FROM r.rotation AND p.flip IS NOT DISTINCT FROM r.flip
+		AND p.metadata IS NOT DISTINCT FROM r.metadata
+		WHERE r.id = $1 AND NOT EXISTS (SELECT 1 FROM converter.renditions rd WHERE rd.request_id = r.id)
+		LIMIT 1;`
+
+	err = tx.QueryRowContext(ctx, findQuery, requestID).Scan(&targetID)
+	if err == sql.ErrNoRows {
+		_ = tx.Rollback()
+		return "", nil
+	}
+	if err != nil {
+		_ = tx.Rollback()
+		return "", fmt.Errorf("can't find equal conversion: %w", err)
+	}
+
+	// The image without references or expired is being deleted, the request is converted as usual then.
+	const refQuery = "UPDATE converter.images SET refs = refs + 1, updated = default WHERE id = $1 AND refs > 0 AND deleted IS NULL;"
+	res, err := tx.ExecContext(ctx, refQuery, targetID)
+	if err != nil {
+		_ = tx.Rollback()
+		return "", fmt.Errorf("can't reference image: %w", err)
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		_ = tx.Rollback()
+		return "", fmt.Errorf("can't get the number of rows affected by an update: %w", err)
+	}
+	if count == 0 {
+		_ = tx.Rollback()
+		return "", nil
+	}
+
+	const updateQuery = "UPDATE converter.requests SET target_id=$2, status='done', updated=default WHERE id=$1;"
+	_, err = tx.ExecContext(ctx, updateQuery, requestID, targetID)
+	if err != nil {
+		_ = tx.Rollback()
+		return "", fmt.Errorf("can't update request: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return "", fmt.Errorf("can't commit transaction: %w", err)
+	}
+
+	return targetID, nil
+}
+
+// UpdateRequestError records the processing error of the request together with the number of retries made
+// and sets the status, queued while the request waits for the next retry or failed when the retries are exhausted.
+func (rr *RequestsRepository) UpdateRequestError(ctx context.Context, requestID, status string, retryCount int, lastError string) error {
+	const query = "UPDATE converter.requests SET status=$2, retry_count=$3, last_error=$4, updated=default WHERE id=$1;"
+	res, err := rr.db.ExecContext(ctx, query, requestID, status, retryCount, nullString(lastError))
+	if err != nil {
+		return fmt.Errorf("can't update request error: %w", err)
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("can't get the number of rows affected by an update: %w", err)
+	}
+	if count == 0 {
+		return ErrNoSuchRequest
+	}
+
+	return nil
+}
+
+// DeleteRequest deletes the user's request with its renditions and webhooks, the request has to be done or failed.
+// Its images lose a reference: the images not used by any request anymore are marked deleted
+// and their ids are returned, their files have to be removed from the storage.
+func (rr *RequestsRepository) DeleteRequest(ctx context.Context, userID, requestID string) ([]string, error) {
+	return rr.deleteRequests(ctx, userID, "r.id = $2", requestID, ErrNoSuchRequest)
+}
+
+// DeleteImageRequests deletes the user's requests using the image as the source, the target or the rendition
+// the same way as DeleteRequest.
+func (rr *RequestsRepository) DeleteImageRequests(ctx context.Context, userID, imageID string) ([]string, error) {
+	const condition = `(r.source_id = $2 OR r.target_id = $2
+		OR EXISTS (SELECT 1 FROM converter.renditions rd WHERE rd.request_id = r.id AND rd.image_id = $2))`
+	return rr.deleteRequests(ctx, userID, condition, imageID, ErrNoSuchImage)
+}
+
+// DeleteUserRequests deletes all the user's requests the same way as DeleteRequest,
+// the user without requests is not an error.
+func (rr *RequestsRepository) DeleteUserRequests(ctx context.Context, userID string) ([]string, error) {
+	return rr.deleteRequests(ctx, userID, "r.user_id = $2", userID, nil)
+}
+
+// deleteRequests deletes the user's requests matching the condition.
+// If there are none, notFound is returned, the nil notFound makes it a no-op.
+func (rr *RequestsRepository) deleteRequests(ctx context.Context, userID, condition, arg string, notFound error) ([]string, error) {
+	tx, err := rr.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("can't begin transaction: %w", err)
+	}
+
+	requestIDs, err := lockFinishedRequests(ctx, tx, userID, condition, arg)
+	if err == nil && len(requestIDs) == 0 {
+		if notFound == nil {
+			return nil, tx.Rollback()
+		}
+		err = notFound
+	}
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+
+	// Every use of the image by the requests is one reference.
+	const releaseQuery = `UPDATE converter.images i SET refs = greatest(i.refs - u.uses, 0), updated = default
+		FROM (SELECT image_id, count(*) AS uses FROM (
+			SELECT source_id AS image_id FROM converter.requests WHERE id = ANY($1)
+			UNION ALL SELECT target_id FROM converter.requests WHERE id = ANY($1) AND target_id IS NOT NULL
+			UNION ALL SELECT image_id FROM converter.renditions WHERE request_id = ANY($1) AND image_id IS NOT NULL
+		) images GROUP BY image_id) u
+		WHERE i.id = u.image_id
+		RETURNING i.id;`
+
+	imageIDs, err := queryIDs(ctx, tx, releaseQuery, pq.Array(requestIDs))
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, fmt.Errorf("can't release images: %w", err)
+	}
+
+	// The outbox entries and the jobs of the requests are deleted by the foreign keys.
+	deleteQueries := []string{
+		"DELETE FROM converter.renditions WHERE request_id = ANY($1);",
+		"DELETE FROM converter.webhook_deliveries WHERE request_id = ANY($1);",
+		"DELETE FROM converter.webhooks WHERE request_id = ANY($1);",
+		"DELETE FROM converter.requests WHERE id = ANY($1);",
+	}
+	for _, query := range deleteQueries {
+		if _, err = tx.ExecContext(ctx, query, pq.Array(requestIDs)); err != nil {
+			_ = tx.Rollback()
+			return nil, fmt.Errorf("can't delete requests: %w", err)
+		}
+	}
+
+	// The image referenced by the upload that hasn't created its request yet is kept.
+	const markQuery = `UPDATE converter.images i SET deleted = coalesce(i.deleted, current_timestamp), updated = default
+		WHERE i.id = ANY($1) AND i.refs = 0
+		AND NOT EXISTS (SELECT 1 FROM converter.requests r WHERE ` + usesImageCondition + `)
+		RETURNING i.id;`
+
+	deletedIDs, err := queryIDs(ctx, tx, markQuery, pq.Array(imageIDs))
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, fmt.Errorf("can't mark images deleted: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("can't commit transaction: %w", err)
+	}
+
+	return deletedIDs, nil
+}
+
+// lockFinishedRequests locks the user's requests matching the condition and returns their ids,
+// ErrRequestInProgress is returned if any of them is not done or failed yet.
+func lockFinishedRequests(ctx context.Context, q queryer, userID, condition, arg string) ([]string, error) {
+	query := "SELECT r.id, r.status FROM converter.requests r WHERE r.user_id = $1 AND " + condition + " FOR UPDATE;"
+
+	rows, err := q.QueryContext(ctx, query, userID, arg)
+	if err != nil {
+		return nil, fmt.Errorf("can't get requests: %w", err)
+	}
+	defer rows.Close()
+
+	var requestIDs []string
+	for rows.Next() {
+		var requestID, status string
+		if err = rows.Scan(&requestID, &status); err != nil {
+			return nil, fmt.Errorf("can't scan request from rows: %w", err)
+		}
+		if !IsFinalStatus(status) {
+			return nil, ErrRequestInProgress
+		}
+		requestIDs = append(requestIDs, requestID)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error selecting rows: %w", err)
+	}
+
+	return requestIDs, nil
+}
+
+// queryIDs returns the ids selected by the query.
+func queryIDs(ctx context.Context, q queryer, query string, args ...interface{}) ([]string, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// nullInt converts zero values to SQL NULL.
+func nullInt(v int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(v), Valid: v != 0}
+}
+
+// nullString converts empty strings to SQL NULL.
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
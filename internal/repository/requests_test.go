@@ -5,7 +5,9 @@ import (
 	"database/sql"
 	"fmt"
 	"testing"
+	"time"
 
+	"github.com/Konstantsiy/image-converter/internal/converter"
 	"github.com/stretchr/testify/require"
 
 	"github.com/DATA-DOG/go-sqlmock"
@@ -62,6 +64,7 @@ func TestRequestsRepository_InsertRequest(t *testing.T) {
 		sourceFormat string
 		targetFormat string
 		ratio        int
+		opts         converter.Options
 	}
 
 	requestsRepo, err := NewRequestsRepository(db)
@@ -89,7 +92,36 @@ func TestRequestsRepository_InsertRequest(t *testing.T) {
 			mockBehavior: func(args input) {
 				rows := sqlmock.NewRows([]string{"id"}).AddRow("1")
 				mock.ExpectQuery(query).
-					WithArgs(args.userID, args.sourceID, args.sourceFormat, args.targetFormat, args.ratio).
+					WithArgs(args.userID, args.sourceID, "cat", args.sourceFormat, args.targetFormat, args.ratio,
+						nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, DefaultPriority, nil).
+					WillReturnRows(rows)
+			},
+			isErrorExpected: false,
+		},
+		{
+			name: "Ok with options",
+			args: input{
+				userID:       "1",
+				sourceID:     "1",
+				sourceFormat: "jpg",
+				targetFormat: "webp",
+				ratio:        80,
+				opts: converter.Options{
+					Width:    100,
+					Height:   50,
+					Fit:      converter.FitCover,
+					Crop:     &converter.Crop{X: 5, Y: 0, Width: 20, Height: 10},
+					Rotation: 90,
+					Flip:     converter.FlipVertical,
+					Metadata: converter.MetadataKeep,
+				},
+			},
+			expectedRequestID: "2",
+			mockBehavior: func(args input) {
+				rows := sqlmock.NewRows([]string{"id"}).AddRow("2")
+				mock.ExpectQuery(query).
+					WithArgs(args.userID, args.sourceID, "cat", args.sourceFormat, args.targetFormat, args.ratio,
+						100, 50, "cover", 5, nil, 20, 10, 90, "vertical", "keep", DefaultPriority, nil).
 					WillReturnRows(rows)
 			},
 			isErrorExpected: false,
@@ -106,7 +138,8 @@ func TestRequestsRepository_InsertRequest(t *testing.T) {
 			mockBehavior: func(args input) {
 				rows := sqlmock.NewRows([]string{"id"})
 				mock.ExpectQuery(query).
-					WithArgs(args.userID, args.sourceID, args.sourceFormat, args.targetFormat, args.ratio).
+					WithArgs(args.userID, args.sourceID, "cat", args.sourceFormat, args.targetFormat, args.ratio,
+						nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, DefaultPriority, nil).
 					WillReturnRows(rows)
 			},
 			isErrorExpected: true,
@@ -117,7 +150,7 @@ func TestRequestsRepository_InsertRequest(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			tc.mockBehavior(tc.args)
 			result, err := requestsRepo.InsertRequest(context.TODO(),
-				tc.args.userID, tc.args.sourceID, tc.args.sourceFormat, tc.args.targetFormat, tc.args.ratio)
+				tc.args.userID, tc.args.sourceID, "cat", tc.args.sourceFormat, tc.args.targetFormat, tc.args.ratio, tc.args.opts)
 			if tc.isErrorExpected {
 				assert.Error(t, err)
 			} else {
@@ -228,3 +261,465 @@ func TestRequestsRepository_UpdateRequest(t *testing.T) {
 		})
 	}
 }
+
+func TestRequestsRepository_InsertRenditions(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%v' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	requestsRepo, err := NewRequestsRepository(db)
+	require.NoError(t, err)
+
+	const query = `INSERT INTO converter.renditions (.+)`
+
+	renditions := []converter.Rendition{
+		{Name: "small", Width: 100, Height: 100, Format: "webp", Ratio: 80},
+		{Name: "large", Width: 1200, Format: "jpg", Ratio: 90},
+	}
+
+	testTable := []struct {
+		name            string
+		renditions      []converter.Rendition
+		mockBehavior    func()
+		isErrorExpected bool
+	}{
+		{
+			name:         "No renditions",
+			mockBehavior: func() {},
+		},
+		{
+			name:       "Ok",
+			renditions: renditions,
+			mockBehavior: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(query).
+					WithArgs("1", "small", 100, 100, "webp", 80).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(query).
+					WithArgs("1", "large", 1200, nil, "jpg", 90).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name:       "Database error",
+			renditions: renditions,
+			mockBehavior: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(query).
+					WithArgs("1", "small", 100, 100, "webp", 80).
+					WillReturnError(fmt.Errorf("duplicate rendition name"))
+				mock.ExpectRollback()
+			},
+			isErrorExpected: true,
+		},
+	}
+
+	for _, tc := range testTable {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.mockBehavior()
+			err := requestsRepo.InsertRenditions(context.TODO(), "1", tc.renditions)
+			if tc.isErrorExpected {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestRequestsRepository_UpdateRendition(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%v' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	requestsRepo, err := NewRequestsRepository(db)
+	require.NoError(t, err)
+
+	const query = `UPDATE converter.renditions SET (.+)`
+
+	testTable := []struct {
+		name          string
+		mockBehavior  func()
+		expectedError error
+	}{
+		{
+			name: "Ok",
+			mockBehavior: func() {
+				mock.ExpectExec(query).
+					WithArgs("1", "small", "123").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			name: "No such rendition",
+			mockBehavior: func() {
+				mock.ExpectExec(query).
+					WithArgs("1", "small", "123").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			expectedError: ErrNoSuchRequest,
+		},
+	}
+
+	for _, tc := range testTable {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.mockBehavior()
+			err := requestsRepo.UpdateRendition(context.TODO(), "1", "small", "123")
+			assert.Equal(t, tc.expectedError, err)
+		})
+	}
+}
+
+func TestRequestsRepository_GetRequestByID(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%v' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	requestsRepo, err := NewRequestsRepository(db)
+	require.NoError(t, err)
+
+	const (
+		requestQuery    = `SELECT (.+) FROM converter.requests WHERE id = (.+) AND user_id = (.+)`
+		renditionsQuery = `SELECT (.+) FROM converter.renditions (.+) WHERE r.id = (.+)`
+	)
+
+	columns := []string{"id", "user_id", "source_id", "target_id", "source_format", "target_format", "ratio",
+		"status", "created", "updated", "width", "height", "fit", "crop_x", "crop_y", "crop_width", "crop_height",
+		"rotation", "flip", "metadata", "retry_count", "last_error", "priority"}
+	created := time.Date(2021, 11, 6, 21, 35, 7, 0, time.UTC)
+
+	testTable := []struct {
+		name            string
+		mockBehavior    func()
+		expected        ConversionRequest
+		expectedError   error
+		isErrorExpected bool
+	}{
+		{
+			name: "Ok",
+			mockBehavior: func() {
+				mock.ExpectQuery(requestQuery).
+					WithArgs("1", "2").
+					WillReturnRows(sqlmock.NewRows(columns).AddRow("1", "2", "3", nil, "jpg", "png", 90,
+						"queued", created, created, 100, 0, "", 0, 0, 0, 0, 90, "", "", 1, "s3 error: timeout", 9))
+				mock.ExpectQuery(renditionsQuery).
+					WithArgs("1").
+					WillReturnRows(sqlmock.NewRows([]string{"request_id", "name", "width", "height", "format", "ratio", "image_id"}).
+						AddRow("1", "small", 50, 0, "webp", 80, ""))
+			},
+			expected: ConversionRequest{ID: "1", UserID: "2", SourceID: "3", SourceFormat: "jpg", TargetFormat: "png",
+				Ratio: 90, Status: "queued", Priority: 9, RetryCount: 1, LastError: "s3 error: timeout", Created: created, Updated: created,
+				Renditions: []Rendition{{Rendition: converter.Rendition{Name: "small", Width: 50, Format: "webp", Ratio: 80}}},
+				Options:    converter.Options{Width: 100, Rotation: 90}},
+		},
+		{
+			name: "No such request",
+			mockBehavior: func() {
+				mock.ExpectQuery(requestQuery).
+					WithArgs("1", "2").
+					WillReturnRows(sqlmock.NewRows(columns))
+			},
+			expectedError:   ErrNoSuchRequest,
+			isErrorExpected: true,
+		},
+		{
+			name: "Cannot get request",
+			mockBehavior: func() {
+				mock.ExpectQuery(requestQuery).
+					WithArgs("1", "2").
+					WillReturnError(fmt.Errorf("connection refused"))
+			},
+			isErrorExpected: true,
+		},
+	}
+
+	for _, tc := range testTable {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.mockBehavior()
+			request, err := requestsRepo.GetRequestByID(context.TODO(), "2", "1")
+			if tc.isErrorExpected {
+				assert.Error(t, err)
+				if tc.expectedError != nil {
+					assert.Equal(t, tc.expectedError, err)
+				}
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expected, request)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestRequestsRepository_UpdateRequestError(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%v' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	requestsRepo, err := NewRequestsRepository(db)
+	require.NoError(t, err)
+
+	const query = `UPDATE converter.requests SET status=(.+), retry_count=(.+), last_error=(.+)`
+
+	testTable := []struct {
+		name            string
+		mockBehavior    func()
+		expectedError   error
+		isErrorExpected bool
+	}{
+		{
+			name: "Ok",
+			mockBehavior: func() {
+				mock.ExpectExec(query).
+					WithArgs("1", RequestStatusQueued, 2, "s3 error").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			name: "No such request",
+			mockBehavior: func() {
+				mock.ExpectExec(query).
+					WithArgs("1", RequestStatusQueued, 2, "s3 error").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			expectedError:   ErrNoSuchRequest,
+			isErrorExpected: true,
+		},
+		{
+			name: "Cannot update request",
+			mockBehavior: func() {
+				mock.ExpectExec(query).
+					WithArgs("1", RequestStatusQueued, 2, "s3 error").
+					WillReturnError(fmt.Errorf("connection refused"))
+			},
+			isErrorExpected: true,
+		},
+	}
+
+	for _, tc := range testTable {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.mockBehavior()
+			err := requestsRepo.UpdateRequestError(context.TODO(), "1", RequestStatusQueued, 2, "s3 error")
+			if tc.isErrorExpected {
+				assert.Error(t, err)
+				if tc.expectedError != nil {
+					assert.Equal(t, tc.expectedError, err)
+				}
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestRequestsRepository_ReuseConversion(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%v' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	requestsRepo, err := NewRequestsRepository(db)
+	require.NoError(t, err)
+
+	const (
+		findQuery    = `SELECT p.target_id FROM converter.requests r (.+)`
+		refQuery     = `UPDATE converter.images SET refs = refs \+ 1(.+)`
+		requestQuery = `UPDATE converter.requests SET target_id(.+)`
+	)
+
+	testTable := []struct {
+		name             string
+		mockBehavior     func()
+		expectedTargetID string
+		isErrorExpected  bool
+	}{
+		{
+			name: "Ok",
+			mockBehavior: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(findQuery).WithArgs("1").
+					WillReturnRows(sqlmock.NewRows([]string{"target_id"}).AddRow("2"))
+				mock.ExpectExec(refQuery).WithArgs("2").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(requestQuery).WithArgs("1", "2").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			expectedTargetID: "2",
+		},
+		{
+			name: "No equal conversion",
+			mockBehavior: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(findQuery).WithArgs("1").WillReturnRows(sqlmock.NewRows([]string{"target_id"}))
+				mock.ExpectRollback()
+			},
+		},
+		{
+			name: "Image is being deleted",
+			mockBehavior: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(findQuery).WithArgs("1").
+					WillReturnRows(sqlmock.NewRows([]string{"target_id"}).AddRow("2"))
+				mock.ExpectExec(refQuery).WithArgs("2").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+			},
+		},
+		{
+			name: "Database error",
+			mockBehavior: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(findQuery).WithArgs("1").WillReturnError(fmt.Errorf("connection refused"))
+				mock.ExpectRollback()
+			},
+			isErrorExpected: true,
+		},
+	}
+
+	for _, tc := range testTable {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.mockBehavior()
+			targetID, err := requestsRepo.ReuseConversion(context.TODO(), "1")
+			if tc.isErrorExpected {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedTargetID, targetID)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestRequestsRepository_DeleteRequest(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%v' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	requestsRepo, err := NewRequestsRepository(db)
+	require.NoError(t, err)
+
+	const (
+		lockQuery    = `SELECT r.id, r.status FROM converter.requests r (.+) FOR UPDATE`
+		releaseQuery = `UPDATE converter.images i SET refs (.+) RETURNING i.id`
+		deleteQuery  = `DELETE FROM converter.(.+)`
+		markQuery    = `UPDATE converter.images i SET deleted (.+) RETURNING i.id`
+	)
+
+	testTable := []struct {
+		name             string
+		mockBehavior     func()
+		expectedImageIDs []string
+		expectedError    error
+	}{
+		{
+			name: "Ok",
+			mockBehavior: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockQuery).WithArgs("2", "1").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "status"}).AddRow("1", RequestStatusDone))
+				mock.ExpectQuery(releaseQuery).WithArgs(sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("11").AddRow("12"))
+				for i := 0; i < 4; i++ {
+					mock.ExpectExec(deleteQuery).WithArgs(sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+				}
+				mock.ExpectQuery(markQuery).WithArgs(sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("12"))
+				mock.ExpectCommit()
+			},
+			expectedImageIDs: []string{"12"},
+		},
+		{
+			name: "Request is processing",
+			mockBehavior: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockQuery).WithArgs("2", "1").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "status"}).AddRow("1", RequestStatusProcessing))
+				mock.ExpectRollback()
+			},
+			expectedError: ErrRequestInProgress,
+		},
+		{
+			name: "No such request",
+			mockBehavior: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockQuery).WithArgs("2", "1").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "status"}))
+				mock.ExpectRollback()
+			},
+			expectedError: ErrNoSuchRequest,
+		},
+	}
+
+	for _, tc := range testTable {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.mockBehavior()
+			imageIDs, err := requestsRepo.DeleteRequest(context.TODO(), "2", "1")
+			assert.Equal(t, tc.expectedError, err)
+			assert.Equal(t, tc.expectedImageIDs, imageIDs)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestRequestsRepository_DeleteUserRequests(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%v' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	requestsRepo, err := NewRequestsRepository(db)
+	require.NoError(t, err)
+
+	const lockQuery = `SELECT r.id, r.status FROM converter.requests r WHERE r.user_id = \$1 AND r.user_id = \$2 FOR UPDATE`
+
+	testTable := []struct {
+		name          string
+		mockBehavior  func()
+		expectedError error
+	}{
+		{
+			name: "No requests",
+			mockBehavior: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockQuery).WithArgs("2", "2").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "status"}))
+				mock.ExpectRollback()
+			},
+		},
+		{
+			name: "Request is queued",
+			mockBehavior: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockQuery).WithArgs("2", "2").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "status"}).
+						AddRow("1", RequestStatusDone).AddRow("3", RequestStatusQueued))
+				mock.ExpectRollback()
+			},
+			expectedError: ErrRequestInProgress,
+		},
+	}
+
+	for _, tc := range testTable {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.mockBehavior()
+			imageIDs, err := requestsRepo.DeleteUserRequests(context.TODO(), "2")
+			assert.Equal(t, tc.expectedError, err)
+			assert.Empty(t, imageIDs)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
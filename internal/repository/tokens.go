@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrInvalidRefreshToken notifies that the refresh token is unknown, expired or revoked.
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+
+	// ErrRefreshTokenReused notifies that the rotated refresh token is used again, its family is revoked.
+	ErrRefreshTokenReused = errors.New("refresh token has already been used, the session is revoked")
+)
+
+// RefreshTokensRepository represents repository for working with the refresh tokens.
+// Every refresh token is used once: it's rotated to the new token of the same family, the family is the login session.
+type RefreshTokensRepository struct {
+	db *sql.DB
+}
+
+// NewRefreshTokensRepository creates new refresh tokens repository.
+func NewRefreshTokensRepository(db *sql.DB) (*RefreshTokensRepository, error) {
+	if db == nil {
+		return nil, ErrEmptySQLDriver
+	}
+	return &RefreshTokensRepository{db: db}, nil
+}
+
+// InsertRefreshToken stores the hash of the user's refresh token starting a new family.
+// The expired tokens of the user are deleted on the way.
+func (tr *RefreshTokensRepository) InsertRefreshToken(ctx context.Context, userID, tokenHash string, ttl time.Duration) error {
+	const query = `WITH expired AS (
+			DELETE FROM converter.refresh_tokens WHERE user_id = $1 AND expires < now()
+		)
+		INSERT INTO converter.refresh_tokens (user_id, family_id, token_hash, expires)
+		VALUES ($1, uuid_generate_v1(), $2, now() + $3 * interval '1 millisecond');`
+
+	_, err := tr.db.ExecContext(ctx, query, userID, tokenHash, ttl.Milliseconds())
+	if err != nil {
+		return fmt.Errorf("can't insert refresh token: %w", err)
+	}
+
+	return nil
+}
+
+// RotateRefreshToken marks the refresh token used and stores the new token of the same family instead,
+// the user id of the token is returned. If the token has been used already, it's likely stolen:
+// the whole family is revoked and ErrRefreshTokenReused is returned.
+func (tr *RefreshTokensRepository) RotateRefreshToken(ctx context.Context, tokenHash, newTokenHash string, ttl time.Duration) (string, error) {
+	tx, err := tr.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("can't begin transaction: %w", err)
+	}
+
+	const selectQuery = `SELECT user_id, family_id, expires < now(), used IS NOT NULL, revoked IS NOT NULL
+		FROM converter.refresh_tokens WHERE token_hash = $1 FOR UPDATE;`
+
+	var userID, familyID string
+	var expired, used, revoked bool
+	err = tx.QueryRowContext(ctx, selectQuery, tokenHash).Scan(&userID, &familyID, &expired, &used, &revoked)
+	if err == sql.ErrNoRows {
+		_ = tx.Rollback()
+		return "", ErrInvalidRefreshToken
+	}
+	if err != nil {
+		_ = tx.Rollback()
+		return "", fmt.Errorf("can't get refresh token: %w", err)
+	}
+
+	switch {
+	case revoked || expired:
+		_ = tx.Rollback()
+		return "", ErrInvalidRefreshToken
+	case used:
+		if err = revokeFamily(ctx, tx, familyID); err != nil {
+			_ = tx.Rollback()
+			return "", err
+		}
+		if err = tx.Commit(); err != nil {
+			return "", fmt.Errorf("can't commit transaction: %w", err)
+		}
+		return "", ErrRefreshTokenReused
+	}
+
+	const usedQuery = "UPDATE converter.refresh_tokens SET used = now() WHERE token_hash = $1;"
+	if _, err = tx.ExecContext(ctx, usedQuery, tokenHash); err != nil {
+		_ = tx.Rollback()
+		return "", fmt.Errorf("can't mark refresh token used: %w", err)
+	}
+
+	const insertQuery = `INSERT INTO converter.refresh_tokens (user_id, family_id, token_hash, expires)
+		VALUES ($1, $2, $3, now() + $4 * interval '1 millisecond');`
+	if _, err = tx.ExecContext(ctx, insertQuery, userID, familyID, newTokenHash, ttl.Milliseconds()); err != nil {
+		_ = tx.Rollback()
+		return "", fmt.Errorf("can't insert refresh token: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return "", fmt.Errorf("can't commit transaction: %w", err)
+	}
+
+	return userID, nil
+}
+
+// RevokeRefreshToken revokes the family of the refresh token, the unknown or revoked token is ignored.
+func (tr *RefreshTokensRepository) RevokeRefreshToken(ctx context.Context, tokenHash string) error {
+	const query = `UPDATE converter.refresh_tokens SET revoked = now()
+		WHERE family_id = (SELECT family_id FROM converter.refresh_tokens WHERE token_hash = $1) AND revoked IS NULL;`
+
+	_, err := tr.db.ExecContext(ctx, query, tokenHash)
+	if err != nil {
+		return fmt.Errorf("can't revoke refresh token: %w", err)
+	}
+
+	return nil
+}
+
+// revokeFamily revokes all the refresh tokens of the family.
+func revokeFamily(ctx context.Context, q queryer, familyID string) error {
+	const query = "UPDATE converter.refresh_tokens SET revoked = now() WHERE family_id = $1 AND revoked IS NULL;"
+
+	_, err := q.ExecContext(ctx, query, familyID)
+	if err != nil {
+		return fmt.Errorf("can't revoke refresh tokens: %w", err)
+	}
+
+	return nil
+}
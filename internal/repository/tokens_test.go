@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefreshTokensRepository_RotateRefreshToken(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%v' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	tokensRepo, err := NewRefreshTokensRepository(db)
+	require.NoError(t, err)
+
+	const (
+		selectQuery = `SELECT user_id, family_id, (.+) FROM converter.refresh_tokens WHERE token_hash = \$1 FOR UPDATE`
+		usedQuery   = `UPDATE converter.refresh_tokens SET used = now\(\) WHERE token_hash = \$1`
+		insertQuery = `INSERT INTO converter.refresh_tokens (.+) VALUES`
+		revokeQuery = `UPDATE converter.refresh_tokens SET revoked = now\(\) WHERE family_id = \$1`
+	)
+	columns := []string{"user_id", "family_id", "expired", "used", "revoked"}
+
+	testTable := []struct {
+		name           string
+		mockBehavior   func()
+		expectedUserID string
+		expectedError  error
+	}{
+		{
+			name: "Ok",
+			mockBehavior: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(selectQuery).WithArgs("old").
+					WillReturnRows(sqlmock.NewRows(columns).AddRow("1", "2", false, false, false))
+				mock.ExpectExec(usedQuery).WithArgs("old").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(insertQuery).WithArgs("1", "2", "new", int64(48*time.Hour/time.Millisecond)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			expectedUserID: "1",
+		},
+		{
+			name: "Reused token",
+			mockBehavior: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(selectQuery).WithArgs("old").
+					WillReturnRows(sqlmock.NewRows(columns).AddRow("1", "2", false, true, false))
+				mock.ExpectExec(revokeQuery).WithArgs("2").WillReturnResult(sqlmock.NewResult(0, 3))
+				mock.ExpectCommit()
+			},
+			expectedError: ErrRefreshTokenReused,
+		},
+		{
+			name: "Revoked token",
+			mockBehavior: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(selectQuery).WithArgs("old").
+					WillReturnRows(sqlmock.NewRows(columns).AddRow("1", "2", false, true, true))
+				mock.ExpectRollback()
+			},
+			expectedError: ErrInvalidRefreshToken,
+		},
+		{
+			name: "Unknown token",
+			mockBehavior: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(selectQuery).WithArgs("old").WillReturnRows(sqlmock.NewRows(columns))
+				mock.ExpectRollback()
+			},
+			expectedError: ErrInvalidRefreshToken,
+		},
+	}
+
+	for _, tc := range testTable {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.mockBehavior()
+			userID, err := tokensRepo.RotateRefreshToken(context.TODO(), "old", "new", 48*time.Hour)
+			assert.Equal(t, tc.expectedError, err)
+			assert.Equal(t, tc.expectedUserID, userID)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
@@ -71,3 +71,79 @@ func (ur *UsersRepository) GetUserByEmail(ctx context.Context, email string) (Us
 
 	return user, nil
 }
+
+// GetUserPriority gets the priority tier of the user, the conversion requests of the user are queued with it.
+func (ur *UsersRepository) GetUserPriority(ctx context.Context, userID string) (int, error) {
+	var priority int
+	const query = "SELECT priority FROM converter.users WHERE id = $1;"
+
+	err := ur.db.QueryRowContext(ctx, query, userID).Scan(&priority)
+	if err == sql.ErrNoRows {
+		return 0, ErrNoSuchUser
+	}
+	if err != nil {
+		return 0, fmt.Errorf("can't get user priority: %w", err)
+	}
+
+	return priority, nil
+}
+
+// SetUserPriority sets the priority tier of the user with the given email.
+func (ur *UsersRepository) SetUserPriority(ctx context.Context, email string, priority int) error {
+	const query = "UPDATE converter.users SET priority = $2 WHERE email = $1;"
+
+	res, err := ur.db.ExecContext(ctx, query, email, priority)
+	if err != nil {
+		return fmt.Errorf("can't set user priority: %w", err)
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("can't get the number of rows affected by an update: %w", err)
+	}
+	if count == 0 {
+		return ErrNoSuchUser
+	}
+
+	return nil
+}
+
+// DeleteUser deletes the user with the webhooks, the batches and the export jobs, the user's requests
+// have to be deleted before. The ids of the exported files are returned, they have to be removed from the storage.
+// The deletion job of the user is kept to report its status.
+func (ur *UsersRepository) DeleteUser(ctx context.Context, userID string) ([]string, error) {
+	tx, err := ur.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("can't begin transaction: %w", err)
+	}
+
+	const exportsQuery = `WITH deleted AS (
+			DELETE FROM converter.account_jobs WHERE user_id = $1 AND kind = 'export' RETURNING file_id
+		)
+		SELECT file_id FROM deleted WHERE file_id IS NOT NULL;`
+
+	fileIDs, err := queryIDs(ctx, tx, exportsQuery, userID)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, fmt.Errorf("can't delete export jobs: %w", err)
+	}
+
+	// The webhook deliveries are deleted by the foreign key.
+	deleteQueries := []string{
+		"DELETE FROM converter.webhooks WHERE user_id = $1;",
+		"DELETE FROM converter.batches WHERE user_id = $1;",
+		"DELETE FROM converter.users WHERE id = $1;",
+	}
+	for _, query := range deleteQueries {
+		if _, err = tx.ExecContext(ctx, query, userID); err != nil {
+			_ = tx.Rollback()
+			return nil, fmt.Errorf("can't delete user: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("can't commit transaction: %w", err)
+	}
+
+	return fileIDs, nil
+}
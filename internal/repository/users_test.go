@@ -204,3 +204,166 @@ func TestUsersRepository_GetUserByEmail(t *testing.T) {
 		})
 	}
 }
+
+func TestUsersRepository_GetUserPriority(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%v' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	usersRepo, err := NewUsersRepository(db)
+	require.NoError(t, err)
+	const query = "SELECT priority FROM converter.users WHERE id = (.+)"
+
+	testTable := []struct {
+		name             string
+		mockBehavior     func()
+		expectedPriority int
+		expectedError    error
+		isErrorExpected  bool
+	}{
+		{
+			name: "Ok",
+			mockBehavior: func() {
+				mock.ExpectQuery(query).
+					WithArgs("1").
+					WillReturnRows(sqlmock.NewRows([]string{"priority"}).AddRow(7))
+			},
+			expectedPriority: 7,
+		},
+		{
+			name: "No such user",
+			mockBehavior: func() {
+				mock.ExpectQuery(query).
+					WithArgs("1").
+					WillReturnRows(sqlmock.NewRows([]string{"priority"}))
+			},
+			isErrorExpected: true,
+			expectedError:   ErrNoSuchUser,
+		},
+	}
+
+	for _, tc := range testTable {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.mockBehavior()
+			result, err := usersRepo.GetUserPriority(context.TODO(), "1")
+			if tc.isErrorExpected {
+				assert.Equal(t, tc.expectedError, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedPriority, result)
+			}
+		})
+	}
+}
+
+func TestUsersRepository_SetUserPriority(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%v' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	usersRepo, err := NewUsersRepository(db)
+	require.NoError(t, err)
+	const query = "UPDATE converter.users SET priority = (.+) WHERE email = (.+)"
+
+	testTable := []struct {
+		name            string
+		mockBehavior    func()
+		expectedError   error
+		isErrorExpected bool
+	}{
+		{
+			name: "Ok",
+			mockBehavior: func() {
+				mock.ExpectExec(query).WithArgs("test@gmail.com", 7).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			name: "No such user",
+			mockBehavior: func() {
+				mock.ExpectExec(query).WithArgs("test@gmail.com", 7).WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			expectedError:   ErrNoSuchUser,
+			isErrorExpected: true,
+		},
+	}
+
+	for _, tc := range testTable {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.mockBehavior()
+			err := usersRepo.SetUserPriority(context.TODO(), "test@gmail.com", 7)
+			if tc.isErrorExpected {
+				assert.Equal(t, tc.expectedError, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestUsersRepository_DeleteUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%v' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	usersRepo, err := NewUsersRepository(db)
+	require.NoError(t, err)
+
+	const (
+		exportsQuery = `DELETE FROM converter.account_jobs WHERE user_id = \$1 AND kind = 'export' (.+)`
+		deleteQuery  = `DELETE FROM converter.(.+) WHERE (.+) = \$1`
+	)
+
+	testTable := []struct {
+		name            string
+		mockBehavior    func()
+		expectedFileIDs []string
+		isErrorExpected bool
+	}{
+		{
+			name: "Ok",
+			mockBehavior: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(exportsQuery).WithArgs("1").
+					WillReturnRows(sqlmock.NewRows([]string{"file_id"}).AddRow("5"))
+				for i := 0; i < 3; i++ {
+					mock.ExpectExec(deleteQuery).WithArgs("1").WillReturnResult(sqlmock.NewResult(0, 1))
+				}
+				mock.ExpectCommit()
+			},
+			expectedFileIDs: []string{"5"},
+		},
+		{
+			name: "Database error",
+			mockBehavior: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(exportsQuery).WithArgs("1").
+					WillReturnRows(sqlmock.NewRows([]string{"file_id"}))
+				mock.ExpectExec(deleteQuery).WithArgs("1").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(deleteQuery).WithArgs("1").WillReturnError(sql.ErrConnDone)
+				mock.ExpectRollback()
+			},
+			isErrorExpected: true,
+		},
+	}
+
+	for _, tc := range testTable {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.mockBehavior()
+			fileIDs, err := usersRepo.DeleteUser(context.TODO(), "1")
+			if tc.isErrorExpected {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedFileIDs, fileIDs)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
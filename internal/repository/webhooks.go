@@ -0,0 +1,176 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNoSuchWebhook notifies that needed webhook does not exist.
+var ErrNoSuchWebhook = errors.New("webhook with this id does not exist")
+
+// Webhook represents the URL notified when the conversion request is done or failed.
+// Webhooks without request id are notified about every request of the user.
+type Webhook struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	RequestID string    `json:"request_id,omitempty"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"-"`
+	Created   time.Time `json:"created"`
+}
+
+// WebhookDelivery represents a single attempt to deliver the webhook.
+type WebhookDelivery struct {
+	ID         string    `json:"id"`
+	WebhookID  string    `json:"webhook_id"`
+	RequestID  string    `json:"request_id"`
+	Attempt    int       `json:"attempt"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Created    time.Time `json:"created"`
+}
+
+// WebhooksRepository represents repository for working with webhooks.
+type WebhooksRepository struct {
+	db *sql.DB
+}
+
+// NewWebhooksRepository creates new webhooks repository.
+func NewWebhooksRepository(db *sql.DB) (*WebhooksRepository, error) {
+	if db == nil {
+		return nil, ErrEmptySQLDriver
+	}
+	return &WebhooksRepository{db: db}, nil
+}
+
+// InsertWebhook registers the webhook and returns its id.
+// The request id is checked to belong to the user, ErrNoSuchRequest is returned otherwise.
+func (wr *WebhooksRepository) InsertWebhook(ctx context.Context, userID, requestID, url, secret string) (string, error) {
+	var webhookID string
+	const query = `INSERT INTO converter.webhooks (user_id, request_id, url, secret)
+		SELECT $1, $2::uuid, $3, $4
+		WHERE $2::uuid IS NULL OR EXISTS (SELECT 1 FROM converter.requests WHERE id = $2::uuid AND user_id = $1)
+		RETURNING id;`
+
+	err := wr.db.QueryRowContext(ctx, query, userID, nullString(requestID), url, secret).Scan(&webhookID)
+	if err == sql.ErrNoRows {
+		return "", ErrNoSuchRequest
+	}
+	if err != nil {
+		return "", fmt.Errorf("can't insert webhook: %w", err)
+	}
+
+	return webhookID, nil
+}
+
+// GetWebhooksByUserID gets all webhooks of the user.
+func (wr *WebhooksRepository) GetWebhooksByUserID(ctx context.Context, userID string) ([]Webhook, error) {
+	const query = `SELECT id, user_id, coalesce(request_id::text, ''), url, secret, created
+		FROM converter.webhooks WHERE user_id = $1 ORDER BY created;`
+
+	return wr.selectWebhooks(ctx, query, userID)
+}
+
+// GetRequestWebhooks gets the webhooks to notify about the request:
+// the ones registered for the request and the ones registered for the whole account of its user.
+func (wr *WebhooksRepository) GetRequestWebhooks(ctx context.Context, requestID string) ([]Webhook, error) {
+	const query = `SELECT w.id, w.user_id, coalesce(w.request_id::text, ''), w.url, w.secret, w.created
+		FROM converter.webhooks w
+		JOIN converter.requests r ON r.user_id = w.user_id
+		WHERE r.id = $1 AND (w.request_id IS NULL OR w.request_id = r.id)
+		ORDER BY w.created;`
+
+	return wr.selectWebhooks(ctx, query, requestID)
+}
+
+func (wr *WebhooksRepository) selectWebhooks(ctx context.Context, query, arg string) ([]Webhook, error) {
+	rows, err := wr.db.QueryContext(ctx, query, arg)
+	if err != nil {
+		return nil, fmt.Errorf("can't get webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	webhooks := []Webhook{}
+	for rows.Next() {
+		var webhook Webhook
+		err = rows.Scan(&webhook.ID, &webhook.UserID, &webhook.RequestID, &webhook.URL, &webhook.Secret, &webhook.Created)
+		if err != nil {
+			return nil, fmt.Errorf("can't scan webhook from rows: %w", err)
+		}
+		webhooks = append(webhooks, webhook)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error selecting rows: %w", err)
+	}
+
+	return webhooks, nil
+}
+
+// DeleteWebhook deletes the user's webhook together with its delivery log.
+func (wr *WebhooksRepository) DeleteWebhook(ctx context.Context, userID, webhookID string) error {
+	const query = "DELETE FROM converter.webhooks WHERE id = $1 AND user_id = $2;"
+
+	res, err := wr.db.ExecContext(ctx, query, webhookID, userID)
+	if err != nil {
+		return fmt.Errorf("can't delete webhook: %w", err)
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("can't get the number of rows affected by a delete: %w", err)
+	}
+	if count == 0 {
+		return ErrNoSuchWebhook
+	}
+
+	return nil
+}
+
+// InsertDelivery logs the webhook delivery attempt.
+func (wr *WebhooksRepository) InsertDelivery(ctx context.Context, delivery WebhookDelivery) error {
+	const query = `INSERT INTO converter.webhook_deliveries (webhook_id, request_id, attempt, status_code, error)
+		VALUES ($1, $2, $3, $4, $5);`
+
+	_, err := wr.db.ExecContext(ctx, query, delivery.WebhookID, delivery.RequestID, delivery.Attempt,
+		nullInt(delivery.StatusCode), nullString(delivery.Error))
+	if err != nil {
+		return fmt.Errorf("can't insert webhook delivery: %w", err)
+	}
+
+	return nil
+}
+
+// GetDeliveries gets the delivery log of the user's webhook, the latest attempts first.
+func (wr *WebhooksRepository) GetDeliveries(ctx context.Context, userID, webhookID string) ([]WebhookDelivery, error) {
+	const query = `SELECT d.id, d.webhook_id, d.request_id, d.attempt, coalesce(d.status_code, 0), coalesce(d.error, ''), d.created
+		FROM converter.webhook_deliveries d
+		JOIN converter.webhooks w ON w.id = d.webhook_id
+		WHERE d.webhook_id = $1 AND w.user_id = $2
+		ORDER BY d.created DESC;`
+
+	rows, err := wr.db.QueryContext(ctx, query, webhookID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("can't get webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		var d WebhookDelivery
+		err = rows.Scan(&d.ID, &d.WebhookID, &d.RequestID, &d.Attempt, &d.StatusCode, &d.Error, &d.Created)
+		if err != nil {
+			return nil, fmt.Errorf("can't scan webhook delivery from rows: %w", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error selecting rows: %w", err)
+	}
+
+	return deliveries, nil
+}
@@ -0,0 +1,176 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhooksRepository_InsertWebhook(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%v' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	webhooksRepo, err := NewWebhooksRepository(db)
+	require.NoError(t, err)
+
+	const query = "INSERT INTO converter.webhooks (.+) RETURNING id"
+
+	testTable := []struct {
+		name              string
+		requestID         string
+		mockBehavior      func(requestID string)
+		expectedWebhookID string
+		expectedError     error
+		isErrorExpected   bool
+	}{
+		{
+			name: "Ok for account",
+			mockBehavior: func(string) {
+				mock.ExpectQuery(query).
+					WithArgs("10", sql.NullString{}, "https://example.com", "secret").
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("1"))
+			},
+			expectedWebhookID: "1",
+		},
+		{
+			name:      "Ok for request",
+			requestID: "20",
+			mockBehavior: func(requestID string) {
+				mock.ExpectQuery(query).
+					WithArgs("10", sql.NullString{String: requestID, Valid: true}, "https://example.com", "secret").
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("2"))
+			},
+			expectedWebhookID: "2",
+		},
+		{
+			name:      "Request of another user",
+			requestID: "20",
+			mockBehavior: func(requestID string) {
+				mock.ExpectQuery(query).
+					WithArgs("10", sql.NullString{String: requestID, Valid: true}, "https://example.com", "secret").
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+			},
+			expectedError:   ErrNoSuchRequest,
+			isErrorExpected: true,
+		},
+		{
+			name: "Database error",
+			mockBehavior: func(string) {
+				mock.ExpectQuery(query).WillReturnError(fmt.Errorf("some error"))
+			},
+			isErrorExpected: true,
+		},
+	}
+
+	for _, tc := range testTable {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.mockBehavior(tc.requestID)
+			result, err := webhooksRepo.InsertWebhook(context.TODO(), "10", tc.requestID, "https://example.com", "secret")
+			if tc.isErrorExpected {
+				assert.Error(t, err)
+				if tc.expectedError != nil {
+					assert.Equal(t, tc.expectedError, err)
+				}
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedWebhookID, result)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestWebhooksRepository_GetRequestWebhooks(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%v' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	webhooksRepo, err := NewWebhooksRepository(db)
+	require.NoError(t, err)
+
+	created := time.Date(2021, 11, 6, 21, 35, 7, 0, time.UTC)
+	rows := sqlmock.NewRows([]string{"id", "user_id", "request_id", "url", "secret", "created"}).
+		AddRow("1", "10", "", "https://example.com/all", "s1", created).
+		AddRow("2", "10", "20", "https://example.com/one", "s2", created)
+	mock.ExpectQuery("SELECT (.+) FROM converter.webhooks w JOIN converter.requests r (.+)").
+		WithArgs("20").
+		WillReturnRows(rows)
+
+	webhooks, err := webhooksRepo.GetRequestWebhooks(context.TODO(), "20")
+	require.NoError(t, err)
+	assert.Equal(t, []Webhook{
+		{ID: "1", UserID: "10", URL: "https://example.com/all", Secret: "s1", Created: created},
+		{ID: "2", UserID: "10", RequestID: "20", URL: "https://example.com/one", Secret: "s2", Created: created},
+	}, webhooks)
+}
+
+func TestWebhooksRepository_DeleteWebhook(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%v' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	webhooksRepo, err := NewWebhooksRepository(db)
+	require.NoError(t, err)
+
+	const query = "DELETE FROM converter.webhooks (.+)"
+
+	testTable := []struct {
+		name          string
+		mockBehavior  func()
+		expectedError error
+	}{
+		{
+			name: "Ok",
+			mockBehavior: func() {
+				mock.ExpectExec(query).WithArgs("1", "10").WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			name: "No such webhook",
+			mockBehavior: func() {
+				mock.ExpectExec(query).WithArgs("1", "10").WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			expectedError: ErrNoSuchWebhook,
+		},
+	}
+
+	for _, tc := range testTable {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.mockBehavior()
+			err := webhooksRepo.DeleteWebhook(context.TODO(), "10", "1")
+			assert.Equal(t, tc.expectedError, err)
+		})
+	}
+}
+
+func TestWebhooksRepository_InsertDelivery(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%v' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	webhooksRepo, err := NewWebhooksRepository(db)
+	require.NoError(t, err)
+
+	mock.ExpectExec("INSERT INTO converter.webhook_deliveries (.+)").
+		WithArgs("1", "20", 2, sql.NullInt64{}, sql.NullString{String: "connection refused", Valid: true}).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err = webhooksRepo.InsertDelivery(context.TODO(),
+		WebhookDelivery{WebhookID: "1", RequestID: "20", Attempt: 2, Error: "connection refused"})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,112 @@
+// Package retention deletes the stored images whose retention is over.
+package retention
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Konstantsiy/image-converter/internal/config"
+	"github.com/Konstantsiy/image-converter/internal/repository"
+	"github.com/Konstantsiy/image-converter/internal/storage"
+	"github.com/Konstantsiy/image-converter/pkg/logger"
+)
+
+// Sweeper deletes the expired images: it marks their rows deleted, so that they aren't shared with the new requests,
+// and removes their files from the storage. The images that can't be removed are skipped until the next sweep.
+type Sweeper struct {
+	imagesRepo repository.Images
+	storage    storage.Storage
+	conf       *config.RetentionConfig
+}
+
+// NewSweeper creates new sweeper of the expired images.
+func NewSweeper(imagesRepo repository.Images, st storage.Storage, conf *config.RetentionConfig) *Sweeper {
+	return &Sweeper{imagesRepo: imagesRepo, storage: st, conf: conf}
+}
+
+// Run sweeps the expired images every interval until the context is canceled.
+func (s *Sweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.conf.Interval)
+	defer ticker.Stop()
+
+	for {
+		removed, err := s.Sweep(ctx)
+		if removed > 0 {
+			logger.FromContext(ctx).WithField("count", removed).Infoln("expired images have been deleted")
+		}
+		if err != nil {
+			logger.FromContext(ctx).Errorln(fmt.Errorf("can't sweep expired images: %w", err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep deletes the expired images batch by batch and returns the number of removed files.
+// The image that fails to be removed is logged and skipped for the rest of the sweep, so that
+// it doesn't block the other images. In the dry-run mode the expired images are only reported to the log.
+func (s *Sweeper) Sweep(ctx context.Context) (int, error) {
+	if s.conf.DryRun {
+		images, err := s.Report(ctx, s.conf.BatchSize)
+		if err != nil {
+			return 0, err
+		}
+		for _, image := range images {
+			logger.FromContext(ctx).WithField("file_id", image.ID).WithField("role", image.Role).
+				Infoln("expired image would be deleted")
+		}
+		return 0, nil
+	}
+
+	removed := 0
+	var skipped []string
+	for {
+		marked, err := s.imagesRepo.MarkExpiredImages(ctx, s.conf.Original, s.conf.Converted, s.conf.BatchSize)
+		if err != nil {
+			return removed, fmt.Errorf("repository error: %w", err)
+		}
+
+		imageIDs, err := s.imagesRepo.GetDeletedImages(ctx, skipped, s.conf.BatchSize)
+		if err != nil {
+			return removed, fmt.Errorf("repository error: %w", err)
+		}
+
+		for _, imageID := range imageIDs {
+			if err = s.remove(ctx, imageID); err != nil {
+				logger.FromContext(ctx).WithField("file_id", imageID).Errorln(err)
+				skipped = append(skipped, imageID)
+				continue
+			}
+			removed++
+		}
+
+		if marked < s.conf.BatchSize && len(imageIDs) < s.conf.BatchSize {
+			return removed, nil
+		}
+	}
+}
+
+// remove removes the file of the deleted image from the storage and purges the image.
+func (s *Sweeper) remove(ctx context.Context, imageID string) error {
+	if err := s.storage.DeleteFile(imageID); err != nil {
+		return fmt.Errorf("storage error: %w", err)
+	}
+	if err := s.imagesRepo.PurgeImage(ctx, imageID); err != nil {
+		return fmt.Errorf("repository error: %w", err)
+	}
+	return nil
+}
+
+// Report returns up to limit expired images without deleting them.
+func (s *Sweeper) Report(ctx context.Context, limit int) ([]repository.ExpiredImage, error) {
+	images, err := s.imagesRepo.GetExpiredImages(ctx, s.conf.Original, s.conf.Converted, limit)
+	if err != nil {
+		return nil, fmt.Errorf("repository error: %w", err)
+	}
+	return images, nil
+}
@@ -0,0 +1,133 @@
+package retention
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Konstantsiy/image-converter/internal/config"
+	"github.com/Konstantsiy/image-converter/internal/repository"
+	mockstorage "github.com/Konstantsiy/image-converter/internal/storage/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSweeper_Sweep(t *testing.T) {
+	const (
+		markQuery    = `UPDATE converter.images SET deleted (.+)`
+		deletedQuery = `SELECT id FROM converter.images WHERE deleted IS NOT NULL (.+)`
+		purgeQuery   = `DELETE FROM converter.images i WHERE i.id = (.+)`
+		expiredQuery = `SELECT i.id, i.name, i.format, (.+)`
+	)
+
+	original, converted := 30*24*time.Hour, 7*24*time.Hour
+
+	testTable := []struct {
+		name            string
+		dryRun          bool
+		mockBehavior    func(mock sqlmock.Sqlmock, st *mockstorage.MockStorage)
+		expectedRemoved int
+		isErrorExpected bool
+	}{
+		{
+			name: "Ok",
+			mockBehavior: func(mock sqlmock.Sqlmock, st *mockstorage.MockStorage) {
+				mock.ExpectExec(markQuery).WithArgs(original.Seconds(), converted.Seconds(), 2).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(deletedQuery).WithArgs(pq.Array([]string(nil)), 2).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("1"))
+				st.EXPECT().DeleteFile("1").Return(nil)
+				mock.ExpectExec(purgeQuery).WithArgs("1").WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			expectedRemoved: 1,
+		},
+		{
+			name: "Storage error",
+			mockBehavior: func(mock sqlmock.Sqlmock, st *mockstorage.MockStorage) {
+				mock.ExpectExec(markQuery).WithArgs(original.Seconds(), converted.Seconds(), 2).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(deletedQuery).WithArgs(pq.Array([]string(nil)), 2).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("1").AddRow("2"))
+				st.EXPECT().DeleteFile("1").Return(fmt.Errorf("access denied"))
+				st.EXPECT().DeleteFile("2").Return(nil)
+				mock.ExpectExec(purgeQuery).WithArgs("2").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(markQuery).WithArgs(original.Seconds(), converted.Seconds(), 2).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(deletedQuery).WithArgs(pq.Array([]string{"1"}), 2).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("3"))
+				st.EXPECT().DeleteFile("3").Return(nil)
+				mock.ExpectExec(purgeQuery).WithArgs("3").WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			expectedRemoved: 2,
+		},
+		{
+			name: "Persistent errors",
+			mockBehavior: func(mock sqlmock.Sqlmock, st *mockstorage.MockStorage) {
+				mock.ExpectExec(markQuery).WithArgs(original.Seconds(), converted.Seconds(), 2).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(deletedQuery).WithArgs(pq.Array([]string(nil)), 2).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("1").AddRow("2"))
+				st.EXPECT().DeleteFile("1").Return(fmt.Errorf("access denied"))
+				st.EXPECT().DeleteFile("2").Return(nil)
+				mock.ExpectExec(purgeQuery).WithArgs("2").WillReturnError(fmt.Errorf("some error"))
+				mock.ExpectExec(markQuery).WithArgs(original.Seconds(), converted.Seconds(), 2).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(deletedQuery).WithArgs(pq.Array([]string{"1", "2"}), 2).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+			},
+		},
+		{
+			name: "Repository error",
+			mockBehavior: func(mock sqlmock.Sqlmock, st *mockstorage.MockStorage) {
+				mock.ExpectExec(markQuery).WithArgs(original.Seconds(), converted.Seconds(), 2).
+					WillReturnError(fmt.Errorf("some error"))
+			},
+			isErrorExpected: true,
+		},
+		{
+			name:   "Dry run",
+			dryRun: true,
+			mockBehavior: func(mock sqlmock.Sqlmock, st *mockstorage.MockStorage) {
+				rows := sqlmock.NewRows([]string{"id", "name", "format", "role", "created"}).
+					AddRow("1", "cat", "jpg", repository.ImageRoleOriginal, time.Now())
+				mock.ExpectQuery(expiredQuery).WithArgs(original.Seconds(), converted.Seconds(), 2).WillReturnRows(rows)
+			},
+		},
+	}
+
+	for _, tc := range testTable {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close()
+
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			imagesRepo, err := repository.NewImagesRepository(db)
+			require.NoError(t, err)
+			st := mockstorage.NewMockStorage(c)
+			tc.mockBehavior(mock, st)
+
+			sweeper := NewSweeper(imagesRepo, st, &config.RetentionConfig{
+				Original:  original,
+				Converted: converted,
+				BatchSize: 2,
+				DryRun:    tc.dryRun,
+			})
+
+			removed, err := sweeper.Sweep(context.Background())
+			if tc.isErrorExpected {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectedRemoved, removed)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
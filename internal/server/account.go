@@ -0,0 +1,42 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// DeleteAccount queues the deletion of the user with all the requests, images and stored files.
+// The job status is reported by GetAccountJob.
+func (s *Server) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	job, err := s.accountService.Delete(r.Context())
+	if err != nil {
+		reportError(w, err)
+		return
+	}
+
+	sendResponse(w, job, http.StatusAccepted)
+}
+
+// ExportAccount queues the export of the user's requests history and images to the ZIP archive.
+// The download URL of the archive is reported by GetAccountJob once the job is done.
+func (s *Server) ExportAccount(w http.ResponseWriter, r *http.Request) {
+	job, err := s.accountService.Export(r.Context())
+	if err != nil {
+		reportError(w, err)
+		return
+	}
+
+	sendResponse(w, job, http.StatusAccepted)
+}
+
+// GetAccountJob displays the status of the user's account deletion or export job.
+func (s *Server) GetAccountJob(w http.ResponseWriter, r *http.Request) {
+	job, err := s.accountService.GetJob(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		reportError(w, err)
+		return
+	}
+
+	sendResponse(w, job, http.StatusOK)
+}
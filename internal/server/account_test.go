@@ -0,0 +1,126 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Konstantsiy/image-converter/internal/repository"
+	"github.com/Konstantsiy/image-converter/internal/service"
+	mockservice "github.com/Konstantsiy/image-converter/internal/service/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_DeleteAccount(t *testing.T) {
+	created := time.Date(2021, 8, 1, 0, 0, 0, 0, time.UTC)
+
+	testTable := []struct {
+		name                 string
+		mockBehavior         func(s *mockservice.MockAccounts)
+		expectedStatusCode   int
+		expectedResponseBody string
+	}{
+		{
+			name: "Ok",
+			mockBehavior: func(s *mockservice.MockAccounts) {
+				s.EXPECT().Delete(gomock.Any()).Return(repository.AccountJob{ID: "1", UserID: "2",
+					Kind: repository.AccountJobDelete, Status: repository.RequestStatusQueued, Created: created, Updated: created}, nil)
+			},
+			expectedStatusCode: http.StatusAccepted,
+			expectedResponseBody: `{"id":"1","user_id":"2","kind":"delete","status":"queued",` +
+				`"created":"2021-08-01T00:00:00Z","updated":"2021-08-01T00:00:00Z"}`,
+		},
+		{
+			name: "Service error",
+			mockBehavior: func(s *mockservice.MockAccounts) {
+				s.EXPECT().Delete(gomock.Any()).Return(repository.AccountJob{},
+					&service.InternalError{Err: fmt.Errorf("some error"), StatusCode: http.StatusInternalServerError})
+			},
+			expectedStatusCode:   http.StatusInternalServerError,
+			expectedResponseBody: `{"message":"some error"}`,
+		},
+	}
+
+	for _, tc := range testTable {
+		t.Run(tc.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			as := mockservice.NewMockAccounts(c)
+			tc.mockBehavior(as)
+
+			s := Server{accountService: as}
+
+			r := mux.NewRouter()
+			r.HandleFunc("/user/me", s.DeleteAccount).Methods("DELETE")
+
+			w := httptest.NewRecorder()
+			req, err := http.NewRequest("DELETE", "/user/me", nil)
+			require.NoError(t, err)
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.expectedStatusCode, w.Code)
+			assert.Equal(t, tc.expectedResponseBody, w.Body.String())
+		})
+	}
+}
+
+func TestServer_GetAccountJob(t *testing.T) {
+	created := time.Date(2021, 8, 1, 0, 0, 0, 0, time.UTC)
+
+	testTable := []struct {
+		name                 string
+		mockBehavior         func(s *mockservice.MockAccounts)
+		expectedStatusCode   int
+		expectedResponseBody string
+	}{
+		{
+			name: "Done export",
+			mockBehavior: func(s *mockservice.MockAccounts) {
+				s.EXPECT().GetJob(gomock.Any(), "1").Return(repository.AccountJob{ID: "1", UserID: "2",
+					Kind: repository.AccountJobExport, Status: repository.RequestStatusDone, FileID: "1",
+					DownloadURL: "https://example.com/1", Created: created, Updated: created}, nil)
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedResponseBody: `{"id":"1","user_id":"2","kind":"export","status":"done",` +
+				`"download_url":"https://example.com/1","created":"2021-08-01T00:00:00Z","updated":"2021-08-01T00:00:00Z"}`,
+		},
+		{
+			name: "No such job",
+			mockBehavior: func(s *mockservice.MockAccounts) {
+				s.EXPECT().GetJob(gomock.Any(), "1").Return(repository.AccountJob{},
+					&service.InternalError{Err: repository.ErrNoSuchAccountJob, StatusCode: http.StatusNotFound})
+			},
+			expectedStatusCode:   http.StatusNotFound,
+			expectedResponseBody: `{"message":"account job with this id does not exist"}`,
+		},
+	}
+
+	for _, tc := range testTable {
+		t.Run(tc.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			as := mockservice.NewMockAccounts(c)
+			tc.mockBehavior(as)
+
+			s := Server{accountService: as}
+
+			r := mux.NewRouter()
+			r.HandleFunc("/user/me/jobs/{id}", s.GetAccountJob).Methods("GET")
+
+			w := httptest.NewRecorder()
+			req, err := http.NewRequest("GET", "/user/me/jobs/1", nil)
+			require.NoError(t, err)
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.expectedStatusCode, w.Code)
+			assert.Equal(t, tc.expectedResponseBody, w.Body.String())
+		})
+	}
+}
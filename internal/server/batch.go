@@ -0,0 +1,264 @@
+package server
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/Konstantsiy/image-converter/internal/repository"
+	"github.com/Konstantsiy/image-converter/internal/service"
+	"github.com/Konstantsiy/image-converter/internal/validation"
+	"github.com/Konstantsiy/image-converter/pkg/logger"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// maxBatchMemory is the part of the batch request body kept in memory, the rest is stored in temporary files.
+	maxBatchMemory = 32 << 20
+	// maxArchiveEntrySize is the largest uncompressed size of the image inside the ZIP archive.
+	maxArchiveEntrySize = 32 << 20
+	// maxArchiveSize is the largest total uncompressed size of the images inside the ZIP archive.
+	maxArchiveSize = 256 << 20
+)
+
+// CreateBatch converts many images with the same parameters.
+// The images are sent either as several "files" form values or as a single ZIP "archive".
+func (s *Server) CreateBatch(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(maxBatchMemory); err != nil {
+		reportErrorWithCode(w, fmt.Errorf("can't parse multipart form"), http.StatusBadRequest)
+		return
+	}
+
+	targetFormat := r.FormValue("targetFormat")
+	ratio, err := strconv.Atoi(r.FormValue("ratio"))
+	if err != nil {
+		reportErrorWithCode(w, fmt.Errorf("invalid ratio form value"), http.StatusBadRequest)
+		return
+	}
+
+	opts, err := parseConversionOptions(r)
+	if err != nil {
+		reportErrorWithCode(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if err = validation.ValidateConversionOptions(opts); err != nil {
+		reportErrorWithCode(w, err, http.StatusBadRequest)
+		return
+	}
+
+	renditions, err := parseRenditions(r, targetFormat, ratio)
+	if err != nil {
+		reportErrorWithCode(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if err = validation.ValidateRenditions(renditions); err != nil {
+		reportErrorWithCode(w, err, http.StatusBadRequest)
+		return
+	}
+
+	files, closeFiles, err := readBatchFiles(r.MultipartForm)
+	if err != nil {
+		reportErrorWithCode(w, err, http.StatusBadRequest)
+		return
+	}
+	defer closeFiles()
+
+	for _, f := range files {
+		if err = validation.ValidateConversionRequest(f.Filename, f.SourceFormat, targetFormat, ratio); err != nil {
+			reportErrorWithCode(w, fmt.Errorf("%s.%s: %w", f.Filename, f.SourceFormat, err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	batchID, items, err := s.batchService.Create(r.Context(), files, targetFormat, ratio, opts, renditions)
+	if err != nil {
+		reportError(w, err)
+		return
+	}
+
+	type batchResponse struct {
+		BatchID    string   `json:"batch_id"`
+		RequestIDs []string `json:"request_ids"`
+	}
+
+	resp := batchResponse{BatchID: batchID, RequestIDs: make([]string, 0, len(items))}
+	for _, item := range items {
+		resp.RequestIDs = append(resp.RequestIDs, item.RequestID)
+	}
+
+	sendResponse(w, resp, http.StatusAccepted)
+}
+
+// GetBatch displays the batch status together with the statuses of its requests.
+func (s *Server) GetBatch(w http.ResponseWriter, r *http.Request) {
+	batch, err := s.batchService.Get(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		reportError(w, err)
+		return
+	}
+
+	sendResponse(w, batch, http.StatusOK)
+}
+
+// DownloadBatch sends the ZIP archive with all converted images once every request of the batch is done.
+func (s *Server) DownloadBatch(w http.ResponseWriter, r *http.Request) {
+	batch, err := s.batchService.Get(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		reportError(w, err)
+		return
+	}
+
+	if batch.Status != repository.RequestStatusDone {
+		reportErrorWithCode(w, fmt.Errorf("batch is %s, %d of %d requests are done", batch.Status, batch.Done, batch.Total),
+			http.StatusConflict)
+		return
+	}
+
+	w.Header().Set(ContentTypeKey, "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "batch-"+batch.ID+".zip"))
+	w.WriteHeader(http.StatusOK)
+
+	err = s.batchService.WriteArchive(r.Context(), batch, w)
+	if err != nil {
+		// The status has already been sent, the client receives a broken archive.
+		logger.FromContext(r.Context()).WithField("batch_id", batch.ID).
+			Errorln(fmt.Errorf("can't write batch archive: %w", err))
+	}
+}
+
+// readBatchFiles collects the batch images from the "files" form values or from the "archive" ZIP file.
+// The number of images is checked before any of them is opened, the returned function closes them.
+func readBatchFiles(form *multipart.Form) ([]service.BatchFile, func(), error) {
+	headers, archives := form.File["files"], form.File["archive"]
+	switch {
+	case len(headers) > 0 && len(archives) > 0:
+		return nil, nil, fmt.Errorf("needed either files or archive, not both")
+	case len(archives) > 1:
+		return nil, nil, fmt.Errorf("needed a single archive")
+	case len(archives) == 1:
+		return readArchiveFiles(archives[0])
+	}
+
+	if err := validation.ValidateBatchSize(len(headers)); err != nil {
+		return nil, nil, err
+	}
+
+	files := make([]service.BatchFile, 0, len(headers))
+	for _, header := range headers {
+		file, err := header.Open()
+		if err != nil {
+			closeBatchFiles(files)
+			return nil, nil, fmt.Errorf("can't open file %s", header.Filename)
+		}
+		filename, sourceFormat := splitFilename(header.Filename)
+		files = append(files, service.BatchFile{File: file, Filename: filename, SourceFormat: sourceFormat})
+	}
+
+	return files, func() { closeBatchFiles(files) }, nil
+}
+
+// readArchiveFiles collects the images of the ZIP archive, directories and hidden files are skipped.
+// The sizes are checked by the headers, the entries are streamed from the archive when the batch is created.
+func readArchiveFiles(header *multipart.FileHeader) ([]service.BatchFile, func(), error) {
+	archive, err := header.Open()
+	if err != nil {
+		return nil, nil, fmt.Errorf("can't open archive")
+	}
+
+	zr, err := zip.NewReader(archive, header.Size)
+	if err != nil {
+		archive.Close()
+		return nil, nil, fmt.Errorf("invalid ZIP archive")
+	}
+
+	var entries []*zip.File
+	var total uint64
+	for _, entry := range zr.File {
+		name := path.Base(entry.Name)
+		if entry.FileInfo().IsDir() || strings.HasPrefix(name, ".") || strings.HasPrefix(entry.Name, "__MACOSX/") {
+			continue
+		}
+		if entry.UncompressedSize64 > maxArchiveEntrySize {
+			archive.Close()
+			return nil, nil, fmt.Errorf("archive entry %s is larger than %d bytes", entry.Name, maxArchiveEntrySize)
+		}
+		total += entry.UncompressedSize64
+		entries = append(entries, entry)
+	}
+
+	if err = validation.ValidateBatchSize(len(entries)); err != nil {
+		archive.Close()
+		return nil, nil, err
+	}
+	if total > maxArchiveSize {
+		archive.Close()
+		return nil, nil, fmt.Errorf("archive is larger than %d bytes uncompressed", maxArchiveSize)
+	}
+
+	files := make([]service.BatchFile, 0, len(entries))
+	for _, entry := range entries {
+		filename, sourceFormat := splitFilename(path.Base(entry.Name))
+		files = append(files, service.BatchFile{File: &archiveFile{entry: entry}, Filename: filename, SourceFormat: sourceFormat})
+	}
+
+	return files, func() {
+		closeBatchFiles(files)
+		archive.Close()
+	}, nil
+}
+
+func closeBatchFiles(files []service.BatchFile) {
+	for _, f := range files {
+		f.File.Close()
+	}
+}
+
+// splitFilename splits the name of the uploaded file into the name and the format (extension).
+func splitFilename(name string) (string, string) {
+	parts := strings.Split(name, ".")
+	sourceFormat := parts[len(parts)-1]
+	return strings.TrimSuffix(name, "."+sourceFormat), sourceFormat
+}
+
+// archiveFile streams the image from the ZIP archive, rewinding reopens the entry,
+// so that the image is never held in memory. The entry can't be longer than its header says,
+// archive/zip reports ErrFormat then.
+type archiveFile struct {
+	entry *zip.File
+	rc    io.ReadCloser
+}
+
+func (f *archiveFile) Read(p []byte) (int, error) {
+	if f.rc == nil {
+		rc, err := f.entry.Open()
+		if err != nil {
+			return 0, fmt.Errorf("can't open archive entry %s: %w", f.entry.Name, err)
+		}
+		f.rc = rc
+	}
+	return f.rc.Read(p)
+}
+
+// Seek supports only rewinding to the start of the entry.
+func (f *archiveFile) Seek(offset int64, whence int) (int64, error) {
+	if offset != 0 || whence != io.SeekStart {
+		return 0, fmt.Errorf("archive entry %s can only be rewound", f.entry.Name)
+	}
+	return 0, f.Close()
+}
+
+func (f *archiveFile) Close() error {
+	if f.rc == nil {
+		return nil
+	}
+	err := f.rc.Close()
+	f.rc = nil
+	return err
+}
@@ -0,0 +1,240 @@
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Konstantsiy/image-converter/internal/repository"
+	"github.com/Konstantsiy/image-converter/internal/service"
+	mockservice "github.com/Konstantsiy/image-converter/internal/service/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createMockBatchRequest(t *testing.T, files map[string][]byte, archive map[string][]byte, params map[string]string) *http.Request {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+
+	for name, data := range files {
+		part, err := writer.CreateFormFile("files", name)
+		require.NoError(t, err)
+		_, err = part.Write(data)
+		require.NoError(t, err)
+	}
+
+	if archive != nil {
+		part, err := writer.CreateFormFile("archive", "images.zip")
+		require.NoError(t, err)
+		zw := zip.NewWriter(part)
+		for name, data := range archive {
+			entry, err := zw.Create(name)
+			require.NoError(t, err)
+			_, err = entry.Write(data)
+			require.NoError(t, err)
+		}
+		require.NoError(t, zw.Close())
+	}
+
+	for key, val := range params {
+		_ = writer.WriteField(key, val)
+	}
+	require.NoError(t, writer.Close())
+
+	req, err := http.NewRequest("POST", "/batches", body)
+	require.NoError(t, err)
+	req.Header.Set(ContentTypeKey, writer.FormDataContentType())
+
+	return req
+}
+
+func manyEntries(n int, data []byte) map[string][]byte {
+	entries := make(map[string][]byte, n)
+	for i := 0; i < n; i++ {
+		entries[fmt.Sprintf("cat%d.jpg", i)] = data
+	}
+	return entries
+}
+
+func TestServer_CreateBatch(t *testing.T) {
+	params := map[string]string{"targetFormat": "png", "ratio": "90"}
+	image := []byte("image")
+
+	testTable := []struct {
+		name                 string
+		files                map[string][]byte
+		archive              map[string][]byte
+		mockBehavior         func(s *mockservice.MockBatches)
+		expectedStatusCode   int
+		expectedResponseBody string
+	}{
+		{
+			name:  "Ok with files",
+			files: map[string][]byte{"cat.jpg": image, "dog.bmp": image},
+			mockBehavior: func(s *mockservice.MockBatches) {
+				s.EXPECT().
+					Create(gomock.Any(), gomock.Len(2), "png", 90, gomock.Any(), gomock.Any()).
+					Return("1", []service.BatchItem{{RequestID: "2"}, {RequestID: "3"}}, nil)
+			},
+			expectedStatusCode:   http.StatusAccepted,
+			expectedResponseBody: `{"batch_id":"1","request_ids":["2","3"]}`,
+		},
+		{
+			name:    "Ok with archive",
+			archive: map[string][]byte{"photos/cat.jpg": image, "photos/": nil, "__MACOSX/._cat.jpg": image},
+			mockBehavior: func(s *mockservice.MockBatches) {
+				s.EXPECT().
+					Create(gomock.Any(), gomock.Len(1), "png", 90, gomock.Any(), gomock.Any()).
+					Return("1", []service.BatchItem{{RequestID: "2"}}, nil)
+			},
+			expectedStatusCode:   http.StatusAccepted,
+			expectedResponseBody: `{"batch_id":"1","request_ids":["2"]}`,
+		},
+		{
+			name:                 "No files",
+			mockBehavior:         func(s *mockservice.MockBatches) {},
+			expectedStatusCode:   http.StatusBadRequest,
+			expectedResponseBody: `{"message":"invalid files: needed from 1 to 50 files"}`,
+		},
+		{
+			name:                 "Files and archive",
+			files:                map[string][]byte{"cat.jpg": image},
+			archive:              map[string][]byte{"dog.jpg": image},
+			mockBehavior:         func(s *mockservice.MockBatches) {},
+			expectedStatusCode:   http.StatusBadRequest,
+			expectedResponseBody: `{"message":"needed either files or archive, not both"}`,
+		},
+		{
+			name:                 "Too many archive entries",
+			archive:              manyEntries(51, image),
+			mockBehavior:         func(s *mockservice.MockBatches) {},
+			expectedStatusCode:   http.StatusBadRequest,
+			expectedResponseBody: `{"message":"invalid files: needed from 1 to 50 files"}`,
+		},
+		{
+			name:                 "Invalid file format",
+			files:                map[string][]byte{"cat.svg": image},
+			mockBehavior:         func(s *mockservice.MockBatches) {},
+			expectedStatusCode:   http.StatusBadRequest,
+			expectedResponseBody: `{"message":"cat.svg: invalid source format: needed one of bmp, gif, jpg, png, tiff, webp"}`,
+		},
+	}
+
+	for _, tc := range testTable {
+		t.Run(tc.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			bs := mockservice.NewMockBatches(c)
+			tc.mockBehavior(bs)
+
+			s := Server{batchService: bs}
+
+			r := mux.NewRouter()
+			r.HandleFunc("/batches", s.CreateBatch).Methods("POST")
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, createMockBatchRequest(t, tc.files, tc.archive, params))
+
+			assert.Equal(t, tc.expectedStatusCode, w.Code)
+			assert.Equal(t, tc.expectedResponseBody, w.Body.String())
+		})
+	}
+}
+
+func TestServer_DownloadBatch(t *testing.T) {
+	testTable := []struct {
+		name               string
+		mockBehavior       func(s *mockservice.MockBatches)
+		expectedStatusCode int
+		expectedBody       string
+	}{
+		{
+			name: "Ok",
+			mockBehavior: func(s *mockservice.MockBatches) {
+				batch := repository.Batch{ID: "1", Status: repository.RequestStatusDone, Total: 1, Done: 1}
+				s.EXPECT().Get(gomock.Any(), "1").Return(batch, nil)
+				s.EXPECT().WriteArchive(gomock.Any(), batch, gomock.Any()).Return(nil)
+			},
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name: "Batch is not done",
+			mockBehavior: func(s *mockservice.MockBatches) {
+				batch := repository.Batch{ID: "1", Status: repository.RequestStatusProcessing, Total: 2, Done: 1}
+				s.EXPECT().Get(gomock.Any(), "1").Return(batch, nil)
+			},
+			expectedStatusCode: http.StatusConflict,
+			expectedBody:       `{"message":"batch is processing, 1 of 2 requests are done"}`,
+		},
+		{
+			name: "No such batch",
+			mockBehavior: func(s *mockservice.MockBatches) {
+				s.EXPECT().Get(gomock.Any(), "1").
+					Return(repository.Batch{}, &service.InternalError{Err: repository.ErrNoSuchBatch, StatusCode: http.StatusNotFound})
+			},
+			expectedStatusCode: http.StatusNotFound,
+			expectedBody:       `{"message":"batch with this id does not exist"}`,
+		},
+	}
+
+	for _, tc := range testTable {
+		t.Run(tc.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			bs := mockservice.NewMockBatches(c)
+			tc.mockBehavior(bs)
+
+			s := Server{batchService: bs}
+
+			r := mux.NewRouter()
+			r.HandleFunc("/batches/{id}/archive", s.DownloadBatch).Methods("GET")
+
+			w := httptest.NewRecorder()
+			req, err := http.NewRequest("GET", "/batches/1/archive", nil)
+			require.NoError(t, err)
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.expectedStatusCode, w.Code)
+			assert.Equal(t, tc.expectedBody, w.Body.String())
+		})
+	}
+}
+
+func TestArchiveFile(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	entry, err := zw.Create("cat.jpg")
+	require.NoError(t, err)
+	_, err = entry.Write([]byte("image"))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+
+	f := &archiveFile{entry: zr.File[0]}
+	defer f.Close()
+
+	data, err := ioutil.ReadAll(f)
+	require.NoError(t, err)
+	assert.Equal(t, "image", string(data))
+
+	_, err = f.Seek(0, io.SeekStart)
+	require.NoError(t, err)
+	data, err = ioutil.ReadAll(f)
+	require.NoError(t, err)
+	assert.Equal(t, "image", string(data))
+
+	_, err = f.Seek(1, io.SeekCurrent)
+	assert.Error(t, err)
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Konstantsiy/image-converter/pkg/logger"
+)
+
+// keepAliveInterval is how often the comment line is sent to keep the idle event stream open.
+const keepAliveInterval = 15 * time.Second
+
+// StreamRequestEvents streams the status changes of the user's requests as Server-Sent Events.
+// Every change is sent as the "status" event with the JSON data.
+func (s *Server) StreamRequestEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		reportErrorWithCode(w, fmt.Errorf("streaming is not supported"), http.StatusInternalServerError)
+		return
+	}
+
+	events, unsubscribe, err := s.eventsService.Subscribe(r.Context())
+	if err != nil {
+		reportError(w, err)
+		return
+	}
+	defer unsubscribe()
+
+	w.Header().Set(ContentTypeKey, "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(keepAliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+
+			data, err := json.Marshal(event)
+			if err != nil {
+				logger.FromContext(r.Context()).Errorln(fmt.Errorf("can't marshal request event: %w", err))
+				continue
+			}
+
+			fmt.Fprintf(w, "event: status\ndata: %s\n\n", data)
+			flusher.Flush()
+		}
+	}
+}
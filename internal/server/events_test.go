@@ -0,0 +1,75 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Konstantsiy/image-converter/internal/repository"
+	"github.com/Konstantsiy/image-converter/internal/service"
+	mockservice "github.com/Konstantsiy/image-converter/internal/service/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer_StreamRequestEvents(t *testing.T) {
+	testTable := []struct {
+		name                 string
+		mockBehavior         func(s *mockservice.MockEvents)
+		expectedStatusCode   int
+		expectedContentType  string
+		expectedResponseBody string
+	}{
+		{
+			name: "Ok",
+			mockBehavior: func(s *mockservice.MockEvents) {
+				events := make(chan repository.RequestEvent, 2)
+				events <- repository.RequestEvent{RequestID: "1", UserID: "2", Status: "processing"}
+				events <- repository.RequestEvent{RequestID: "1", UserID: "2", Status: "done", TargetID: "3"}
+				close(events)
+				s.EXPECT().Subscribe(gomock.Any()).Return((<-chan repository.RequestEvent)(events), func() {}, nil)
+			},
+			expectedStatusCode:  http.StatusOK,
+			expectedContentType: "text/event-stream",
+			expectedResponseBody: "event: status\ndata: {\"request_id\":\"1\",\"user_id\":\"2\",\"status\":\"processing\"}\n\n" +
+				"event: status\ndata: {\"request_id\":\"1\",\"user_id\":\"2\",\"status\":\"done\",\"target_id\":\"3\"}\n\n",
+		},
+		{
+			name: "Cannot get user id from context",
+			mockBehavior: func(s *mockservice.MockEvents) {
+				s.EXPECT().Subscribe(gomock.Any()).Return(nil, nil, &service.InternalError{
+					Err:        fmt.Errorf("can't get user id from application context"),
+					StatusCode: http.StatusInternalServerError,
+				})
+			},
+			expectedStatusCode:   http.StatusInternalServerError,
+			expectedResponseBody: `{"message":"can't get user id from application context"}`,
+		},
+	}
+
+	for _, tc := range testTable {
+		t.Run(tc.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			es := mockservice.NewMockEvents(c)
+			tc.mockBehavior(es)
+
+			s := Server{eventsService: es}
+
+			r := mux.NewRouter()
+			r.HandleFunc("/requests/events", s.StreamRequestEvents).Methods("GET")
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("GET", "/requests/events", nil))
+
+			assert.Equal(t, tc.expectedStatusCode, w.Code)
+			assert.Equal(t, tc.expectedResponseBody, w.Body.String())
+			if tc.expectedContentType != "" {
+				assert.Equal(t, tc.expectedContentType, w.Header().Get(ContentTypeKey))
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Konstantsiy/image-converter/internal/storage"
+	"github.com/gorilla/mux"
+)
+
+// RegisterFileRoutes registers the route serving the files of the storage by the signed download URLs.
+// The route doesn't require authorization, the signature grants access to the single file.
+func (s *Server) RegisterFileRoutes(r *mux.Router, files storage.SignedFiles) {
+	s.files = files
+	r.HandleFunc("/files/{id}", s.ServeFile).Methods("GET")
+}
+
+// ServeFile sends the file if the download URL is signed and isn't expired.
+func (s *Server) ServeFile(w http.ResponseWriter, r *http.Request) {
+	fileID := mux.Vars(r)["id"]
+	query := r.URL.Query()
+
+	file, err := s.files.OpenSigned(fileID, query.Get("expires"), query.Get("signature"))
+	if errors.Is(err, storage.ErrInvalidSignature) {
+		reportErrorWithCode(w, err, http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, storage.ErrNoSuchFile) {
+		reportErrorWithCode(w, err, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		reportErrorWithCode(w, err, http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	http.ServeContent(w, r, fileID, time.Time{}, file)
+}
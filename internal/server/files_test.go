@@ -0,0 +1,80 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Konstantsiy/image-converter/internal/storage"
+	mockstorage "github.com/Konstantsiy/image-converter/internal/storage/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_ServeFile(t *testing.T) {
+	testTable := []struct {
+		name               string
+		mockBehavior       func(f *mockstorage.MockSignedFiles)
+		expectedStatusCode int
+		expectedBody       string
+	}{
+		{
+			name: "Ok",
+			mockBehavior: func(f *mockstorage.MockSignedFiles) {
+				f.EXPECT().OpenSigned("1", "1637000000", "abc").Return(memoryFile{bytes.NewReader([]byte("image"))}, nil)
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       "image",
+		},
+		{
+			name: "Invalid signature",
+			mockBehavior: func(f *mockstorage.MockSignedFiles) {
+				f.EXPECT().OpenSigned("1", "1637000000", "abc").Return(nil, storage.ErrInvalidSignature)
+			},
+			expectedStatusCode: http.StatusForbidden,
+			expectedBody:       `{"message":"invalid or expired download URL"}`,
+		},
+		{
+			name: "No such file",
+			mockBehavior: func(f *mockstorage.MockSignedFiles) {
+				f.EXPECT().OpenSigned("1", "1637000000", "abc").Return(nil, storage.ErrNoSuchFile)
+			},
+			expectedStatusCode: http.StatusNotFound,
+			expectedBody:       `{"message":"file with this id does not exist"}`,
+		},
+	}
+
+	for _, tc := range testTable {
+		t.Run(tc.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			files := mockstorage.NewMockSignedFiles(c)
+			tc.mockBehavior(files)
+
+			s := Server{}
+			r := mux.NewRouter()
+			s.RegisterFileRoutes(r, files)
+
+			w := httptest.NewRecorder()
+			req, err := http.NewRequest("GET", "/files/1?expires=1637000000&signature=abc", nil)
+			require.NoError(t, err)
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.expectedStatusCode, w.Code)
+			assert.Equal(t, tc.expectedBody, w.Body.String())
+		})
+	}
+}
+
+// memoryFile implements storage.File for the test files kept in memory.
+type memoryFile struct {
+	*bytes.Reader
+}
+
+func (memoryFile) Close() error {
+	return nil
+}
@@ -6,13 +6,12 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
-	"strings"
+	"time"
 
-	"github.com/Konstantsiy/image-converter/internal/queue"
+	"github.com/Konstantsiy/image-converter/internal/converter"
 
 	"github.com/Konstantsiy/image-converter/internal/service"
-
-	"github.com/Konstantsiy/image-converter/pkg/logger"
+	"github.com/Konstantsiy/image-converter/internal/storage"
 
 	"github.com/Konstantsiy/image-converter/internal/validation"
 	"github.com/gorilla/mux"
@@ -23,16 +22,23 @@ type Server struct {
 	authService     service.Authorization
 	imageService    service.Images
 	requestsService service.Requests
-	producer        queue.Producer
+	batchService    service.Batches
+	webhookService  service.Webhooks
+	eventsService   service.Events
+	accountService  service.Accounts
+	files           storage.SignedFiles
 }
 
 // NewServer creates new application server.
-func NewServer(authService service.Authorization, imageService service.Images, requestsService service.Requests, producer queue.Producer) *Server {
+func NewServer(authService service.Authorization, imageService service.Images, requestsService service.Requests, batchService service.Batches, webhookService service.Webhooks, eventsService service.Events, accountService service.Accounts) *Server {
 	return &Server{
 		authService:     authService,
 		imageService:    imageService,
 		requestsService: requestsService,
-		producer:        producer}
+		batchService:    batchService,
+		webhookService:  webhookService,
+		eventsService:   eventsService,
+		accountService:  accountService}
 }
 
 // RegisterRoutes registers application routers.
@@ -40,13 +46,29 @@ func (s *Server) RegisterRoutes(r *mux.Router) {
 	r.Use(s.LoggingMiddleware)
 	r.HandleFunc("/user/login", s.LogIn).Methods("POST")
 	r.HandleFunc("/user/signup", s.SignUp).Methods("POST")
+	r.HandleFunc("/user/refresh", s.RefreshToken).Methods("POST")
+	r.HandleFunc("/user/logout", s.LogOut).Methods("POST")
 
 	api := r.NewRoute().Subrouter()
 
 	api.Use(s.AuthMiddleware)
+	api.HandleFunc("/user/me", s.DeleteAccount).Methods("DELETE")
+	api.HandleFunc("/user/me/export", s.ExportAccount).Methods("GET")
+	api.HandleFunc("/user/me/jobs/{id}", s.GetAccountJob).Methods("GET")
 	api.HandleFunc("/conversion", s.ConvertImage).Methods("POST")
 	api.HandleFunc("/images", s.DownloadImage).Methods("GET")
+	api.HandleFunc("/images/{id}", s.DeleteImage).Methods("DELETE")
 	api.HandleFunc("/requests", s.GetRequestsHistory).Methods("GET")
+	api.HandleFunc("/requests/events", s.StreamRequestEvents).Methods("GET")
+	api.HandleFunc("/requests/{id}", s.GetRequest).Methods("GET")
+	api.HandleFunc("/requests/{id}", s.DeleteRequest).Methods("DELETE")
+	api.HandleFunc("/batches", s.CreateBatch).Methods("POST")
+	api.HandleFunc("/batches/{id}", s.GetBatch).Methods("GET")
+	api.HandleFunc("/batches/{id}/archive", s.DownloadBatch).Methods("GET")
+	api.HandleFunc("/webhooks", s.RegisterWebhook).Methods("POST")
+	api.HandleFunc("/webhooks", s.ListWebhooks).Methods("GET")
+	api.HandleFunc("/webhooks/{id}", s.DeleteWebhook).Methods("DELETE")
+	api.HandleFunc("/webhooks/{id}/deliveries", s.GetWebhookDeliveries).Methods("GET")
 }
 
 // LogIn implements the user authentication process.
@@ -115,6 +137,65 @@ func (s *Server) SignUp(w http.ResponseWriter, r *http.Request) {
 	sendResponse(w, signUpResponse{UserID: userID}, http.StatusCreated)
 }
 
+// refreshRequest represents the body of the refresh and logout requests.
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// readRefreshToken decodes the refresh token from the request body.
+func readRefreshToken(r *http.Request) (string, error) {
+	var request refreshRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		return "", fmt.Errorf("can't decode request body")
+	}
+	defer r.Body.Close()
+
+	if request.RefreshToken == "" {
+		return "", fmt.Errorf("empty refresh token")
+	}
+
+	return request.RefreshToken, nil
+}
+
+// RefreshToken exchanges the refresh token for the new pair of the access and refresh tokens.
+func (s *Server) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	refreshToken, err := readRefreshToken(r)
+	if err != nil {
+		reportErrorWithCode(w, err, http.StatusBadRequest)
+		return
+	}
+
+	accessToken, refreshToken, err := s.authService.Refresh(r.Context(), refreshToken)
+	if err != nil {
+		reportError(w, err)
+		return
+	}
+
+	type refreshResponse struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	sendResponse(w, refreshResponse{AccessToken: accessToken, RefreshToken: refreshToken}, http.StatusOK)
+}
+
+// LogOut revokes the refresh token together with the other tokens of the login session.
+func (s *Server) LogOut(w http.ResponseWriter, r *http.Request) {
+	refreshToken, err := readRefreshToken(r)
+	if err != nil {
+		reportErrorWithCode(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if err = s.authService.LogOut(r.Context(), refreshToken); err != nil {
+		reportError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 // ConvertImage converts needed image according to the request.
 func (s *Server) ConvertImage(w http.ResponseWriter, r *http.Request) {
 	sourceFile, header, err := r.FormFile("file")
@@ -124,9 +205,7 @@ func (s *Server) ConvertImage(w http.ResponseWriter, r *http.Request) {
 	}
 	defer sourceFile.Close()
 
-	parts := strings.Split(header.Filename, ".")
-	sourceFormat := parts[len(parts)-1]
-	filename := strings.TrimSuffix(header.Filename, "."+sourceFormat)
+	filename, sourceFormat := splitFilename(header.Filename)
 	targetFormat := r.FormValue("targetFormat")
 	ratio, err := strconv.Atoi(r.FormValue("ratio"))
 	if err != nil {
@@ -134,12 +213,48 @@ func (s *Server) ConvertImage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	opts, err := parseConversionOptions(r)
+	if err != nil {
+		reportErrorWithCode(w, err, http.StatusBadRequest)
+		return
+	}
+
 	if err = validation.ValidateConversionRequest(filename, sourceFormat, targetFormat, ratio); err != nil {
 		reportErrorWithCode(w, err, http.StatusBadRequest)
 		return
 	}
 
-	sourceFileID, requestID, err := s.imageService.Convert(r.Context(), sourceFile, filename, sourceFormat, targetFormat, ratio)
+	if err = validation.ValidateConversionOptions(opts); err != nil {
+		reportErrorWithCode(w, err, http.StatusBadRequest)
+		return
+	}
+
+	renditions, err := parseRenditions(r, targetFormat, ratio)
+	if err != nil {
+		reportErrorWithCode(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if err = validation.ValidateRenditions(renditions); err != nil {
+		reportErrorWithCode(w, err, http.StatusBadRequest)
+		return
+	}
+
+	priority := service.TierPriority
+	if raw := r.FormValue("priority"); raw != "" {
+		priority, err = strconv.Atoi(raw)
+		if err != nil {
+			reportErrorWithCode(w, fmt.Errorf("invalid priority form value"), http.StatusBadRequest)
+			return
+		}
+
+		if err = validation.ValidatePriority(priority); err != nil {
+			reportErrorWithCode(w, err, http.StatusBadRequest)
+			return
+		}
+	}
+
+	_, requestID, err := s.imageService.Convert(r.Context(), sourceFile, filename, sourceFormat, targetFormat, ratio, priority, opts, renditions)
 	if err != nil {
 		reportError(w, err)
 		return
@@ -150,13 +265,78 @@ func (s *Server) ConvertImage(w http.ResponseWriter, r *http.Request) {
 	}
 
 	sendResponse(w, convertResponse{RequestID: requestID}, http.StatusAccepted)
+}
 
-	err = s.producer.SendToQueue(sourceFileID, filename, sourceFormat, targetFormat, requestID, ratio)
-	if err != nil {
-		reportErrorWithCode(w, fmt.Errorf("can't send data to queue: %w", err), http.StatusInternalServerError)
-		return
+// parseConversionOptions reads the optional resize, crop, rotation, flip and metadata form values.
+func parseConversionOptions(r *http.Request) (converter.Options, error) {
+	opts := converter.Options{
+		Fit:      r.FormValue("fit"),
+		Flip:     r.FormValue("flip"),
+		Metadata: r.FormValue("metadata"),
 	}
-	logger.FromContext(r.Context()).Infoln("message has been sent to the queue")
+
+	var crop converter.Crop
+	hasCrop := false
+
+	intValues := []struct {
+		key    string
+		dst    *int
+		isCrop bool
+	}{
+		{key: "width", dst: &opts.Width},
+		{key: "height", dst: &opts.Height},
+		{key: "rotation", dst: &opts.Rotation},
+		{key: "cropX", dst: &crop.X, isCrop: true},
+		{key: "cropY", dst: &crop.Y, isCrop: true},
+		{key: "cropWidth", dst: &crop.Width, isCrop: true},
+		{key: "cropHeight", dst: &crop.Height, isCrop: true},
+	}
+
+	for _, v := range intValues {
+		raw := r.FormValue(v.key)
+		if raw == "" {
+			continue
+		}
+
+		value, err := strconv.Atoi(raw)
+		if err != nil {
+			return converter.Options{}, fmt.Errorf("invalid %s form value", v.key)
+		}
+
+		*v.dst = value
+		hasCrop = hasCrop || v.isCrop
+	}
+
+	if hasCrop {
+		opts.Crop = &crop
+	}
+
+	return opts, nil
+}
+
+// parseRenditions reads the optional JSON list of renditions from the form.
+// Renditions without format or ratio inherit them from the main conversion.
+func parseRenditions(r *http.Request, targetFormat string, ratio int) ([]converter.Rendition, error) {
+	raw := r.FormValue("renditions")
+	if raw == "" {
+		return nil, nil
+	}
+
+	var renditions []converter.Rendition
+	if err := json.Unmarshal([]byte(raw), &renditions); err != nil {
+		return nil, fmt.Errorf("invalid renditions form value")
+	}
+
+	for i := range renditions {
+		if renditions[i].Format == "" {
+			renditions[i].Format = targetFormat
+		}
+		if renditions[i].Ratio == 0 {
+			renditions[i].Ratio = ratio
+		}
+	}
+
+	return renditions, nil
 }
 
 // DownloadImage allows you to download original/converted image by id.
@@ -180,6 +360,17 @@ func (s *Server) DownloadImage(w http.ResponseWriter, r *http.Request) {
 	sendResponse(w, downloadResponse{ImageURL: url}, http.StatusOK)
 }
 
+// DeleteImage deletes the user's requests using the image together with their images.
+func (s *Server) DeleteImage(w http.ResponseWriter, r *http.Request) {
+	err := s.imageService.Delete(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		reportError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 // GetRequestsHistory displays the user's request history.
 func (s *Server) GetRequestsHistory(w http.ResponseWriter, r *http.Request) {
 	requests, err := s.requestsService.GetUsersRequests(r.Context())
@@ -190,3 +381,49 @@ func (s *Server) GetRequestsHistory(w http.ResponseWriter, r *http.Request) {
 
 	sendResponse(w, requests, http.StatusOK)
 }
+
+// GetRequest displays the user's conversion request.
+// The "wait" query parameter (for example 30s) holds the response until the request is done or failed.
+func (s *Server) GetRequest(w http.ResponseWriter, r *http.Request) {
+	var wait time.Duration
+	if raw := r.URL.Query().Get("wait"); raw != "" {
+		var err error
+		wait, err = parseWait(raw)
+		if err != nil {
+			reportErrorWithCode(w, fmt.Errorf("invalid wait query parameter"), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := validation.ValidateWait(wait); err != nil {
+		reportErrorWithCode(w, err, http.StatusBadRequest)
+		return
+	}
+
+	request, err := s.requestsService.GetRequest(r.Context(), mux.Vars(r)["id"], wait)
+	if err != nil {
+		reportError(w, err)
+		return
+	}
+
+	sendResponse(w, request, http.StatusOK)
+}
+
+// DeleteRequest deletes the user's done or failed request together with its images.
+func (s *Server) DeleteRequest(w http.ResponseWriter, r *http.Request) {
+	err := s.requestsService.Delete(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		reportError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// parseWait parses the wait time given either as a duration (30s) or as a number of seconds (30).
+func parseWait(raw string) (time.Duration, error) {
+	if seconds, err := strconv.Atoi(raw); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	return time.ParseDuration(raw)
+}
@@ -65,7 +65,7 @@ func TestServer_LogIn(t *testing.T) {
 			},
 			mockBehavior:         func(s *mockservice.MockAuthorization, req request) {},
 			expectedStatusCode:   http.StatusBadRequest,
-			expectedResponseBody: "empty field\n",
+			expectedResponseBody: `{"message":"empty field"}`,
 		},
 		{
 			name:        "Empty password",
@@ -76,7 +76,7 @@ func TestServer_LogIn(t *testing.T) {
 			},
 			mockBehavior:         func(s *mockservice.MockAuthorization, req request) {},
 			expectedStatusCode:   http.StatusBadRequest,
-			expectedResponseBody: "empty field\n",
+			expectedResponseBody: `{"message":"empty field"}`,
 		},
 	}
 
@@ -147,7 +147,7 @@ func TestServer_SignUp(t *testing.T) {
 			},
 			mockBehavior:         func(s *mockservice.MockAuthorization, req request) {},
 			expectedStatusCode:   http.StatusBadRequest,
-			expectedResponseBody: "invalid email: need minimum 8 characters\n",
+			expectedResponseBody: `{"message":"invalid email: need minimum 8 characters"}`,
 		},
 		{
 			name:        "Invalid email format",
@@ -158,7 +158,7 @@ func TestServer_SignUp(t *testing.T) {
 			},
 			mockBehavior:         func(s *mockservice.MockAuthorization, req request) {},
 			expectedStatusCode:   http.StatusBadRequest,
-			expectedResponseBody: "invalid email: doesn't match the correct address format (for example ivan.ivanov@gmail.com)\n",
+			expectedResponseBody: `{"message":"invalid email: doesn't match the correct address format (for example ivan.ivanov@gmail.com)"}`,
 		},
 		{
 			name:        "Invalid password length",
@@ -169,7 +169,7 @@ func TestServer_SignUp(t *testing.T) {
 			},
 			mockBehavior:         func(s *mockservice.MockAuthorization, req request) {},
 			expectedStatusCode:   http.StatusBadRequest,
-			expectedResponseBody: "invalid password: length must be from 8 to 20 characters\n",
+			expectedResponseBody: `{"message":"invalid password: length must be from 8 to 20 characters"}`,
 		},
 		{
 			name:        "Invalid password no lowercase",
@@ -180,7 +180,7 @@ func TestServer_SignUp(t *testing.T) {
 			},
 			mockBehavior:         func(s *mockservice.MockAuthorization, req request) {},
 			expectedStatusCode:   http.StatusBadRequest,
-			expectedResponseBody: "invalid password: need at least one lowercase character\n",
+			expectedResponseBody: `{"message":"invalid password: need at least one lowercase character"}`,
 		},
 		{
 			name:        "Invalid password no uppercase",
@@ -191,7 +191,7 @@ func TestServer_SignUp(t *testing.T) {
 			},
 			mockBehavior:         func(s *mockservice.MockAuthorization, req request) {},
 			expectedStatusCode:   http.StatusBadRequest,
-			expectedResponseBody: "invalid password: need at least one uppercase character\n",
+			expectedResponseBody: `{"message":"invalid password: need at least one uppercase character"}`,
 		},
 		{
 			name:        "Invalid password no digit",
@@ -202,7 +202,7 @@ func TestServer_SignUp(t *testing.T) {
 			},
 			mockBehavior:         func(s *mockservice.MockAuthorization, req request) {},
 			expectedStatusCode:   http.StatusBadRequest,
-			expectedResponseBody: "invalid password: need at least one digit\n",
+			expectedResponseBody: `{"message":"invalid password: need at least one digit"}`,
 		},
 		{
 			name:        "User already exists",
@@ -220,7 +220,7 @@ func TestServer_SignUp(t *testing.T) {
 					})
 			},
 			expectedStatusCode:   http.StatusBadRequest,
-			expectedResponseBody: "the user with the given email already exists\n",
+			expectedResponseBody: `{"message":"the user with the given email already exists"}`,
 		},
 		{
 			name:        "Cannot generate password hash",
@@ -238,7 +238,7 @@ func TestServer_SignUp(t *testing.T) {
 					})
 			},
 			expectedStatusCode:   http.StatusInternalServerError,
-			expectedResponseBody: "cannot generate password hash\n",
+			expectedResponseBody: `{"message":"cannot generate password hash"}`,
 		},
 	}
 
@@ -266,6 +266,87 @@ func TestServer_SignUp(t *testing.T) {
 	}
 }
 
+func TestServer_RefreshToken(t *testing.T) {
+	testTable := []struct {
+		name                 string
+		requestBody          string
+		mockBehavior         func(s *mockservice.MockAuthorization)
+		expectedStatusCode   int
+		expectedResponseBody string
+	}{
+		{
+			name:        "Ok",
+			requestBody: `{"refresh_token": "token2"}`,
+			mockBehavior: func(s *mockservice.MockAuthorization) {
+				s.EXPECT().Refresh(gomock.Any(), "token2").Return("token3", "token4", nil)
+			},
+			expectedStatusCode:   http.StatusOK,
+			expectedResponseBody: `{"access_token":"token3","refresh_token":"token4"}`,
+		},
+		{
+			name:                 "Empty refresh token",
+			requestBody:          `{"refresh_token": ""}`,
+			mockBehavior:         func(s *mockservice.MockAuthorization) {},
+			expectedStatusCode:   http.StatusBadRequest,
+			expectedResponseBody: `{"message":"empty refresh token"}`,
+		},
+		{
+			name:        "Reused refresh token",
+			requestBody: `{"refresh_token": "token2"}`,
+			mockBehavior: func(s *mockservice.MockAuthorization) {
+				s.EXPECT().Refresh(gomock.Any(), "token2").Return("", "",
+					&service.InternalError{Err: repository.ErrRefreshTokenReused, StatusCode: http.StatusUnauthorized})
+			},
+			expectedStatusCode:   http.StatusUnauthorized,
+			expectedResponseBody: `{"message":"refresh token has already been used, the session is revoked"}`,
+		},
+	}
+
+	for _, tc := range testTable {
+		t.Run(tc.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			auth := mockservice.NewMockAuthorization(c)
+			tc.mockBehavior(auth)
+
+			s := Server{authService: auth}
+
+			r := mux.NewRouter()
+			r.HandleFunc("/user/refresh", s.RefreshToken).Methods("POST")
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/user/refresh", bytes.NewBufferString(tc.requestBody))
+
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.expectedStatusCode, w.Code)
+			assert.Equal(t, tc.expectedResponseBody, w.Body.String())
+		})
+	}
+}
+
+func TestServer_LogOut(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	auth := mockservice.NewMockAuthorization(c)
+	auth.EXPECT().LogOut(gomock.Any(), "token2").Return(nil)
+
+	s := Server{authService: auth}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/user/logout", s.LogOut).Methods("POST")
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/user/logout", bytes.NewBufferString(`{"refresh_token": "token2"}`))
+
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Empty(t, w.Body.String())
+}
+
 func TestServer_DownloadImage(t *testing.T) {
 	testTable := []struct {
 		name                 string
@@ -290,7 +371,7 @@ func TestServer_DownloadImage(t *testing.T) {
 			imageID:              "",
 			mockBehavior:         func(s *mockservice.MockImages, id string) {},
 			expectedStatusCode:   http.StatusBadRequest,
-			expectedResponseBody: "image id is missing in parameters\n",
+			expectedResponseBody: `{"message":"image id is missing in parameters"}`,
 		},
 		{
 			name:    "Cannot get user id from context",
@@ -304,7 +385,7 @@ func TestServer_DownloadImage(t *testing.T) {
 					})
 			},
 			expectedStatusCode:   http.StatusUnauthorized,
-			expectedResponseBody: "can't get user id from application context\n",
+			expectedResponseBody: `{"message":"can't get user id from application context"}`,
 		},
 		{
 			name:    "No such image",
@@ -318,7 +399,7 @@ func TestServer_DownloadImage(t *testing.T) {
 					})
 			},
 			expectedStatusCode:   http.StatusNotFound,
-			expectedResponseBody: "no such image\n",
+			expectedResponseBody: `{"message":"no such image"}`,
 		},
 		{
 			name:    "Storage error",
@@ -332,7 +413,7 @@ func TestServer_DownloadImage(t *testing.T) {
 					})
 			},
 			expectedStatusCode:   http.StatusInternalServerError,
-			expectedResponseBody: "can't get image url\n",
+			expectedResponseBody: `{"message":"can't get image url"}`,
 		},
 	}
 
@@ -405,7 +486,7 @@ func TestServer_GetRequestsHistory(t *testing.T) {
 					})
 			},
 			expectedStatusCode:   http.StatusInternalServerError,
-			expectedResponseBody: "can't get user id from application context\n",
+			expectedResponseBody: `{"message":"can't get user id from application context"}`,
 		},
 		{
 			name: "Repository error",
@@ -418,7 +499,7 @@ func TestServer_GetRequestsHistory(t *testing.T) {
 					})
 			},
 			expectedStatusCode:   http.StatusInternalServerError,
-			expectedResponseBody: "repository error\n",
+			expectedResponseBody: `{"message":"repository error"}`,
 		},
 	}
 
@@ -446,6 +527,205 @@ func TestServer_GetRequestsHistory(t *testing.T) {
 	}
 }
 
+func TestServer_GetRequest(t *testing.T) {
+	defaultResponseBody := repository.ConversionRequest{ID: "1", UserID: "1", SourceID: "11", TargetID: "12",
+		SourceFormat: "jpg", TargetFormat: "png", Ratio: 90, Status: "done"}
+
+	respJSON, err := json.Marshal(defaultResponseBody)
+	if err != nil {
+		t.Fatalf("can't marshal response body: %v", err)
+	}
+
+	testTable := []struct {
+		name                 string
+		url                  string
+		mockBehavior         func(s *mockservice.MockRequests)
+		expectedStatusCode   int
+		expectedResponseBody string
+	}{
+		{
+			name: "Ok",
+			url:  "/requests/1",
+			mockBehavior: func(s *mockservice.MockRequests) {
+				s.EXPECT().GetRequest(gomock.Any(), "1", time.Duration(0)).Return(defaultResponseBody, nil)
+			},
+			expectedStatusCode:   http.StatusOK,
+			expectedResponseBody: string(respJSON),
+		},
+		{
+			name: "Ok with wait duration",
+			url:  "/requests/1?wait=30s",
+			mockBehavior: func(s *mockservice.MockRequests) {
+				s.EXPECT().GetRequest(gomock.Any(), "1", 30*time.Second).Return(defaultResponseBody, nil)
+			},
+			expectedStatusCode:   http.StatusOK,
+			expectedResponseBody: string(respJSON),
+		},
+		{
+			name: "Ok with wait seconds",
+			url:  "/requests/1?wait=15",
+			mockBehavior: func(s *mockservice.MockRequests) {
+				s.EXPECT().GetRequest(gomock.Any(), "1", 15*time.Second).Return(defaultResponseBody, nil)
+			},
+			expectedStatusCode:   http.StatusOK,
+			expectedResponseBody: string(respJSON),
+		},
+		{
+			name:                 "Invalid wait query parameter",
+			url:                  "/requests/1?wait=soon",
+			mockBehavior:         func(s *mockservice.MockRequests) {},
+			expectedStatusCode:   http.StatusBadRequest,
+			expectedResponseBody: `{"message":"invalid wait query parameter"}`,
+		},
+		{
+			name:                 "Too long wait",
+			url:                  "/requests/1?wait=2m",
+			mockBehavior:         func(s *mockservice.MockRequests) {},
+			expectedStatusCode:   http.StatusBadRequest,
+			expectedResponseBody: `{"message":"invalid wait: needed a duration from 0s to 1m0s"}`,
+		},
+		{
+			name: "No such request",
+			url:  "/requests/1",
+			mockBehavior: func(s *mockservice.MockRequests) {
+				s.EXPECT().GetRequest(gomock.Any(), "1", time.Duration(0)).
+					Return(repository.ConversionRequest{}, &service.InternalError{
+						Err:        repository.ErrNoSuchRequest,
+						StatusCode: http.StatusNotFound,
+					})
+			},
+			expectedStatusCode:   http.StatusNotFound,
+			expectedResponseBody: `{"message":"request with this id does not exists"}`,
+		},
+	}
+
+	for _, tc := range testTable {
+		t.Run(tc.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			rs := mockservice.NewMockRequests(c)
+			tc.mockBehavior(rs)
+
+			s := Server{requestsService: rs}
+
+			r := mux.NewRouter()
+			r.HandleFunc("/requests/{id}", s.GetRequest).Methods("GET")
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", tc.url, nil)
+
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.expectedStatusCode, w.Code)
+			assert.Equal(t, tc.expectedResponseBody, w.Body.String())
+		})
+	}
+}
+
+func TestServer_DeleteRequest(t *testing.T) {
+	testTable := []struct {
+		name                 string
+		mockBehavior         func(s *mockservice.MockRequests)
+		expectedStatusCode   int
+		expectedResponseBody string
+	}{
+		{
+			name: "Ok",
+			mockBehavior: func(s *mockservice.MockRequests) {
+				s.EXPECT().Delete(gomock.Any(), "1").Return(nil)
+			},
+			expectedStatusCode: http.StatusNoContent,
+		},
+		{
+			name: "Request is processing",
+			mockBehavior: func(s *mockservice.MockRequests) {
+				s.EXPECT().Delete(gomock.Any(), "1").
+					Return(&service.InternalError{Err: repository.ErrRequestInProgress, StatusCode: http.StatusConflict})
+			},
+			expectedStatusCode:   http.StatusConflict,
+			expectedResponseBody: `{"message":"request is still processing"}`,
+		},
+		{
+			name: "No such request",
+			mockBehavior: func(s *mockservice.MockRequests) {
+				s.EXPECT().Delete(gomock.Any(), "1").
+					Return(&service.InternalError{Err: repository.ErrNoSuchRequest, StatusCode: http.StatusNotFound})
+			},
+			expectedStatusCode:   http.StatusNotFound,
+			expectedResponseBody: `{"message":"request with this id does not exists"}`,
+		},
+	}
+
+	for _, tc := range testTable {
+		t.Run(tc.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			rs := mockservice.NewMockRequests(c)
+			tc.mockBehavior(rs)
+
+			s := Server{requestsService: rs}
+
+			r := mux.NewRouter()
+			r.HandleFunc("/requests/{id}", s.DeleteRequest).Methods("DELETE")
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("DELETE", "/requests/1", nil))
+
+			assert.Equal(t, tc.expectedStatusCode, w.Code)
+			assert.Equal(t, tc.expectedResponseBody, w.Body.String())
+		})
+	}
+}
+
+func TestServer_DeleteImage(t *testing.T) {
+	testTable := []struct {
+		name                 string
+		mockBehavior         func(s *mockservice.MockImages)
+		expectedStatusCode   int
+		expectedResponseBody string
+	}{
+		{
+			name: "Ok",
+			mockBehavior: func(s *mockservice.MockImages) {
+				s.EXPECT().Delete(gomock.Any(), "1").Return(nil)
+			},
+			expectedStatusCode: http.StatusNoContent,
+		},
+		{
+			name: "No such image",
+			mockBehavior: func(s *mockservice.MockImages) {
+				s.EXPECT().Delete(gomock.Any(), "1").
+					Return(&service.InternalError{Err: repository.ErrNoSuchImage, StatusCode: http.StatusNotFound})
+			},
+			expectedStatusCode:   http.StatusNotFound,
+			expectedResponseBody: `{"message":"the image with this id does not exist"}`,
+		},
+	}
+
+	for _, tc := range testTable {
+		t.Run(tc.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			is := mockservice.NewMockImages(c)
+			tc.mockBehavior(is)
+
+			s := Server{imageService: is}
+
+			r := mux.NewRouter()
+			r.HandleFunc("/images/{id}", s.DeleteImage).Methods("DELETE")
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("DELETE", "/images/1", nil))
+
+			assert.Equal(t, tc.expectedStatusCode, w.Code)
+			assert.Equal(t, tc.expectedResponseBody, w.Body.String())
+		})
+	}
+}
+
 func createMockRequest(t *testing.T, filename, formFileKey, url, method string, params map[string]string) *http.Request {
 	file, err := os.Create(filename)
 	require.NoError(t, err)
@@ -504,7 +784,7 @@ func TestServer_ConvertImage(t *testing.T) {
 	testTable := []struct {
 		name                 string
 		request              request
-		mockBehavior         func(s *mockservice.MockImages, p *mockservice.MockProducer, request request)
+		mockBehavior         func(s *mockservice.MockImages, request request)
 		expectedStatusCode   int
 		expectedResponseBody string
 	}{
@@ -518,16 +798,63 @@ func TestServer_ConvertImage(t *testing.T) {
 					ratioKey:        defaultRatio,
 				},
 			},
-			mockBehavior: func(s *mockservice.MockImages, p *mockservice.MockProducer, request request) {
+			mockBehavior: func(s *mockservice.MockImages, request request) {
 				s.EXPECT().
 					Convert(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(),
-						gomock.Any(), gomock.Any()).Return("1", "1", nil)
-				p.EXPECT().
-					SendToQueue(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any())
+						gomock.Any(), gomock.Any(), service.TierPriority, gomock.Any(), gomock.Any()).Return("1", "1", nil)
 			},
 			expectedStatusCode:   http.StatusAccepted,
 			expectedResponseBody: `{"request_id":"1"}`,
 		},
+		{
+			name: "Ok with priority",
+			request: request{
+				formFileKey: defaultFileForm,
+				filename:    defaultFilename,
+				params: map[string]string{
+					targetFormatKey: defaultTargetFormat,
+					ratioKey:        defaultRatio,
+					"priority":      "0",
+				},
+			},
+			mockBehavior: func(s *mockservice.MockImages, request request) {
+				s.EXPECT().
+					Convert(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(),
+						gomock.Any(), gomock.Any(), 0, gomock.Any(), gomock.Any()).Return("1", "1", nil)
+			},
+			expectedStatusCode:   http.StatusAccepted,
+			expectedResponseBody: `{"request_id":"1"}`,
+		},
+		{
+			name: "Invalid priority form value",
+			request: request{
+				formFileKey: defaultFileForm,
+				filename:    defaultFilename,
+				params: map[string]string{
+					targetFormatKey: defaultTargetFormat,
+					ratioKey:        defaultRatio,
+					"priority":      "high",
+				},
+			},
+			mockBehavior:         func(s *mockservice.MockImages, request request) {},
+			expectedStatusCode:   http.StatusBadRequest,
+			expectedResponseBody: `{"message":"invalid priority form value"}`,
+		},
+		{
+			name: "Invalid priority",
+			request: request{
+				formFileKey: defaultFileForm,
+				filename:    defaultFilename,
+				params: map[string]string{
+					targetFormatKey: defaultTargetFormat,
+					ratioKey:        defaultRatio,
+					"priority":      "10",
+				},
+			},
+			mockBehavior:         func(s *mockservice.MockImages, request request) {},
+			expectedStatusCode:   http.StatusBadRequest,
+			expectedResponseBody: `{"message":"invalid priority: needed a value from 0 to 9 inclusive"}`,
+		},
 		{
 			name: "Invalid file form",
 			request: request{
@@ -538,9 +865,9 @@ func TestServer_ConvertImage(t *testing.T) {
 					ratioKey:        defaultRatio,
 				},
 			},
-			mockBehavior:         func(s *mockservice.MockImages, p *mockservice.MockProducer, request request) {},
+			mockBehavior:         func(s *mockservice.MockImages, request request) {},
 			expectedStatusCode:   http.StatusBadRequest,
-			expectedResponseBody: "can't get sourceFile from form\n",
+			expectedResponseBody: `{"message":"can't get sourceFile from form"}`,
 		},
 		{
 			name: "Invalid ration form value",
@@ -552,9 +879,9 @@ func TestServer_ConvertImage(t *testing.T) {
 					ratioKey:        "ratio_string_value",
 				},
 			},
-			mockBehavior:         func(s *mockservice.MockImages, p *mockservice.MockProducer, request request) {},
+			mockBehavior:         func(s *mockservice.MockImages, request request) {},
 			expectedStatusCode:   http.StatusBadRequest,
-			expectedResponseBody: "invalid ratio form value\n",
+			expectedResponseBody: `{"message":"invalid ratio form value"}`,
 		},
 		{
 			name: "Invalid filename",
@@ -566,9 +893,9 @@ func TestServer_ConvertImage(t *testing.T) {
 					ratioKey:        defaultRatio,
 				},
 			},
-			mockBehavior:         func(s *mockservice.MockImages, p *mockservice.MockProducer, request request) {},
+			mockBehavior:         func(s *mockservice.MockImages, request request) {},
 			expectedStatusCode:   http.StatusBadRequest,
-			expectedResponseBody: "invalid filename: shouldn't contain space and any special characters like :;<>{}[]+=?&,\"\n",
+			expectedResponseBody: `{"message":"invalid filename: shouldn't contain space and any special characters like :;\u003c\u003e{}[]+=?\u0026,\""}`,
 		},
 		{
 			name: "Invalid source format",
@@ -580,9 +907,9 @@ func TestServer_ConvertImage(t *testing.T) {
 					ratioKey:        defaultRatio,
 				},
 			},
-			mockBehavior:         func(s *mockservice.MockImages, p *mockservice.MockProducer, request request) {},
+			mockBehavior:         func(s *mockservice.MockImages, request request) {},
 			expectedStatusCode:   http.StatusBadRequest,
-			expectedResponseBody: "invalid source format: needed jpg or png\n",
+			expectedResponseBody: `{"message":"invalid source format: needed one of bmp, gif, jpg, png, tiff, webp"}`,
 		},
 		{
 			name: "Invalid target format",
@@ -594,9 +921,9 @@ func TestServer_ConvertImage(t *testing.T) {
 					ratioKey:        defaultRatio,
 				},
 			},
-			mockBehavior:         func(s *mockservice.MockImages, p *mockservice.MockProducer, request request) {},
+			mockBehavior:         func(s *mockservice.MockImages, request request) {},
 			expectedStatusCode:   http.StatusBadRequest,
-			expectedResponseBody: "invalid target format: needed jpg or png\n",
+			expectedResponseBody: `{"message":"invalid target format: needed one of bmp, gif, jpg, png, tiff"}`,
 		},
 		{
 			name: "Invalid formats",
@@ -608,9 +935,9 @@ func TestServer_ConvertImage(t *testing.T) {
 					ratioKey:        defaultRatio,
 				},
 			},
-			mockBehavior:         func(s *mockservice.MockImages, p *mockservice.MockProducer, request request) {},
+			mockBehavior:         func(s *mockservice.MockImages, request request) {},
 			expectedStatusCode:   http.StatusBadRequest,
-			expectedResponseBody: "invalid formats: source and target formats should differ\n",
+			expectedResponseBody: `{"message":"invalid formats: source and target formats should differ"}`,
 		},
 		{
 			name: "Invalid ratio",
@@ -622,9 +949,69 @@ func TestServer_ConvertImage(t *testing.T) {
 					ratioKey:        "101",
 				},
 			},
-			mockBehavior:         func(s *mockservice.MockImages, p *mockservice.MockProducer, request request) {},
+			mockBehavior:         func(s *mockservice.MockImages, request request) {},
+			expectedStatusCode:   http.StatusBadRequest,
+			expectedResponseBody: `{"message":"invalid ratio: needed a value from 1 to 99 inclusive"}`,
+		},
+		{
+			name: "Invalid width form value",
+			request: request{
+				formFileKey: defaultFileForm,
+				filename:    defaultFilename,
+				params: map[string]string{
+					targetFormatKey: defaultTargetFormat,
+					ratioKey:        defaultRatio,
+					"width":         "wide",
+				},
+			},
+			mockBehavior:         func(s *mockservice.MockImages, request request) {},
 			expectedStatusCode:   http.StatusBadRequest,
-			expectedResponseBody: "invalid ratio: needed a value from 1 to 99 inclusive\n",
+			expectedResponseBody: `{"message":"invalid width form value"}`,
+		},
+		{
+			name: "Invalid rotation",
+			request: request{
+				formFileKey: defaultFileForm,
+				filename:    defaultFilename,
+				params: map[string]string{
+					targetFormatKey: defaultTargetFormat,
+					ratioKey:        defaultRatio,
+					"rotation":      "45",
+				},
+			},
+			mockBehavior:         func(s *mockservice.MockImages, request request) {},
+			expectedStatusCode:   http.StatusBadRequest,
+			expectedResponseBody: `{"message":"invalid rotation: needed 90, 180 or 270"}`,
+		},
+		{
+			name: "Invalid renditions form value",
+			request: request{
+				formFileKey: defaultFileForm,
+				filename:    defaultFilename,
+				params: map[string]string{
+					targetFormatKey: defaultTargetFormat,
+					ratioKey:        defaultRatio,
+					"renditions":    "small",
+				},
+			},
+			mockBehavior:         func(s *mockservice.MockImages, request request) {},
+			expectedStatusCode:   http.StatusBadRequest,
+			expectedResponseBody: `{"message":"invalid renditions form value"}`,
+		},
+		{
+			name: "Invalid rendition size",
+			request: request{
+				formFileKey: defaultFileForm,
+				filename:    defaultFilename,
+				params: map[string]string{
+					targetFormatKey: defaultTargetFormat,
+					ratioKey:        defaultRatio,
+					"renditions":    `[{"name":"small"}]`,
+				},
+			},
+			mockBehavior:         func(s *mockservice.MockImages, request request) {},
+			expectedStatusCode:   http.StatusBadRequest,
+			expectedResponseBody: `{"message":"invalid rendition size: needed width or height from 1 to 10000 inclusive"}`,
 		},
 	}
 
@@ -634,9 +1021,8 @@ func TestServer_ConvertImage(t *testing.T) {
 			defer c.Finish()
 
 			is := mockservice.NewMockImages(c)
-			p := mockservice.NewMockProducer(c)
 
-			s := Server{imageService: is, producer: p}
+			s := Server{imageService: is}
 
 			r := mux.NewRouter()
 			r.HandleFunc("/conversion", s.ConvertImage).Methods("POST")
@@ -647,7 +1033,7 @@ func TestServer_ConvertImage(t *testing.T) {
 				tc.request.params)
 			defer os.Remove(tc.request.filename)
 
-			tc.mockBehavior(is, p, tc.request)
+			tc.mockBehavior(is, tc.request)
 
 			r.ServeHTTP(w, req)
 
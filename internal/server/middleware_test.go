@@ -51,7 +51,7 @@ func TestServer_AuthMiddleware(t *testing.T) {
 			token:                "token",
 			mockBehavior:         func(s *mockservice.MockAuthorization, token string) {},
 			expectedStatusCode:   http.StatusUnauthorized,
-			expectedResponseBody: "empty auth handler\n",
+			expectedResponseBody: `{"message":"empty auth handler"}`,
 		},
 		{
 			name:                 "Invalid header value",
@@ -60,7 +60,7 @@ func TestServer_AuthMiddleware(t *testing.T) {
 			token:                "token",
 			mockBehavior:         func(s *mockservice.MockAuthorization, token string) {},
 			expectedStatusCode:   http.StatusUnauthorized,
-			expectedResponseBody: "invalid auth handler\n",
+			expectedResponseBody: `{"message":"invalid auth handler"}`,
 		},
 		{
 			name:                 "Empty token",
@@ -69,7 +69,7 @@ func TestServer_AuthMiddleware(t *testing.T) {
 			token:                "token",
 			mockBehavior:         func(s *mockservice.MockAuthorization, token string) {},
 			expectedStatusCode:   http.StatusUnauthorized,
-			expectedResponseBody: "token is empty\n",
+			expectedResponseBody: `{"message":"token is empty"}`,
 		},
 		{
 			name:        "Token parsing error",
@@ -80,7 +80,7 @@ func TestServer_AuthMiddleware(t *testing.T) {
 				s.EXPECT().ParseToken(token).Return("", fmt.Errorf("invalid token"))
 			},
 			expectedStatusCode:   http.StatusUnauthorized,
-			expectedResponseBody: "can't parse JWT: invalid token\n",
+			expectedResponseBody: `{"message":"can't parse JWT: invalid token"}`,
 		},
 	}
 
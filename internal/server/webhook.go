@@ -0,0 +1,88 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/Konstantsiy/image-converter/internal/validation"
+	"github.com/gorilla/mux"
+)
+
+// RegisterWebhook registers the URL notified when the user's conversion requests are done or failed.
+// With the request id the webhook is notified only about that request.
+func (s *Server) RegisterWebhook(w http.ResponseWriter, r *http.Request) {
+	type webhookRequest struct {
+		URL       string `json:"url"`
+		RequestID string `json:"request_id"`
+	}
+
+	var request webhookRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		reportErrorWithCode(w, fmt.Errorf("can't decode request body"), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if err = validation.ValidateWebhookURL(request.URL); err != nil {
+		reportErrorWithCode(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if request.RequestID != "" {
+		if err = validation.ValidateID("request_id", request.RequestID); err != nil {
+			reportErrorWithCode(w, err, http.StatusBadRequest)
+			return
+		}
+	}
+
+	webhook, err := s.webhookService.Register(r.Context(), request.URL, request.RequestID)
+	if err != nil {
+		reportError(w, err)
+		return
+	}
+
+	type webhookResponse struct {
+		ID        string `json:"id"`
+		URL       string `json:"url"`
+		RequestID string `json:"request_id,omitempty"`
+		Secret    string `json:"secret"`
+	}
+
+	sendResponse(w, webhookResponse{ID: webhook.ID, URL: webhook.URL, RequestID: webhook.RequestID, Secret: webhook.Secret},
+		http.StatusCreated)
+}
+
+// ListWebhooks displays the user's webhooks.
+func (s *Server) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := s.webhookService.List(r.Context())
+	if err != nil {
+		reportError(w, err)
+		return
+	}
+
+	sendResponse(w, webhooks, http.StatusOK)
+}
+
+// DeleteWebhook deletes the user's webhook.
+func (s *Server) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	err := s.webhookService.Delete(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		reportError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetWebhookDeliveries displays the delivery log of the user's webhook.
+func (s *Server) GetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	deliveries, err := s.webhookService.GetDeliveries(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		reportError(w, err)
+		return
+	}
+
+	sendResponse(w, deliveries, http.StatusOK)
+}
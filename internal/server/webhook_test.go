@@ -0,0 +1,136 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Konstantsiy/image-converter/internal/repository"
+	"github.com/Konstantsiy/image-converter/internal/service"
+	mockservice "github.com/Konstantsiy/image-converter/internal/service/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer_RegisterWebhook(t *testing.T) {
+	testTable := []struct {
+		name                 string
+		body                 string
+		mockBehavior         func(s *mockservice.MockWebhooks)
+		expectedStatusCode   int
+		expectedResponseBody string
+	}{
+		{
+			name: "Ok",
+			body: `{"url":"https://example.com/hook","request_id":"0f6b3c1e-8f2a-11ec-b909-0242ac120002"}`,
+			mockBehavior: func(s *mockservice.MockWebhooks) {
+				s.EXPECT().
+					Register(gomock.Any(), "https://example.com/hook", "0f6b3c1e-8f2a-11ec-b909-0242ac120002").
+					Return(repository.Webhook{ID: "1", URL: "https://example.com/hook", RequestID: "0f6b3c1e-8f2a-11ec-b909-0242ac120002", Secret: "abc"}, nil)
+			},
+			expectedStatusCode:   http.StatusCreated,
+			expectedResponseBody: `{"id":"1","url":"https://example.com/hook","request_id":"0f6b3c1e-8f2a-11ec-b909-0242ac120002","secret":"abc"}`,
+		},
+		{
+			name:                 "Invalid body",
+			body:                 `{"url":`,
+			mockBehavior:         func(s *mockservice.MockWebhooks) {},
+			expectedStatusCode:   http.StatusBadRequest,
+			expectedResponseBody: `{"message":"can't decode request body"}`,
+		},
+		{
+			name:                 "Invalid URL",
+			body:                 `{"url":"example.com/hook"}`,
+			mockBehavior:         func(s *mockservice.MockWebhooks) {},
+			expectedStatusCode:   http.StatusBadRequest,
+			expectedResponseBody: `{"message":"invalid url: needed an absolute http or https URL"}`,
+		},
+		{
+			name:                 "Invalid request id",
+			body:                 `{"url":"https://example.com/hook","request_id":"2"}`,
+			mockBehavior:         func(s *mockservice.MockWebhooks) {},
+			expectedStatusCode:   http.StatusBadRequest,
+			expectedResponseBody: `{"message":"invalid request_id: needed a UUID"}`,
+		},
+		{
+			name: "No such request",
+			body: `{"url":"https://example.com/hook","request_id":"0f6b3c1e-8f2a-11ec-b909-0242ac120002"}`,
+			mockBehavior: func(s *mockservice.MockWebhooks) {
+				s.EXPECT().
+					Register(gomock.Any(), "https://example.com/hook", "0f6b3c1e-8f2a-11ec-b909-0242ac120002").
+					Return(repository.Webhook{}, &service.InternalError{Err: repository.ErrNoSuchRequest, StatusCode: http.StatusNotFound})
+			},
+			expectedStatusCode:   http.StatusNotFound,
+			expectedResponseBody: `{"message":"request with this id does not exists"}`,
+		},
+	}
+
+	for _, tc := range testTable {
+		t.Run(tc.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			ws := mockservice.NewMockWebhooks(c)
+			tc.mockBehavior(ws)
+
+			s := Server{webhookService: ws}
+
+			r := mux.NewRouter()
+			r.HandleFunc("/webhooks", s.RegisterWebhook).Methods("POST")
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/webhooks", bytes.NewBufferString(tc.body))
+
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.expectedStatusCode, w.Code)
+			assert.Equal(t, tc.expectedResponseBody, w.Body.String())
+		})
+	}
+}
+
+func TestServer_DeleteWebhook(t *testing.T) {
+	testTable := []struct {
+		name               string
+		mockBehavior       func(s *mockservice.MockWebhooks)
+		expectedStatusCode int
+	}{
+		{
+			name: "Ok",
+			mockBehavior: func(s *mockservice.MockWebhooks) {
+				s.EXPECT().Delete(gomock.Any(), "1").Return(nil)
+			},
+			expectedStatusCode: http.StatusNoContent,
+		},
+		{
+			name: "No such webhook",
+			mockBehavior: func(s *mockservice.MockWebhooks) {
+				s.EXPECT().Delete(gomock.Any(), "1").
+					Return(&service.InternalError{Err: repository.ErrNoSuchWebhook, StatusCode: http.StatusNotFound})
+			},
+			expectedStatusCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range testTable {
+		t.Run(tc.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			ws := mockservice.NewMockWebhooks(c)
+			tc.mockBehavior(ws)
+
+			s := Server{webhookService: ws}
+
+			r := mux.NewRouter()
+			r.HandleFunc("/webhooks/{id}", s.DeleteWebhook).Methods("DELETE")
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("DELETE", "/webhooks/1", nil))
+
+			assert.Equal(t, tc.expectedStatusCode, w.Code)
+		})
+	}
+}
@@ -0,0 +1,289 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/Konstantsiy/image-converter/internal/appcontext"
+	"github.com/Konstantsiy/image-converter/internal/config"
+	"github.com/Konstantsiy/image-converter/internal/repository"
+	"github.com/Konstantsiy/image-converter/internal/storage"
+	"github.com/Konstantsiy/image-converter/pkg/logger"
+)
+
+// AccountService implements the account deletion and the data export, both run as background jobs.
+type AccountService struct {
+	accountsRepo *repository.AccountJobsRepository
+	usersRepo    *repository.UsersRepository
+	requestsRepo *repository.RequestsRepository
+	imagesRepo   *repository.ImagesRepository
+	s3           storage.Storage
+	conf         *config.AccountJobsConfig
+}
+
+// NewAccountService creates new account service.
+func NewAccountService(accountsRepo *repository.AccountJobsRepository, usersRepo *repository.UsersRepository,
+	requestsRepo *repository.RequestsRepository, imagesRepo *repository.ImagesRepository, s3 storage.Storage,
+	conf *config.AccountJobsConfig) *AccountService {
+	return &AccountService{
+		accountsRepo: accountsRepo,
+		usersRepo:    usersRepo,
+		requestsRepo: requestsRepo,
+		imagesRepo:   imagesRepo,
+		s3:           s3,
+		conf:         conf,
+	}
+}
+
+// Delete queues the deletion of the user with all the requests, images and stored files.
+func (as *AccountService) Delete(ctx context.Context) (repository.AccountJob, error) {
+	return as.queue(ctx, repository.AccountJobDelete)
+}
+
+// Export queues the export of the user's requests history and images to the ZIP archive.
+func (as *AccountService) Export(ctx context.Context) (repository.AccountJob, error) {
+	return as.queue(ctx, repository.AccountJobExport)
+}
+
+func (as *AccountService) queue(ctx context.Context, kind string) (repository.AccountJob, error) {
+	userID, ok := appcontext.UserIDFromContext(ctx)
+	if !ok {
+		return repository.AccountJob{}, &InternalError{
+			fmt.Errorf("can't get user id from application context"),
+			http.StatusInternalServerError,
+		}
+	}
+
+	job, err := as.accountsRepo.InsertAccountJob(ctx, userID, kind)
+	if err != nil {
+		return repository.AccountJob{}, &InternalError{
+			fmt.Errorf("repository error: %w", err),
+			http.StatusInternalServerError}
+	}
+	logger.FromContext(ctx).WithField("job_id", job.ID).WithField("kind", kind).Infoln("account job queued")
+
+	return job, nil
+}
+
+// GetJob returns the user's account job, the done export gets the download URL of the archive.
+func (as *AccountService) GetJob(ctx context.Context, jobID string) (repository.AccountJob, error) {
+	userID, ok := appcontext.UserIDFromContext(ctx)
+	if !ok {
+		return repository.AccountJob{}, &InternalError{
+			fmt.Errorf("can't get user id from application context"),
+			http.StatusInternalServerError,
+		}
+	}
+
+	job, err := as.accountsRepo.GetAccountJob(ctx, userID, jobID)
+	if errors.Is(err, repository.ErrNoSuchAccountJob) {
+		return repository.AccountJob{}, &InternalError{err, http.StatusNotFound}
+	}
+	if err != nil {
+		return repository.AccountJob{}, &InternalError{err, http.StatusInternalServerError}
+	}
+
+	if job.Kind == repository.AccountJobExport && job.Status == repository.RequestStatusDone && job.FileID != "" {
+		job.DownloadURL, err = as.s3.GetDownloadURL(job.FileID)
+		if err != nil {
+			return repository.AccountJob{}, &InternalError{
+				fmt.Errorf("s3 error: %w", err),
+				http.StatusInternalServerError}
+		}
+	}
+
+	return job, nil
+}
+
+// Run processes the account jobs one by one until the context is canceled,
+// the new jobs are checked every PollInterval.
+func (as *AccountService) Run(ctx context.Context) {
+	for {
+		job, err := as.accountsRepo.ClaimAccountJob(ctx, as.conf.LeaseTimeout)
+		if err == nil {
+			as.process(ctx, job)
+			continue
+		}
+		if !errors.Is(err, repository.ErrNoAccountJobs) {
+			logger.FromContext(ctx).Errorln(fmt.Errorf("can't claim account job: %w", err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(as.conf.PollInterval):
+		}
+	}
+}
+
+// process runs the job and saves its result. The failed job is retried up to MaxAttempts times,
+// the deletion waiting for the user's unfinished requests is retried until they are done or failed.
+func (as *AccountService) process(ctx context.Context, job repository.AccountJob) {
+	log := logger.FromContext(ctx).WithField("job_id", job.ID).WithField("kind", job.Kind)
+
+	var fileID string
+	var err error
+	switch job.Kind {
+	case repository.AccountJobDelete:
+		err = as.deleteAccount(ctx, job.UserID)
+	case repository.AccountJobExport:
+		fileID = job.ID
+		err = as.exportAccount(ctx, job.UserID, fileID)
+	default:
+		err = fmt.Errorf("unknown account job kind %q", job.Kind)
+	}
+
+	switch {
+	case err == nil:
+		err = as.accountsRepo.FinishAccountJob(ctx, job.ID, repository.RequestStatusDone, fileID, "")
+		if err == nil {
+			log.Infoln("account job done")
+		}
+	case errors.Is(err, repository.ErrRequestInProgress) || job.Attempts < as.conf.MaxAttempts:
+		log.WithField("attempt", job.Attempts).Infoln(fmt.Errorf("account job will be retried: %w", err))
+		err = as.accountsRepo.RetryAccountJob(ctx, job.ID, as.conf.RetryDelay, err.Error())
+	default:
+		log.Errorln(fmt.Errorf("account job failed: %w", err))
+		err = as.accountsRepo.FinishAccountJob(ctx, job.ID, repository.RequestStatusFailed, "", err.Error())
+	}
+	if err != nil {
+		log.Errorln(fmt.Errorf("can't update account job: %w", err))
+	}
+}
+
+// deleteAccount deletes the user's requests with the images not used by other users, then the user.
+// The files that can't be removed are left to the retention sweeper.
+func (as *AccountService) deleteAccount(ctx context.Context, userID string) error {
+	imageIDs, err := as.requestsRepo.DeleteUserRequests(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("repository error: %w", err)
+	}
+
+	removeImages(ctx, as.imagesRepo, as.s3, imageIDs)
+
+	fileIDs, err := as.usersRepo.DeleteUser(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("repository error: %w", err)
+	}
+
+	for _, fileID := range fileIDs {
+		if err = as.s3.DeleteFile(fileID); err != nil {
+			logger.FromContext(ctx).WithField("file_id", fileID).
+				Errorln(fmt.Errorf("can't remove exported file: %w", err))
+		}
+	}
+	logger.FromContext(ctx).WithField("user_id", userID).Infoln("user deleted")
+
+	return nil
+}
+
+// exportAccount uploads the user's export archive to the storage with the given file id.
+// The archive is written to the pipe read by the storage upload, so that it's never held in memory.
+func (as *AccountService) exportAccount(ctx context.Context, userID, fileID string) error {
+	if _, err := as.usersRepo.GetUserPriority(ctx, userID); err != nil {
+		return fmt.Errorf("repository error: %w", err)
+	}
+
+	requests, err := as.requestsRepo.GetRequestsByUserID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("repository error: %w", err)
+	}
+
+	pr, pw := io.Pipe()
+	written := make(chan error, 1)
+	go func() {
+		err := as.writeExport(ctx, requests, pw)
+		pw.CloseWithError(err)
+		written <- err
+	}()
+
+	uploadErr := as.s3.UploadFile(pr, fileID)
+	pr.CloseWithError(io.ErrClosedPipe)
+	writeErr := <-written
+
+	if writeErr != nil && !errors.Is(writeErr, io.ErrClosedPipe) {
+		return fmt.Errorf("can't write export archive: %w", writeErr)
+	}
+	if uploadErr != nil {
+		return fmt.Errorf("s3 error: %w", uploadErr)
+	}
+
+	return nil
+}
+
+// writeExport writes the ZIP archive with the requests history as requests.json, the original images
+// as files/original/{id}.{format} and the converted images with the renditions as files/converted/{id}.{format}.
+// The images already removed by the retention are skipped.
+func (as *AccountService) writeExport(ctx context.Context, requests []repository.ConversionRequest, w io.Writer) error {
+	if requests == nil {
+		requests = []repository.ConversionRequest{}
+	}
+
+	zw := zip.NewWriter(w)
+
+	entry, err := zw.Create("requests.json")
+	if err != nil {
+		return fmt.Errorf("can't create archive entry: %w", err)
+	}
+	enc := json.NewEncoder(entry)
+	enc.SetIndent("", "  ")
+	if err = enc.Encode(requests); err != nil {
+		return fmt.Errorf("can't write requests history: %w", err)
+	}
+
+	// The images shared by several requests are written once.
+	written := make(map[string]bool)
+	for _, r := range requests {
+		files := [][2]string{{r.SourceID, "files/original/" + r.SourceID + "." + r.SourceFormat}}
+		if r.TargetID != "" {
+			files = append(files, [2]string{r.TargetID, "files/converted/" + r.TargetID + "." + r.TargetFormat})
+		}
+		for _, rd := range r.Renditions {
+			if rd.ImageID != "" {
+				files = append(files, [2]string{rd.ImageID, "files/converted/" + rd.ImageID + "." + rd.Format})
+			}
+		}
+
+		for _, f := range files {
+			if written[f[0]] {
+				continue
+			}
+			if err = ctx.Err(); err != nil {
+				return err
+			}
+			if err = as.writeExportFile(zw, f[0], f[1]); err != nil {
+				return err
+			}
+			written[f[0]] = true
+		}
+	}
+
+	return zw.Close()
+}
+
+func (as *AccountService) writeExportFile(zw *zip.Writer, fileID, name string) error {
+	file, err := as.s3.DownloadFile(fileID)
+	if errors.Is(err, storage.ErrNoSuchFile) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("s3 error: %w", err)
+	}
+	defer file.Close()
+
+	entry, err := zw.Create(name)
+	if err != nil {
+		return fmt.Errorf("can't create archive entry: %w", err)
+	}
+	if _, err = io.Copy(entry, file); err != nil {
+		return fmt.Errorf("can't write archive entry: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+
+	"github.com/Konstantsiy/image-converter/internal/converter"
+	"github.com/Konstantsiy/image-converter/internal/repository"
+	"github.com/Konstantsiy/image-converter/internal/storage"
+	mockstorage "github.com/Konstantsiy/image-converter/internal/storage/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccountService_writeExport(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	st := mockstorage.NewMockStorage(c)
+	st.EXPECT().DownloadFile("1").Return(ioutil.NopCloser(bytes.NewReader([]byte("original"))), nil)
+	st.EXPECT().DownloadFile("2").Return(ioutil.NopCloser(bytes.NewReader([]byte("converted"))), nil)
+	st.EXPECT().DownloadFile("3").Return(nil, storage.ErrNoSuchFile)
+
+	requests := []repository.ConversionRequest{
+		{ID: "10", SourceID: "1", TargetID: "2", SourceFormat: "jpg", TargetFormat: "png", Status: repository.RequestStatusDone,
+			Renditions: []repository.Rendition{{Rendition: converter.Rendition{Name: "thumb", Format: "webp"}, ImageID: "3"}}},
+		{ID: "11", SourceID: "1", SourceFormat: "jpg", TargetFormat: "gif", Status: repository.RequestStatusFailed},
+	}
+
+	var buf bytes.Buffer
+	as := &AccountService{s3: st}
+	require.NoError(t, as.writeExport(context.Background(), requests, &buf))
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+
+	entries := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		data, err := ioutil.ReadAll(rc)
+		rc.Close()
+		require.NoError(t, err)
+		entries[f.Name] = string(data)
+	}
+
+	assert.Len(t, entries, 3)
+	assert.Contains(t, entries["requests.json"], `"id": "11"`)
+	assert.Equal(t, "original", entries["files/original/1.jpg"])
+	assert.Equal(t, "converted", entries["files/converted/2.png"])
+}
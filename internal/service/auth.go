@@ -14,13 +14,14 @@ import (
 
 // AuthService implements logic for working with users.
 type AuthService struct {
-	usersRepo *repository.UsersRepository
-	tm        *jwt.TokenManager
+	usersRepo  *repository.UsersRepository
+	tokensRepo *repository.RefreshTokensRepository
+	tm         *jwt.TokenManager
 }
 
 // NewAuthService creates new authorization service.
-func NewAuthService(repo *repository.UsersRepository, tm *jwt.TokenManager) *AuthService {
-	return &AuthService{usersRepo: repo, tm: tm}
+func NewAuthService(repo *repository.UsersRepository, tokensRepo *repository.RefreshTokensRepository, tm *jwt.TokenManager) *AuthService {
+	return &AuthService{usersRepo: repo, tokensRepo: tokensRepo, tm: tm}
 }
 
 // ParseToken parse the authorization token.
@@ -63,9 +64,61 @@ func (auth *AuthService) LogIn(ctx context.Context, email, password string) (str
 		return "", "", fmt.Errorf("can't generate refresh token: %w", err)
 	}
 
+	err = auth.tokensRepo.InsertRefreshToken(ctx, user.ID, jwt.HashRefreshToken(refreshToken), jwt.RefreshTokenTimeout)
+	if err != nil {
+		return "", "", &InternalError{err, http.StatusInternalServerError}
+	}
+
 	return accessToken, refreshToken, nil
 }
 
+// Refresh exchanges the refresh token for the new access and refresh tokens, the given refresh token can't be used again.
+// The reuse of the refresh token revokes all the tokens of the login session.
+func (auth *AuthService) Refresh(ctx context.Context, refreshToken string) (string, string, error) {
+	newRefreshToken, err := auth.tm.GenerateRefreshToken()
+	if err != nil {
+		return "", "", &InternalError{
+			fmt.Errorf("can't generate refresh token: %w", err),
+			http.StatusInternalServerError,
+		}
+	}
+
+	userID, err := auth.tokensRepo.RotateRefreshToken(ctx, jwt.HashRefreshToken(refreshToken),
+		jwt.HashRefreshToken(newRefreshToken), jwt.RefreshTokenTimeout)
+	if errors.Is(err, repository.ErrRefreshTokenReused) {
+		logger.FromContext(ctx).Infoln("refresh token reuse detected, the session is revoked")
+		return "", "", &InternalError{err, http.StatusUnauthorized}
+	}
+	if errors.Is(err, repository.ErrInvalidRefreshToken) {
+		return "", "", &InternalError{err, http.StatusUnauthorized}
+	}
+	if err != nil {
+		return "", "", &InternalError{err, http.StatusInternalServerError}
+	}
+
+	accessToken, err := auth.tm.GenerateAccessToken(userID)
+	if err != nil {
+		return "", "", &InternalError{
+			fmt.Errorf("can't generate access token: %w", err),
+			http.StatusInternalServerError,
+		}
+	}
+	logger.FromContext(ctx).WithField("user_id", userID).Infoln("tokens refreshed")
+
+	return accessToken, newRefreshToken, nil
+}
+
+// LogOut revokes the refresh token with all the tokens of its login session.
+// The access tokens already issued stay valid until they expire.
+func (auth *AuthService) LogOut(ctx context.Context, refreshToken string) error {
+	err := auth.tokensRepo.RevokeRefreshToken(ctx, jwt.HashRefreshToken(refreshToken))
+	if err != nil {
+		return &InternalError{err, http.StatusInternalServerError}
+	}
+
+	return nil
+}
+
 // SignUp implements registration logic.
 func (auth *AuthService) SignUp(ctx context.Context, email, password string) (string, error) {
 	hashPwd, err := hash.GeneratePasswordHash(password)
@@ -0,0 +1,178 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/Konstantsiy/image-converter/internal/appcontext"
+	"github.com/Konstantsiy/image-converter/internal/converter"
+	"github.com/Konstantsiy/image-converter/internal/repository"
+	"github.com/Konstantsiy/image-converter/internal/storage"
+	"github.com/Konstantsiy/image-converter/pkg/logger"
+)
+
+// SourceFile is the source image of the batch, it's read twice: to hash it and to upload it.
+type SourceFile interface {
+	io.Reader
+	io.Seeker
+	io.Closer
+}
+
+// BatchFile represents the source image of the batch.
+type BatchFile struct {
+	File         SourceFile
+	Filename     string
+	SourceFormat string
+}
+
+// BatchItem represents the created conversion request of the batch.
+type BatchItem struct {
+	SourceFileID string
+	RequestID    string
+	Filename     string
+	SourceFormat string
+}
+
+// BatchService implements logic for working with batches.
+type BatchService struct {
+	batchesRepo  *repository.BatchesRepository
+	imageService *ImageService
+	s3           storage.Storage
+}
+
+// NewBatchService creates new batches service.
+func NewBatchService(batchesRepo *repository.BatchesRepository, imageService *ImageService, s3 storage.Storage) *BatchService {
+	return &BatchService{batchesRepo: batchesRepo, imageService: imageService, s3: s3}
+}
+
+// Create uploads the files and creates the batch with one conversion request per file in one transaction,
+// the requests are queued with the lower priority than the single conversions of the user.
+// If anything fails, no request is queued and the references to the uploaded files are released.
+func (bs *BatchService) Create(ctx context.Context, files []BatchFile, targetFormat string, ratio int, opts converter.Options, renditions []converter.Rendition) (string, []BatchItem, error) {
+	userID, ok := appcontext.UserIDFromContext(ctx)
+	if !ok {
+		return "", nil, fmt.Errorf("can't get user id from application context")
+	}
+
+	if len(files) == 0 {
+		return "", nil, &InternalError{repository.ErrEmptyBatch, http.StatusBadRequest}
+	}
+
+	priority, err := bs.imageService.usersRepo.GetUserPriority(ctx, userID)
+	if err != nil {
+		return "", nil, &InternalError{
+			fmt.Errorf("repository error: %w", err),
+			http.StatusInternalServerError}
+	}
+	priority = batchPriority(priority)
+
+	requests := make([]repository.QueuedRequest, 0, len(files))
+	release := func() {
+		for _, r := range requests {
+			bs.imageService.release(ctx, r.SourceID)
+		}
+	}
+
+	for _, f := range files {
+		sourceFileID, err := bs.imageService.storeOriginal(ctx, f.File, f.SourceFormat)
+		if err != nil {
+			release()
+			return "", nil, err
+		}
+
+		requests = append(requests, repository.QueuedRequest{
+			SourceID:     sourceFileID,
+			Filename:     f.Filename,
+			SourceFormat: f.SourceFormat,
+			TargetFormat: targetFormat,
+			Ratio:        ratio,
+			Priority:     priority,
+			Options:      opts,
+			Renditions:   renditions,
+		})
+	}
+
+	batchID, requestIDs, err := bs.batchesRepo.InsertBatch(ctx, userID, requests)
+	if err != nil {
+		release()
+		return "", nil, &InternalError{
+			fmt.Errorf("repository error: %w", err),
+			http.StatusInternalServerError}
+	}
+	logger.FromContext(ctx).WithField("batch_id", batchID).WithField("priority", priority).
+		Infoln("batch created with the requests saved to the outbox")
+
+	items := make([]BatchItem, 0, len(files))
+	for i, f := range files {
+		items = append(items, BatchItem{
+			SourceFileID: requests[i].SourceID,
+			RequestID:    requestIDs[i],
+			Filename:     f.Filename,
+			SourceFormat: f.SourceFormat,
+		})
+	}
+
+	return batchID, items, nil
+}
+
+// Get returns the user's batch with the statuses of its requests.
+func (bs *BatchService) Get(ctx context.Context, batchID string) (repository.Batch, error) {
+	userID, ok := appcontext.UserIDFromContext(ctx)
+	if !ok {
+		return repository.Batch{}, &InternalError{
+			fmt.Errorf("can't get user id from application context"),
+			http.StatusUnauthorized}
+	}
+
+	batch, err := bs.batchesRepo.GetBatch(ctx, userID, batchID)
+	if errors.Is(err, repository.ErrNoSuchBatch) {
+		return repository.Batch{}, &InternalError{err, http.StatusNotFound}
+	}
+	if err != nil {
+		return repository.Batch{}, &InternalError{err, http.StatusInternalServerError}
+	}
+
+	return batch, nil
+}
+
+// WriteArchive writes the ZIP archive with all converted images of the batch.
+// Files with the same name are numbered to keep every entry.
+func (bs *BatchService) WriteArchive(ctx context.Context, batch repository.Batch, w io.Writer) error {
+	zw := zip.NewWriter(w)
+	names := make(map[string]int)
+
+	for _, r := range batch.Requests {
+		if r.TargetID == "" {
+			continue
+		}
+
+		file, err := bs.s3.DownloadFile(r.TargetID)
+		if err != nil {
+			return fmt.Errorf("s3 error: %w", err)
+		}
+
+		name := r.Filename + "." + r.TargetFormat
+		if n := names[name]; n > 0 {
+			name = fmt.Sprintf("%s_%d.%s", r.Filename, n+1, r.TargetFormat)
+		}
+		names[r.Filename+"."+r.TargetFormat]++
+
+		entry, err := zw.Create(name)
+		if err != nil {
+			file.Close()
+			return fmt.Errorf("can't create archive entry: %w", err)
+		}
+		_, err = io.Copy(entry, file)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("can't write archive entry: %w", err)
+		}
+	}
+	logger.FromContext(ctx).WithField("batch_id", batch.ID).Infoln("batch archive written")
+
+	return zw.Close()
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/Konstantsiy/image-converter/internal/appcontext"
+	"github.com/Konstantsiy/image-converter/internal/repository"
+	"github.com/Konstantsiy/image-converter/pkg/logger"
+)
+
+// subscriberBuffer is the number of events kept for the slow subscriber, the following events are dropped.
+const subscriberBuffer = 16
+
+// RequestEventsBroker delivers the request status changes to the subscribed users.
+type RequestEventsBroker struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan repository.RequestEvent]struct{}
+}
+
+// NewRequestEventsBroker creates new request events broker.
+func NewRequestEventsBroker() *RequestEventsBroker {
+	return &RequestEventsBroker{subscribers: make(map[string]map[chan repository.RequestEvent]struct{})}
+}
+
+// Run publishes the events until the channel is closed, then closes the channels of all subscribers.
+func (b *RequestEventsBroker) Run(events <-chan repository.RequestEvent) {
+	for event := range events {
+		b.publish(event)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for userID, channels := range b.subscribers {
+		for ch := range channels {
+			close(ch)
+		}
+		delete(b.subscribers, userID)
+	}
+}
+
+// Subscribe returns the channel of the status changes of the user's requests
+// and the function that cancels the subscription.
+func (b *RequestEventsBroker) Subscribe(ctx context.Context) (<-chan repository.RequestEvent, func(), error) {
+	userID, ok := appcontext.UserIDFromContext(ctx)
+	if !ok {
+		return nil, nil, &InternalError{
+			fmt.Errorf("can't get user id from application context"),
+			http.StatusInternalServerError,
+		}
+	}
+
+	ch := make(chan repository.RequestEvent, subscriberBuffer)
+
+	b.mu.Lock()
+	if b.subscribers[userID] == nil {
+		b.subscribers[userID] = make(map[chan repository.RequestEvent]struct{})
+	}
+	b.subscribers[userID][ch] = struct{}{}
+	b.mu.Unlock()
+
+	unsubscribe := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subscribers[userID][ch]; !ok {
+			return
+		}
+		delete(b.subscribers[userID], ch)
+		if len(b.subscribers[userID]) == 0 {
+			delete(b.subscribers, userID)
+		}
+		close(ch)
+	}
+
+	return ch, unsubscribe, nil
+}
+
+func (b *RequestEventsBroker) publish(event repository.RequestEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subscribers[event.UserID] {
+		select {
+		case ch <- event:
+		default:
+			logger.FromContext(context.Background()).WithField("request_id", event.RequestID).
+				Errorln(fmt.Errorf("subscriber is too slow, request event dropped"))
+		}
+	}
+}
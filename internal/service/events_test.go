@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Konstantsiy/image-converter/internal/appcontext"
+	"github.com/Konstantsiy/image-converter/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestEventsBroker(t *testing.T) {
+	b := NewRequestEventsBroker()
+	events := make(chan repository.RequestEvent)
+	done := make(chan struct{})
+	go func() {
+		b.Run(events)
+		close(done)
+	}()
+
+	first, unsubscribeFirst, err := b.Subscribe(appcontext.ContextWithUserID(context.Background(), "1"))
+	require.NoError(t, err)
+	second, _, err := b.Subscribe(appcontext.ContextWithUserID(context.Background(), "1"))
+	require.NoError(t, err)
+	other, _, err := b.Subscribe(appcontext.ContextWithUserID(context.Background(), "2"))
+	require.NoError(t, err)
+
+	event := repository.RequestEvent{RequestID: "10", UserID: "1", Status: repository.RequestStatusDone, TargetID: "11"}
+	events <- event
+
+	assert.Equal(t, event, receive(t, first))
+	assert.Equal(t, event, receive(t, second))
+	select {
+	case e := <-other:
+		t.Fatalf("unexpected event of another user: %v", e)
+	default:
+	}
+
+	unsubscribeFirst()
+	unsubscribeFirst()
+	_, ok := <-first
+	assert.False(t, ok)
+
+	close(events)
+	<-done
+	_, ok = <-second
+	assert.False(t, ok)
+	_, ok = <-other
+	assert.False(t, ok)
+}
+
+func TestRequestEventsBroker_NoUserID(t *testing.T) {
+	_, _, err := NewRequestEventsBroker().Subscribe(context.Background())
+	assert.Error(t, err)
+}
+
+func receive(t *testing.T, ch <-chan repository.RequestEvent) repository.RequestEvent {
+	t.Helper()
+	select {
+	case e := <-ch:
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("event was not received")
+		return repository.RequestEvent{}
+	}
+}
@@ -2,65 +2,167 @@ package service
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"mime/multipart"
 	"net/http"
 
 	"github.com/Konstantsiy/image-converter/internal/appcontext"
+	"github.com/Konstantsiy/image-converter/internal/converter"
 	"github.com/Konstantsiy/image-converter/pkg/logger"
 
 	"github.com/Konstantsiy/image-converter/internal/repository"
 	"github.com/Konstantsiy/image-converter/internal/storage"
 )
 
+// batchPriorityPenalty lowers the priority of the batch requests, so that they don't starve the single conversions.
+const batchPriorityPenalty = 4
+
+// TierPriority requests the conversion with the priority tier of the user.
+const TierPriority = -1
+
 // ImageService implements logic for working with images.
 type ImageService struct {
 	imagesRepo   *repository.ImagesRepository
 	requestsRepo *repository.RequestsRepository
+	usersRepo    *repository.UsersRepository
 	s3           storage.Storage
 }
 
 // NewImageService creates new images service.
-func NewImageService(imagesRepo *repository.ImagesRepository, requestsRepo *repository.RequestsRepository, s3 storage.Storage) *ImageService {
-	return &ImageService{imagesRepo: imagesRepo, requestsRepo: requestsRepo, s3: s3}
+func NewImageService(imagesRepo *repository.ImagesRepository, requestsRepo *repository.RequestsRepository, usersRepo *repository.UsersRepository, s3 storage.Storage) *ImageService {
+	return &ImageService{imagesRepo: imagesRepo, requestsRepo: requestsRepo, usersRepo: usersRepo, s3: s3}
 }
 
-// Convert converts needed image according to the request.
-func (is *ImageService) Convert(ctx context.Context, sourceFile multipart.File, filename, sourceFormat, targetFormat string, ratio int) (string, string, error) {
+// Convert uploads the source image and creates the conversion request with the requested priority capped by
+// the priority tier of the user, the request is sent to the queue by the outbox relay.
+// The source image already uploaded with the same content and format is not uploaded again.
+func (is *ImageService) Convert(ctx context.Context, sourceFile multipart.File, filename, sourceFormat, targetFormat string, ratio, priority int, opts converter.Options, renditions []converter.Rendition) (string, string, error) {
 	userID, ok := appcontext.UserIDFromContext(ctx)
 	if !ok {
 		return "", "", fmt.Errorf("can't get user id from application context")
 	}
 
-	sourceFileID, err := is.imagesRepo.InsertImage(ctx, filename, sourceFormat)
+	tier, err := is.usersRepo.GetUserPriority(ctx, userID)
+	if err != nil {
+		return "", "", &InternalError{
+			fmt.Errorf("repository error: %w", err),
+			http.StatusInternalServerError}
+	}
+	priority = requestPriority(priority, tier)
+
+	sourceFileID, err := is.storeOriginal(ctx, sourceFile, sourceFormat)
+	if err != nil {
+		return "", "", err
+	}
+
+	requestID, err := is.requestsRepo.InsertQueuedRequest(ctx, userID, sourceFileID, filename, sourceFormat, targetFormat, ratio, priority, opts, renditions)
 	if err != nil {
+		is.release(ctx, sourceFileID)
 		return "", "", &InternalError{
 			fmt.Errorf("repository error: %w", err),
 			http.StatusInternalServerError}
 	}
+	logger.FromContext(ctx).WithField("request_id", requestID).WithField("priority", priority).
+		Infoln("request created with the status \"queued\" and saved to the outbox")
+
+	return sourceFileID, requestID, nil
+}
+
+// storeOriginal saves the original image referenced by the new request and uploads it unless it's already stored.
+// The reference is released if the upload fails, the image that isn't referenced anymore is removed then.
+func (is *ImageService) storeOriginal(ctx context.Context, sourceFile io.ReadSeeker, sourceFormat string) (string, error) {
+	hash, err := hashFile(sourceFile)
+	if err != nil {
+		return "", &InternalError{
+			fmt.Errorf("can't hash file: %w", err),
+			http.StatusInternalServerError}
+	}
+
+	sourceFileID, stored, err := is.imagesRepo.InsertOriginal(ctx, sourceFormat, hash)
+	if err != nil {
+		return "", &InternalError{
+			fmt.Errorf("repository error: %w", err),
+			http.StatusInternalServerError}
+	}
 	logger.FromContext(ctx).WithField("file_id", sourceFileID).
 		Infoln("original file successfully saved in the database")
 
-	err = is.s3.UploadFile(sourceFile, sourceFileID)
+	if stored {
+		logger.FromContext(ctx).WithField("file_id", sourceFileID).
+			Infoln("original file is already stored in the S3 s3")
+		return sourceFileID, nil
+	}
+
+	err = is.upload(ctx, sourceFile, sourceFileID)
 	if err != nil {
-		return "", "", &InternalError{
+		is.release(ctx, sourceFileID)
+		return "", err
+	}
+
+	return sourceFileID, nil
+}
+
+// upload uploads the original file and marks it stored.
+// The same file may be uploaded by the concurrent requests, the storage just keeps the last of the equal copies.
+func (is *ImageService) upload(ctx context.Context, sourceFile io.Reader, sourceFileID string) error {
+	err := is.s3.UploadFile(sourceFile, sourceFileID)
+	if err != nil {
+		return &InternalError{
 			fmt.Errorf("s3 error: %w", err),
 			http.StatusInternalServerError}
 	}
 	logger.FromContext(ctx).WithField("file_id", sourceFileID).
 		Infoln("original file successfully uploaded to the S3 s3")
 
-	requestID, err := is.requestsRepo.InsertRequest(ctx, userID, sourceFileID, sourceFormat, targetFormat, ratio)
+	err = is.imagesRepo.MarkStored(ctx, sourceFileID)
 	if err != nil {
-		return "", "", &InternalError{
+		return &InternalError{
 			fmt.Errorf("repository error: %w", err),
 			http.StatusInternalServerError}
 	}
-	logger.FromContext(ctx).WithField("request_id", requestID).
-		Infoln("request created with the status \"queued\"")
 
-	return sourceFileID, requestID, nil
+	return nil
+}
+
+// release drops the reference of the failed request to the original file.
+func (is *ImageService) release(ctx context.Context, sourceFileID string) {
+	err := is.imagesRepo.ReleaseImage(ctx, sourceFileID)
+	if err != nil {
+		logger.FromContext(ctx).WithField("file_id", sourceFileID).
+			Errorln(fmt.Errorf("can't release image: %w", err))
+	}
+}
+
+// hashFile returns the hex encoded SHA-256 of the file content and rewinds the file.
+func hashFile(file io.ReadSeeker) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// requestPriority caps the requested priority by the tier of the user, the tier is used if no priority is requested.
+func requestPriority(requested, tier int) int {
+	if requested == TierPriority || requested > tier {
+		return tier
+	}
+	return requested
+}
+
+// batchPriority lowers the user priority for the batch request.
+func batchPriority(priority int) int {
+	if priority -= batchPriorityPenalty; priority < 0 {
+		return 0
+	}
+	return priority
 }
 
 // Download allows you to download original/converted image by id.
@@ -88,3 +190,53 @@ func (is *ImageService) Download(ctx context.Context, id string) (string, error)
 
 	return url, nil
 }
+
+// Delete deletes the user's requests using the image as the source, the target or the rendition
+// together with their images unless other requests use them.
+func (is *ImageService) Delete(ctx context.Context, id string) error {
+	userID, ok := appcontext.UserIDFromContext(ctx)
+	if !ok {
+		return &InternalError{
+			Err:        fmt.Errorf("can't get user id from application context"),
+			StatusCode: http.StatusUnauthorized,
+		}
+	}
+
+	imageIDs, err := is.requestsRepo.DeleteImageRequests(ctx, userID, id)
+	if err != nil {
+		return deletionError(err)
+	}
+	logger.FromContext(ctx).WithField("file_id", id).Infoln("image requests deleted")
+
+	removeImages(ctx, is.imagesRepo, is.s3, imageIDs)
+
+	return nil
+}
+
+// deletionError sets the status code of the request deletion error.
+func deletionError(err error) error {
+	switch {
+	case errors.Is(err, repository.ErrNoSuchRequest), errors.Is(err, repository.ErrNoSuchImage):
+		return &InternalError{err, http.StatusNotFound}
+	case errors.Is(err, repository.ErrRequestInProgress):
+		return &InternalError{err, http.StatusConflict}
+	}
+	return &InternalError{err, http.StatusInternalServerError}
+}
+
+// removeImages removes the files of the deleted images from the storage.
+// The files that can't be removed are left to the retention sweeper.
+func removeImages(ctx context.Context, imagesRepo *repository.ImagesRepository, s3 storage.Storage, imageIDs []string) {
+	for _, imageID := range imageIDs {
+		err := s3.DeleteFile(imageID)
+		if err == nil {
+			err = imagesRepo.PurgeImage(ctx, imageID)
+		}
+		if err != nil {
+			logger.FromContext(ctx).WithField("file_id", imageID).
+				Errorln(fmt.Errorf("can't remove deleted image: %w", err))
+			continue
+		}
+		logger.FromContext(ctx).WithField("file_id", imageID).Infoln("image removed from the S3 s3")
+	}
+}
@@ -0,0 +1,27 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestPriority(t *testing.T) {
+	testTable := []struct {
+		name      string
+		requested int
+		tier      int
+		expected  int
+	}{
+		{name: "Tier", requested: TierPriority, tier: 5, expected: 5},
+		{name: "Lower than tier", requested: 2, tier: 5, expected: 2},
+		{name: "Lowest", requested: 0, tier: 5, expected: 0},
+		{name: "Capped by tier", requested: 9, tier: 5, expected: 5},
+	}
+
+	for _, tc := range testTable {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, requestPriority(tc.requested, tc.tier))
+		})
+	}
+}
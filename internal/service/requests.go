@@ -2,22 +2,30 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/Konstantsiy/image-converter/internal/appcontext"
+	"github.com/Konstantsiy/image-converter/pkg/logger"
 
 	"github.com/Konstantsiy/image-converter/internal/repository"
+	"github.com/Konstantsiy/image-converter/internal/storage"
 )
 
 // RequestsService implements logic for working with requests.
 type RequestsService struct {
 	requestsRepo *repository.RequestsRepository
+	imagesRepo   *repository.ImagesRepository
+	s3           storage.Storage
+	events       *RequestEventsBroker
 }
 
 // NewRequestsService creates new requests service.
-func NewRequestsService(requestsRepo *repository.RequestsRepository) *RequestsService {
-	return &RequestsService{requestsRepo: requestsRepo}
+func NewRequestsService(requestsRepo *repository.RequestsRepository, imagesRepo *repository.ImagesRepository, s3 storage.Storage,
+	events *RequestEventsBroker) *RequestsService {
+	return &RequestsService{requestsRepo: requestsRepo, imagesRepo: imagesRepo, s3: s3, events: events}
 }
 
 // GetUsersRequests displays the user's request history.
@@ -36,3 +44,85 @@ func (rs *RequestsService) GetUsersRequests(ctx context.Context) ([]repository.C
 	}
 	return requestsHistory, nil
 }
+
+// GetRequest returns the user's conversion request.
+// If wait is positive and the request is not finished yet, GetRequest waits for the status change events
+// of the request until it is done or failed, the wait time expires or the context is canceled
+// and returns the latest state.
+func (rs *RequestsService) GetRequest(ctx context.Context, requestID string, wait time.Duration) (repository.ConversionRequest, error) {
+	userID, ok := appcontext.UserIDFromContext(ctx)
+	if !ok {
+		return repository.ConversionRequest{}, &InternalError{
+			fmt.Errorf("can't get user id from application context"),
+			http.StatusInternalServerError,
+		}
+	}
+
+	if wait <= 0 {
+		return rs.getRequest(ctx, userID, requestID)
+	}
+
+	// The subscription goes first, so that the change made right after the request is read is not missed.
+	events, unsubscribe, err := rs.events.Subscribe(ctx)
+	if err != nil {
+		return repository.ConversionRequest{}, err
+	}
+	defer unsubscribe()
+
+	request, err := rs.getRequest(ctx, userID, requestID)
+	if err != nil || repository.IsFinalStatus(request.Status) {
+		return request, err
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return request, nil
+		case <-timer.C:
+			// The events are not received while the listener reconnects, the request is read once more.
+			return rs.getRequest(ctx, userID, requestID)
+		case event, ok := <-events:
+			if !ok {
+				return request, nil
+			}
+			if event.RequestID == requestID && repository.IsFinalStatus(event.Status) {
+				return rs.getRequest(ctx, userID, requestID)
+			}
+		}
+	}
+}
+
+func (rs *RequestsService) getRequest(ctx context.Context, userID, requestID string) (repository.ConversionRequest, error) {
+	request, err := rs.requestsRepo.GetRequestByID(ctx, userID, requestID)
+	if errors.Is(err, repository.ErrNoSuchRequest) {
+		return repository.ConversionRequest{}, &InternalError{err, http.StatusNotFound}
+	}
+	if err != nil {
+		return repository.ConversionRequest{}, &InternalError{err, http.StatusInternalServerError}
+	}
+	return request, nil
+}
+
+// Delete deletes the user's done or failed request together with its images unless other requests use them.
+func (rs *RequestsService) Delete(ctx context.Context, requestID string) error {
+	userID, ok := appcontext.UserIDFromContext(ctx)
+	if !ok {
+		return &InternalError{
+			fmt.Errorf("can't get user id from application context"),
+			http.StatusInternalServerError,
+		}
+	}
+
+	imageIDs, err := rs.requestsRepo.DeleteRequest(ctx, userID, requestID)
+	if err != nil {
+		return deletionError(err)
+	}
+	logger.FromContext(ctx).WithField("request_id", requestID).Infoln("request deleted")
+
+	removeImages(ctx, rs.imagesRepo, rs.s3, imageIDs)
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Konstantsiy/image-converter/internal/appcontext"
+	"github.com/Konstantsiy/image-converter/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestsService_GetRequest(t *testing.T) {
+	const (
+		requestQuery    = `SELECT (.+) FROM converter.requests WHERE id = (.+) AND user_id = (.+)`
+		renditionsQuery = `SELECT (.+) FROM converter.renditions (.+) WHERE r.id = (.+)`
+	)
+
+	columns := []string{"id", "user_id", "source_id", "target_id", "source_format", "target_format", "ratio",
+		"status", "created", "updated", "width", "height", "fit", "crop_x", "crop_y", "crop_width", "crop_height",
+		"rotation", "flip", "metadata", "retry_count", "last_error", "priority"}
+	created := time.Date(2021, 11, 6, 21, 35, 7, 0, time.UTC)
+
+	expectRequest := func(mock sqlmock.Sqlmock, status string) {
+		mock.ExpectQuery(requestQuery).
+			WithArgs("1", "2").
+			WillReturnRows(sqlmock.NewRows(columns).AddRow("1", "2", "3", nil, "jpg", "png", 90,
+				status, created, created, 0, 0, "", 0, 0, 0, 0, 0, "", "", 0, "", 0))
+		mock.ExpectQuery(renditionsQuery).
+			WithArgs("1").
+			WillReturnRows(sqlmock.NewRows([]string{"request_id", "name", "width", "height", "format", "ratio", "image_id"}))
+	}
+
+	testTable := []struct {
+		name           string
+		wait           time.Duration
+		mockBehavior   func(mock sqlmock.Sqlmock)
+		events         []repository.RequestEvent
+		expectedStatus string
+	}{
+		{
+			name: "No wait",
+			mockBehavior: func(mock sqlmock.Sqlmock) {
+				expectRequest(mock, repository.RequestStatusQueued)
+			},
+			expectedStatus: repository.RequestStatusQueued,
+		},
+		{
+			name: "Already done",
+			wait: time.Minute,
+			mockBehavior: func(mock sqlmock.Sqlmock) {
+				expectRequest(mock, repository.RequestStatusDone)
+			},
+			expectedStatus: repository.RequestStatusDone,
+		},
+		{
+			name: "Done event",
+			wait: time.Minute,
+			mockBehavior: func(mock sqlmock.Sqlmock) {
+				expectRequest(mock, repository.RequestStatusQueued)
+				expectRequest(mock, repository.RequestStatusDone)
+			},
+			events: []repository.RequestEvent{
+				{RequestID: "1", UserID: "2", Status: repository.RequestStatusProcessing},
+				{RequestID: "4", UserID: "2", Status: repository.RequestStatusDone},
+				{RequestID: "1", UserID: "2", Status: repository.RequestStatusDone},
+			},
+			expectedStatus: repository.RequestStatusDone,
+		},
+		{
+			name: "Wait expired",
+			wait: 10 * time.Millisecond,
+			mockBehavior: func(mock sqlmock.Sqlmock) {
+				expectRequest(mock, repository.RequestStatusQueued)
+				expectRequest(mock, repository.RequestStatusProcessing)
+			},
+			expectedStatus: repository.RequestStatusProcessing,
+		},
+	}
+
+	for _, tc := range testTable {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close()
+
+			requestsRepo, err := repository.NewRequestsRepository(db)
+			require.NoError(t, err)
+
+			events := make(chan repository.RequestEvent)
+			defer close(events)
+			broker := NewRequestEventsBroker()
+			go broker.Run(events)
+
+			tc.mockBehavior(mock)
+
+			if len(tc.events) > 0 {
+				go func() {
+					waitSubscriber(broker, "2")
+					for _, event := range tc.events {
+						events <- event
+					}
+				}()
+			}
+
+			rs := NewRequestsService(requestsRepo, nil, nil, broker)
+			request, err := rs.GetRequest(appcontext.ContextWithUserID(context.Background(), "2"), "1", tc.wait)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedStatus, request.Status)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+// waitSubscriber waits until the user subscribes to the broker.
+func waitSubscriber(b *RequestEventsBroker, userID string) {
+	for {
+		b.mu.Lock()
+		n := len(b.subscribers[userID])
+		b.mu.Unlock()
+		if n > 0 {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -3,8 +3,11 @@ package service
 
 import (
 	"context"
+	"io"
 	"mime/multipart"
+	"time"
 
+	"github.com/Konstantsiy/image-converter/internal/converter"
 	"github.com/Konstantsiy/image-converter/internal/repository"
 )
 
@@ -23,15 +26,47 @@ type Authorization interface {
 	ParseToken(accessToken string) (string, error)
 	LogIn(ctx context.Context, email, password string) (string, string, error)
 	SignUp(ctx context.Context, email, password string) (string, error)
+	Refresh(ctx context.Context, refreshToken string) (string, string, error)
+	LogOut(ctx context.Context, refreshToken string) error
 }
 
 // Images represents images service.
 type Images interface {
-	Convert(ctx context.Context, sourceFile multipart.File, filename, sourceFormat, targetFormat string, ratio int) (string, string, error)
+	Convert(ctx context.Context, sourceFile multipart.File, filename, sourceFormat, targetFormat string, ratio, priority int, opts converter.Options, renditions []converter.Rendition) (string, string, error)
 	Download(ctx context.Context, id string) (string, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// Events represents the service of the request status changes.
+type Events interface {
+	Subscribe(ctx context.Context) (<-chan repository.RequestEvent, func(), error)
+}
+
+// Batches represents batches service.
+type Batches interface {
+	Create(ctx context.Context, files []BatchFile, targetFormat string, ratio int, opts converter.Options, renditions []converter.Rendition) (string, []BatchItem, error)
+	Get(ctx context.Context, batchID string) (repository.Batch, error)
+	WriteArchive(ctx context.Context, batch repository.Batch, w io.Writer) error
 }
 
 // Requests represents requests service.
 type Requests interface {
 	GetUsersRequests(ctx context.Context) ([]repository.ConversionRequest, error)
+	GetRequest(ctx context.Context, requestID string, wait time.Duration) (repository.ConversionRequest, error)
+	Delete(ctx context.Context, requestID string) error
+}
+
+// Webhooks represents webhooks service.
+type Webhooks interface {
+	Register(ctx context.Context, url, requestID string) (repository.Webhook, error)
+	List(ctx context.Context) ([]repository.Webhook, error)
+	Delete(ctx context.Context, webhookID string) error
+	GetDeliveries(ctx context.Context, webhookID string) ([]repository.WebhookDelivery, error)
+}
+
+// Accounts represents the service of the account deletion and export jobs.
+type Accounts interface {
+	Delete(ctx context.Context) (repository.AccountJob, error)
+	Export(ctx context.Context) (repository.AccountJob, error)
+	GetJob(ctx context.Context, jobID string) (repository.AccountJob, error)
 }
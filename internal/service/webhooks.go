@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Konstantsiy/image-converter/internal/appcontext"
+	"github.com/Konstantsiy/image-converter/internal/repository"
+	"github.com/Konstantsiy/image-converter/internal/webhook"
+	"github.com/Konstantsiy/image-converter/pkg/logger"
+)
+
+// WebhooksService implements logic for working with webhooks.
+type WebhooksService struct {
+	webhooksRepo *repository.WebhooksRepository
+}
+
+// NewWebhooksService creates new webhooks service.
+func NewWebhooksService(webhooksRepo *repository.WebhooksRepository) *WebhooksService {
+	return &WebhooksService{webhooksRepo: webhooksRepo}
+}
+
+// Register registers the webhook for the user's request or, if the request id is empty, for the whole account.
+// The returned webhook contains the signing secret, it is not shown anymore.
+func (ws *WebhooksService) Register(ctx context.Context, url, requestID string) (repository.Webhook, error) {
+	userID, ok := appcontext.UserIDFromContext(ctx)
+	if !ok {
+		return repository.Webhook{}, &InternalError{
+			fmt.Errorf("can't get user id from application context"),
+			http.StatusInternalServerError,
+		}
+	}
+
+	secret, err := webhook.GenerateSecret()
+	if err != nil {
+		return repository.Webhook{}, &InternalError{err, http.StatusInternalServerError}
+	}
+
+	webhookID, err := ws.webhooksRepo.InsertWebhook(ctx, userID, requestID, url, secret)
+	if errors.Is(err, repository.ErrNoSuchRequest) {
+		return repository.Webhook{}, &InternalError{err, http.StatusNotFound}
+	}
+	if err != nil {
+		return repository.Webhook{}, &InternalError{err, http.StatusInternalServerError}
+	}
+	logger.FromContext(ctx).WithField("webhook_id", webhookID).Infoln("webhook registered")
+
+	return repository.Webhook{ID: webhookID, UserID: userID, RequestID: requestID, URL: url, Secret: secret}, nil
+}
+
+// List returns the user's webhooks.
+func (ws *WebhooksService) List(ctx context.Context) ([]repository.Webhook, error) {
+	userID, ok := appcontext.UserIDFromContext(ctx)
+	if !ok {
+		return nil, &InternalError{
+			fmt.Errorf("can't get user id from application context"),
+			http.StatusInternalServerError,
+		}
+	}
+
+	webhooks, err := ws.webhooksRepo.GetWebhooksByUserID(ctx, userID)
+	if err != nil {
+		return nil, &InternalError{err, http.StatusInternalServerError}
+	}
+	return webhooks, nil
+}
+
+// Delete deletes the user's webhook.
+func (ws *WebhooksService) Delete(ctx context.Context, webhookID string) error {
+	userID, ok := appcontext.UserIDFromContext(ctx)
+	if !ok {
+		return &InternalError{
+			fmt.Errorf("can't get user id from application context"),
+			http.StatusInternalServerError,
+		}
+	}
+
+	err := ws.webhooksRepo.DeleteWebhook(ctx, userID, webhookID)
+	if errors.Is(err, repository.ErrNoSuchWebhook) {
+		return &InternalError{err, http.StatusNotFound}
+	}
+	if err != nil {
+		return &InternalError{err, http.StatusInternalServerError}
+	}
+	return nil
+}
+
+// GetDeliveries returns the delivery log of the user's webhook.
+func (ws *WebhooksService) GetDeliveries(ctx context.Context, webhookID string) ([]repository.WebhookDelivery, error) {
+	userID, ok := appcontext.UserIDFromContext(ctx)
+	if !ok {
+		return nil, &InternalError{
+			fmt.Errorf("can't get user id from application context"),
+			http.StatusInternalServerError,
+		}
+	}
+
+	deliveries, err := ws.webhooksRepo.GetDeliveries(ctx, userID, webhookID)
+	if err != nil {
+		return nil, &InternalError{err, http.StatusInternalServerError}
+	}
+	return deliveries, nil
+}
@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Konstantsiy/image-converter/internal/config"
+)
+
+var (
+	// ErrNoSuchFile notifies that the file with the given id does not exist.
+	ErrNoSuchFile = errors.New("file with this id does not exist")
+
+	// ErrInvalidSignature notifies that the download URL is forged or expired.
+	ErrInvalidSignature = errors.New("invalid or expired download URL")
+
+	// errInvalidFileID notifies that the file id can't be used as the file name.
+	errInvalidFileID = errors.New("invalid file id")
+)
+
+// LocalStorage implements the functionality of file storage in the local directory.
+// The download URLs point to the API server, they are signed with HMAC-SHA256 and expire after URLTimeout.
+type LocalStorage struct {
+	dir        string
+	signingKey []byte
+	publicURL  string
+}
+
+// NewLocalStorage creates new file storage in the configured directory, the directory is created if needed.
+func NewLocalStorage(conf *config.StorageConfig) (*LocalStorage, error) {
+	if conf.Dir == "" || conf.SigningKey == "" || conf.PublicURL == "" {
+		return nil, fmt.Errorf("local storage configurations should not be empty")
+	}
+
+	if err := os.MkdirAll(conf.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("can't create storage directory: %w", err)
+	}
+
+	return &LocalStorage{
+		dir:        conf.Dir,
+		signingKey: []byte(conf.SigningKey),
+		publicURL:  strings.TrimSuffix(conf.PublicURL, "/"),
+	}, nil
+}
+
+// UploadFile writes the given file to the storage directory.
+// The file is written to a temporary file first, so that the readers never see a partial file.
+func (s *LocalStorage) UploadFile(file io.Reader, fileID string) error {
+	path, err := s.path(fileID)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(s.dir, "."+fileID+".*")
+	if err != nil {
+		return fmt.Errorf("can't create file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = io.Copy(tmp, file); err != nil {
+		tmp.Close()
+		return fmt.Errorf("can't upload file: %w", err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("can't upload file: %w", err)
+	}
+
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("can't upload file: %w", err)
+	}
+
+	return nil
+}
+
+// DownloadFile opens a file of the storage by the given id, the caller has to close it.
+func (s *LocalStorage) DownloadFile(fileID string) (io.ReadCloser, error) {
+	file, err := s.open(fileID)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func (s *LocalStorage) open(fileID string) (*os.File, error) {
+	path, err := s.path(fileID)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNoSuchFile
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't download file with id %s: %w", fileID, err)
+	}
+
+	return file, nil
+}
+
+// DeleteFile removes the file from the storage directory, the missing file is not an error.
+func (s *LocalStorage) DeleteFile(fileID string) error {
+	path, err := s.path(fileID)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("can't delete file with id %s: %w", fileID, err)
+	}
+
+	return nil
+}
+
+// GetDownloadURL returns the signed URL to download а file from the API server by the given file id.
+func (s *LocalStorage) GetDownloadURL(fileID string) (string, error) {
+	if _, err := s.path(fileID); err != nil {
+		return "", err
+	}
+
+	expires := strconv.FormatInt(time.Now().Add(URLTimeout).Unix(), 10)
+	query := url.Values{}
+	query.Set("expires", expires)
+	query.Set("signature", s.sign(fileID, expires))
+
+	return s.publicURL + "/files/" + url.PathEscape(fileID) + "?" + query.Encode(), nil
+}
+
+// OpenSigned checks the signature and the expiration time of the download URL and opens the file.
+func (s *LocalStorage) OpenSigned(fileID, expires, signature string) (File, error) {
+	deadline, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > deadline {
+		return nil, ErrInvalidSignature
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(s.sign(fileID, expires))) {
+		return nil, ErrInvalidSignature
+	}
+
+	file, err := s.open(fileID)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// sign returns the hex encoded HMAC-SHA256 of the file id and the expiration time.
+func (s *LocalStorage) sign(fileID, expires string) string {
+	mac := hmac.New(sha256.New, s.signingKey)
+	mac.Write([]byte(fileID + ":" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// path returns the path of the file, the ids that aren't plain file names are rejected.
+func (s *LocalStorage) path(fileID string) (string, error) {
+	if fileID == "" || fileID == "." || fileID == ".." || strings.ContainsAny(fileID, `/\`) {
+		return "", errInvalidFileID
+	}
+	return filepath.Join(s.dir, fileID), nil
+}
@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Konstantsiy/image-converter/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestLocalStorage(t *testing.T) (*LocalStorage, string) {
+	dir, err := ioutil.TempDir("", "storage")
+	require.NoError(t, err)
+
+	s, err := NewLocalStorage(&config.StorageConfig{Dir: dir, SigningKey: "secret", PublicURL: "http://localhost:8080/"})
+	require.NoError(t, err)
+
+	return s, dir
+}
+
+func TestLocalStorage_UploadFile(t *testing.T) {
+	s, dir := newTestLocalStorage(t)
+	defer os.RemoveAll(dir)
+
+	require.NoError(t, s.UploadFile(bytes.NewReader([]byte("image")), "1"))
+
+	file, err := s.DownloadFile("1")
+	require.NoError(t, err)
+	defer file.Close()
+	data, err := ioutil.ReadAll(file)
+	require.NoError(t, err)
+	assert.Equal(t, "image", string(data))
+
+	_, err = s.DownloadFile("2")
+	assert.Equal(t, ErrNoSuchFile, err)
+
+	err = s.UploadFile(bytes.NewReader([]byte("image")), "../1")
+	assert.Equal(t, errInvalidFileID, err)
+}
+
+func TestLocalStorage_DeleteFile(t *testing.T) {
+	s, dir := newTestLocalStorage(t)
+	defer os.RemoveAll(dir)
+	require.NoError(t, s.UploadFile(bytes.NewReader([]byte("image")), "1"))
+
+	require.NoError(t, s.DeleteFile("1"))
+	_, err := s.DownloadFile("1")
+	assert.Equal(t, ErrNoSuchFile, err)
+
+	assert.NoError(t, s.DeleteFile("1"))
+	assert.Equal(t, errInvalidFileID, s.DeleteFile(".."))
+}
+
+func TestLocalStorage_OpenSigned(t *testing.T) {
+	s, dir := newTestLocalStorage(t)
+	defer os.RemoveAll(dir)
+	require.NoError(t, s.UploadFile(bytes.NewReader([]byte("image")), "1"))
+
+	downloadURL, err := s.GetDownloadURL("1")
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(downloadURL, "http://localhost:8080/files/1?"))
+
+	u, err := url.Parse(downloadURL)
+	require.NoError(t, err)
+	expires, signature := u.Query().Get("expires"), u.Query().Get("signature")
+	expired := strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)
+
+	testTable := []struct {
+		name          string
+		fileID        string
+		expires       string
+		signature     string
+		expectedError error
+	}{
+		{
+			name:      "Ok",
+			fileID:    "1",
+			expires:   expires,
+			signature: signature,
+		},
+		{
+			name:          "Another file",
+			fileID:        "2",
+			expires:       expires,
+			signature:     signature,
+			expectedError: ErrInvalidSignature,
+		},
+		{
+			name:          "Changed expiration time",
+			fileID:        "1",
+			expires:       expires + "0",
+			signature:     signature,
+			expectedError: ErrInvalidSignature,
+		},
+		{
+			name:          "Expired",
+			fileID:        "1",
+			expires:       expired,
+			signature:     s.sign("1", expired),
+			expectedError: ErrInvalidSignature,
+		},
+		{
+			name:          "Invalid expiration time",
+			fileID:        "1",
+			expires:       "tomorrow",
+			signature:     signature,
+			expectedError: ErrInvalidSignature,
+		},
+	}
+
+	for _, tc := range testTable {
+		t.Run(tc.name, func(t *testing.T) {
+			file, err := s.OpenSigned(tc.fileID, tc.expires, tc.signature)
+			if tc.expectedError != nil {
+				assert.Equal(t, tc.expectedError, err)
+				return
+			}
+			require.NoError(t, err)
+			defer file.Close()
+			data, err := ioutil.ReadAll(file)
+			require.NoError(t, err)
+			assert.Equal(t, "image", string(data))
+		})
+	}
+}
@@ -8,6 +8,7 @@ import (
 	gomock0 "io"
 	"reflect"
 
+	storage "github.com/Konstantsiy/image-converter/internal/storage"
 	gomock "github.com/golang/mock/gomock"
 )
 
@@ -34,11 +35,25 @@ func (m *MockStorage) EXPECT() *MockStorageMockRecorder {
 	return m.recorder
 }
 
+// DeleteFile mocks base method.
+func (m *MockStorage) DeleteFile(fileID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteFile", fileID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteFile indicates an expected call of DeleteFile.
+func (mr *MockStorageMockRecorder) DeleteFile(fileID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteFile", reflect.TypeOf((*MockStorage)(nil).DeleteFile), fileID)
+}
+
 // DownloadFile mocks base method.
-func (m *MockStorage) DownloadFile(fileID string) (gomock0.ReadSeeker, error) {
+func (m *MockStorage) DownloadFile(fileID string) (gomock0.ReadCloser, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "DownloadFile", fileID)
-	ret0, _ := ret[0].(gomock0.ReadSeeker)
+	ret0, _ := ret[0].(gomock0.ReadCloser)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
@@ -65,7 +80,7 @@ func (mr *MockStorageMockRecorder) GetDownloadURL(fileID interface{}) *gomock.Ca
 }
 
 // UploadFile mocks base method.
-func (m *MockStorage) UploadFile(file gomock0.ReadSeeker, fileID string) error {
+func (m *MockStorage) UploadFile(file gomock0.Reader, fileID string) error {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "UploadFile", file, fileID)
 	ret0, _ := ret[0].(error)
@@ -77,3 +92,41 @@ func (mr *MockStorageMockRecorder) UploadFile(file, fileID interface{}) *gomock.
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UploadFile", reflect.TypeOf((*MockStorage)(nil).UploadFile), file, fileID)
 }
+
+// MockSignedFiles is a mock of SignedFiles interface.
+type MockSignedFiles struct {
+	ctrl     *gomock.Controller
+	recorder *MockSignedFilesMockRecorder
+}
+
+// MockSignedFilesMockRecorder is the mock recorder for MockSignedFiles.
+type MockSignedFilesMockRecorder struct {
+	mock *MockSignedFiles
+}
+
+// NewMockSignedFiles creates a new mock instance.
+func NewMockSignedFiles(ctrl *gomock.Controller) *MockSignedFiles {
+	mock := &MockSignedFiles{ctrl: ctrl}
+	mock.recorder = &MockSignedFilesMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockSignedFiles) EXPECT() *MockSignedFilesMockRecorder {
+	return m.recorder
+}
+
+// OpenSigned mocks base method.
+func (m *MockSignedFiles) OpenSigned(fileID, expires, signature string) (storage.File, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "OpenSigned", fileID, expires, signature)
+	ret0, _ := ret[0].(storage.File)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// OpenSigned indicates an expected call of OpenSigned.
+func (mr *MockSignedFilesMockRecorder) OpenSigned(fileID, expires, signature interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OpenSigned", reflect.TypeOf((*MockSignedFiles)(nil).OpenSigned), fileID, expires, signature)
+}
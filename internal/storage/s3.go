@@ -2,10 +2,9 @@
 package storage
 
 import (
-	"bytes"
 	"fmt"
 	io "io"
-	"io/ioutil"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws/credentials"
@@ -14,16 +13,20 @@ import (
 	"github.com/Konstantsiy/image-converter/internal/config"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 )
 
 // URLTimeout determines the validity period of the downloaded image URL.
 const URLTimeout = 10 * time.Minute
 
 // S3Storage implements the functionality of file storage (Amazon S3).
+// The files are uploaded with the multipart upload and downloaded as streams, so they are never kept in memory.
 type S3Storage struct {
-	svc    *s3.S3
-	s3conf *config.AWSConfig
+	svc      *s3.S3
+	uploader *s3manager.Uploader
+	s3conf   *config.AWSConfig
 }
 
 // NewStorage creates new file storage with the given S3 configs and bucket name.
@@ -38,17 +41,50 @@ func NewStorage(s3conf *config.AWSConfig) (*S3Storage, error) {
 		return nil, err
 	}
 
-	return &S3Storage{svc: svc, s3conf: s3conf}, nil
+	uploader := s3manager.NewUploaderWithClient(svc, func(u *s3manager.Uploader) {
+		u.PartSize = s3conf.UploadPartSize
+		u.Concurrency = s3conf.UploadConcurrency
+	})
+
+	return &S3Storage{svc: svc, uploader: uploader, s3conf: s3conf}, nil
 }
 
-// validateAWSConfig validates AWS configurations.
+// validateAWSConfig validates AWS configurations, the static keys are either both set or both empty.
+// The ACL, the storage class and the server-side encryption are checked against the values known to S3,
+// the KMS key id is allowed with SSE-KMS only.
 func validateAWSConfig(s3conf *config.AWSConfig) error {
-	if s3conf.BucketName == "" || s3conf.SecretAccessKey == "" || s3conf.AccessKeyID == "" || s3conf.Region == "" {
+	if s3conf.BucketName == "" || s3conf.Region == "" {
 		return fmt.Errorf("AWS configurations should not be empty")
 	}
+	if (s3conf.AccessKeyID == "") != (s3conf.SecretAccessKey == "") {
+		return fmt.Errorf("AWS access key id and secret access key should be set together")
+	}
+	if !contains(s3.ObjectCannedACL_Values(), s3conf.ACL) {
+		return fmt.Errorf("invalid AWS ACL %q: needed one of %s", s3conf.ACL, strings.Join(s3.ObjectCannedACL_Values(), ", "))
+	}
+	if s3conf.StorageClass != "" && !contains(s3.StorageClass_Values(), s3conf.StorageClass) {
+		return fmt.Errorf("invalid AWS storage class %q: needed one of %s",
+			s3conf.StorageClass, strings.Join(s3.StorageClass_Values(), ", "))
+	}
+	if s3conf.SSE != "" && !contains(s3.ServerSideEncryption_Values(), s3conf.SSE) {
+		return fmt.Errorf("invalid AWS server-side encryption %q: needed one of %s",
+			s3conf.SSE, strings.Join(s3.ServerSideEncryption_Values(), ", "))
+	}
+	if s3conf.SSEKMSKeyID != "" && s3conf.SSE != s3.ServerSideEncryptionAwsKms {
+		return fmt.Errorf("AWS KMS key id needs the %s server-side encryption", s3.ServerSideEncryptionAwsKms)
+	}
 	return nil
 }
 
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
 // initS3ServiceClient initializes SDK's service client.
 func initS3ServiceClient(s3conf config.AWSConfig) (*s3.S3, error) {
 	s3session, err := createSession(&s3conf)
@@ -60,10 +96,23 @@ func initS3ServiceClient(s3conf config.AWSConfig) (*s3.S3, error) {
 }
 
 // createSession creates and returns a new session.
+// The static keys take precedence over the shared profile and the default credential chain.
 func createSession(s3conf *config.AWSConfig) (*session.Session, error) {
-	s3session, err := session.NewSession(&aws.Config{
-		Region:      aws.String(s3conf.Region),
-		Credentials: credentials.NewStaticCredentials(s3conf.AccessKeyID, s3conf.SecretAccessKey, ""),
+	awsConf := aws.NewConfig().
+		WithRegion(s3conf.Region).
+		WithS3ForcePathStyle(s3conf.ForcePathStyle).
+		WithDisableSSL(s3conf.DisableSSL)
+	if s3conf.Endpoint != "" {
+		awsConf = awsConf.WithEndpoint(s3conf.Endpoint)
+	}
+	if s3conf.AccessKeyID != "" {
+		awsConf = awsConf.WithCredentials(credentials.NewStaticCredentials(s3conf.AccessKeyID, s3conf.SecretAccessKey, ""))
+	}
+
+	s3session, err := session.NewSessionWithOptions(session.Options{
+		Config:            *awsConf,
+		Profile:           s3conf.Profile,
+		SharedConfigState: session.SharedConfigEnable,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("can't create session, %w", err)
@@ -71,14 +120,26 @@ func createSession(s3conf *config.AWSConfig) (*session.Session, error) {
 	return s3session, nil
 }
 
-// UploadFile uploads the given file to the bucket.
-func (s *S3Storage) UploadFile(file io.ReadSeeker, fileID string) error {
-	_, err := s.svc.PutObject(&s3.PutObjectInput{
+// UploadFile uploads the given file to the bucket, the large files are uploaded in parts.
+// The object gets the configured ACL, storage class and server-side encryption.
+func (s *S3Storage) UploadFile(file io.Reader, fileID string) error {
+	input := &s3manager.UploadInput{
 		Body:   file,
 		Bucket: aws.String(s.s3conf.BucketName),
 		Key:    aws.String(fileID),
-		ACL:    aws.String(s3.BucketCannedACLPublicRead),
-	})
+		ACL:    aws.String(s.s3conf.ACL),
+	}
+	if s.s3conf.StorageClass != "" {
+		input.StorageClass = aws.String(s.s3conf.StorageClass)
+	}
+	if s.s3conf.SSE != "" {
+		input.ServerSideEncryption = aws.String(s.s3conf.SSE)
+	}
+	if s.s3conf.SSEKMSKeyID != "" {
+		input.SSEKMSKeyId = aws.String(s.s3conf.SSEKMSKeyID)
+	}
+
+	_, err := s.uploader.Upload(input)
 	if err != nil {
 		return fmt.Errorf("can't upload file: %w", err)
 	}
@@ -86,22 +147,33 @@ func (s *S3Storage) UploadFile(file io.ReadSeeker, fileID string) error {
 	return nil
 }
 
-// DownloadFile downloads a file from the storage by the given id.
-func (s *S3Storage) DownloadFile(fileID string) (io.ReadSeeker, error) {
+// DownloadFile opens the stream of the file from the storage by the given id, the caller has to close it.
+func (s *S3Storage) DownloadFile(fileID string) (io.ReadCloser, error) {
 	resp, err := s.svc.GetObject(&s3.GetObjectInput{
 		Bucket: aws.String(s.s3conf.BucketName),
 		Key:    aws.String(fileID),
 	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+		return nil, ErrNoSuchFile
+	}
 	if err != nil {
 		return nil, fmt.Errorf("can't download file with id %s: %w", fileID, err)
 	}
 
-	buf, err := ioutil.ReadAll(resp.Body)
+	return resp.Body, nil
+}
+
+// DeleteFile deletes the file from the bucket, S3 doesn't report the missing file.
+func (s *S3Storage) DeleteFile(fileID string) error {
+	_, err := s.svc.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(s.s3conf.BucketName),
+		Key:    aws.String(fileID),
+	})
 	if err != nil {
-		return nil, fmt.Errorf("can't serialize response body: %w", err)
+		return fmt.Errorf("can't delete file with id %s: %w", fileID, err)
 	}
 
-	return bytes.NewReader(buf), nil
+	return nil
 }
 
 // GetDownloadURL returns URL to download а file from the bucket by the given file id.
@@ -118,3 +190,35 @@ func (s *S3Storage) GetDownloadURL(fileID string) (string, error) {
 
 	return url, err
 }
+
+// ApplyACL sets the configured ACL on every object of the bucket and returns the number of updated objects.
+// It migrates the objects uploaded before the ACL became configurable, e.g. the public ones to private.
+func (s *S3Storage) ApplyACL() (int, error) {
+	var (
+		updated int
+		aclErr  error
+	)
+
+	err := s.svc.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(s.s3conf.BucketName),
+	}, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, object := range page.Contents {
+			_, aclErr = s.svc.PutObjectAcl(&s3.PutObjectAclInput{
+				Bucket: aws.String(s.s3conf.BucketName),
+				Key:    object.Key,
+				ACL:    aws.String(s.s3conf.ACL),
+			})
+			if aclErr != nil {
+				aclErr = fmt.Errorf("can't update ACL of file with id %s: %w", aws.StringValue(object.Key), aclErr)
+				return false
+			}
+			updated++
+		}
+		return true
+	})
+	if err != nil {
+		return updated, fmt.Errorf("can't list files: %w", err)
+	}
+
+	return updated, aclErr
+}
@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/Konstantsiy/image-converter/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateAWSConfig(t *testing.T) {
+	testTable := []struct {
+		name          string
+		modify        func(conf *config.AWSConfig)
+		expectedError bool
+	}{
+		{
+			name:   "Ok",
+			modify: func(conf *config.AWSConfig) {},
+		},
+		{
+			name: "Ok with SSE-KMS",
+			modify: func(conf *config.AWSConfig) {
+				conf.StorageClass = "STANDARD_IA"
+				conf.SSE = "aws:kms"
+				conf.SSEKMSKeyID = "key"
+			},
+		},
+		{
+			name:          "No bucket",
+			modify:        func(conf *config.AWSConfig) { conf.BucketName = "" },
+			expectedError: true,
+		},
+		{
+			name:          "Invalid ACL",
+			modify:        func(conf *config.AWSConfig) { conf.ACL = "public" },
+			expectedError: true,
+		},
+		{
+			name:          "Invalid storage class",
+			modify:        func(conf *config.AWSConfig) { conf.StorageClass = "COLD" },
+			expectedError: true,
+		},
+		{
+			name:          "Invalid SSE",
+			modify:        func(conf *config.AWSConfig) { conf.SSE = "rsa" },
+			expectedError: true,
+		},
+		{
+			name: "KMS key without SSE-KMS",
+			modify: func(conf *config.AWSConfig) {
+				conf.SSE = "AES256"
+				conf.SSEKMSKeyID = "key"
+			},
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range testTable {
+		t.Run(tc.name, func(t *testing.T) {
+			conf := &config.AWSConfig{Region: "eu-central-1", BucketName: "images", ACL: "private"}
+			tc.modify(conf)
+
+			err := validateAWSConfig(conf)
+			assert.Equal(t, tc.expectedError, err != nil)
+		})
+	}
+}
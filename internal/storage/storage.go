@@ -4,9 +4,31 @@ import (
 	io "io"
 )
 
+const (
+	// BackendS3 selects the Amazon S3 storage.
+	BackendS3 = "s3"
+
+	// BackendLocal selects the storage in the local directory.
+	BackendLocal = "local"
+)
+
 // Storage represents images storage.
+// The files are streamed, DownloadFile returns the stream the caller has to close.
+// DeleteFile succeeds for the missing file, so that the interrupted deletion can be repeated.
 type Storage interface {
-	UploadFile(file io.ReadSeeker, fileID string) error
-	DownloadFile(fileID string) (io.ReadSeeker, error)
+	UploadFile(file io.Reader, fileID string) error
+	DownloadFile(fileID string) (io.ReadCloser, error)
 	GetDownloadURL(fileID string) (string, error)
+	DeleteFile(fileID string) error
+}
+
+// File represents the stored file opened for reading at any offset.
+type File interface {
+	io.ReadSeeker
+	io.Closer
+}
+
+// SignedFiles represents the storage serving its files by the signed download URLs.
+type SignedFiles interface {
+	OpenSigned(fileID, expires, signature string) (File, error)
 }
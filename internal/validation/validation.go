@@ -3,7 +3,13 @@ package validation
 
 import (
 	"fmt"
+	"net"
+	"net/url"
 	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Konstantsiy/image-converter/internal/converter"
 )
 
 const (
@@ -17,19 +23,67 @@ const (
 	passwordOneDigitRegex = "(.*[0-9])"
 	// filenameInvalidCharactersRegex searches for special characters in password.
 	filenameInvalidCharactersRegex = "[:#%^;<>\\{}[\\]+~`=?&,\" ]"
+	// renditionNameRegex checks that the rendition name consists of lowercase letters, digits, '-' and '_'.
+	renditionNameRegex = "^[a-z0-9_-]{1,30}$"
+	// uuidRegex checks the canonical textual form of UUID.
+	uuidRegex = "^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$"
 )
 
 const (
 	minPasswordLength = 8
 	maxPasswordLength = 20
 	minEmailLength    = 8
-	minRatio          = 1
-	maxRatio          = 99
+	maxDimension      = 10000
+	maxRenditions     = 10
+	maxBatchSize      = 50
+	maxWait           = time.Minute
+	maxURLLength      = 2048
+	maxPriority       = 9
+)
+
+// restrictedNetworks lists the loopback, private, link-local (including the cloud metadata address 169.254.169.254),
+// shared and reserved networks that the webhooks must not reach.
+var restrictedNetworks = parseNetworks(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"224.0.0.0/4",
+	"240.0.0.0/4",
+	"::/128",
+	"::1/128",
+	"fc00::/7",
+	"fe80::/10",
+	"ff00::/8",
 )
 
-var formats = map[string]struct{}{
-	"jpg": {},
-	"png": {},
+var fitModes = map[string]struct{}{
+	converter.FitContain: {},
+	converter.FitCover:   {},
+	converter.FitFill:    {},
+}
+
+var flipDirections = map[string]struct{}{
+	converter.FlipHorizontal: {},
+	converter.FlipVertical:   {},
+}
+
+var metadataModes = map[string]struct{}{
+	converter.MetadataStrip: {},
+	converter.MetadataKeep:  {},
+	converter.MetadataSafe:  {},
+}
+
+var rotations = map[int]struct{}{
+	0:   {},
+	90:  {},
+	180: {},
+	270: {},
 }
 
 // InvalidParameterError represents validation related error.
@@ -105,35 +159,30 @@ func ValidateConversionRequest(filename, sourceFormat, targetFormat string, rati
 		}
 	}
 
-	if targetFormat == "jpeg" {
-		targetFormat = "jpg"
-	}
-	if sourceFormat == "jpeg" {
-		sourceFormat = "jpg"
-	}
-
-	if _, ok := formats[sourceFormat]; !ok {
+	source, ok := converter.Lookup(sourceFormat)
+	if !ok {
 		return &InvalidParameterError{
 			Param:   "source format",
-			Message: "needed jpg or png",
+			Message: "needed one of " + strings.Join(converter.Formats(), ", "),
 		}
 	}
 
-	if _, ok := formats[targetFormat]; !ok {
+	target, ok := converter.Lookup(targetFormat)
+	if !ok || !converter.CanEncode(targetFormat) {
 		return &InvalidParameterError{
 			Param:   "target format",
-			Message: "needed jpg or png",
+			Message: "needed one of " + strings.Join(converter.TargetFormats(), ", "),
 		}
 	}
 
-	if sourceFormat == targetFormat {
+	if !converter.CanConvert(source.Format(), target.Format()) {
 		return &InvalidParameterError{
 			Param:   "formats",
 			Message: "source and target formats should differ",
 		}
 	}
 
-	if ratio < minRatio || ratio > maxRatio {
+	if minRatio, maxRatio := target.RatioRange(); ratio < minRatio || ratio > maxRatio {
 		return &InvalidParameterError{
 			Param:   "ratio",
 			Message: fmt.Sprintf("needed a value from %d to %d inclusive", minRatio, maxRatio),
@@ -142,3 +191,230 @@ func ValidateConversionRequest(filename, sourceFormat, targetFormat string, rati
 
 	return nil
 }
+
+// ValidateConversionOptions validates the resize, crop, rotation, flip and metadata parameters of the conversion request.
+func ValidateConversionOptions(opts converter.Options) error {
+	if opts.Width < 0 || opts.Width > maxDimension {
+		return &InvalidParameterError{
+			Param:   "width",
+			Message: fmt.Sprintf("needed a value from 1 to %d inclusive", maxDimension),
+		}
+	}
+
+	if opts.Height < 0 || opts.Height > maxDimension {
+		return &InvalidParameterError{
+			Param:   "height",
+			Message: fmt.Sprintf("needed a value from 1 to %d inclusive", maxDimension),
+		}
+	}
+
+	if int64(opts.Width)*int64(opts.Height) > converter.MaxPixels {
+		return &InvalidParameterError{
+			Param:   "size",
+			Message: fmt.Sprintf("needed width * height up to %d pixels", converter.MaxPixels),
+		}
+	}
+
+	if _, ok := fitModes[opts.Fit]; opts.Fit != "" && !ok {
+		return &InvalidParameterError{
+			Param:   "fit",
+			Message: "needed contain, cover or fill",
+		}
+	}
+
+	if opts.Fit != "" && (opts.Width == 0 || opts.Height == 0) {
+		return &InvalidParameterError{
+			Param:   "fit",
+			Message: "requires both width and height",
+		}
+	}
+
+	if c := opts.Crop; c != nil && (c.X < 0 || c.Y < 0 || c.Width <= 0 || c.Height <= 0) {
+		return &InvalidParameterError{
+			Param:   "crop",
+			Message: "needed non-negative position and positive size",
+		}
+	}
+
+	if _, ok := rotations[opts.Rotation]; !ok {
+		return &InvalidParameterError{
+			Param:   "rotation",
+			Message: "needed 90, 180 or 270",
+		}
+	}
+
+	if _, ok := flipDirections[opts.Flip]; opts.Flip != "" && !ok {
+		return &InvalidParameterError{
+			Param:   "flip",
+			Message: "needed horizontal or vertical",
+		}
+	}
+
+	if _, ok := metadataModes[opts.Metadata]; opts.Metadata != "" && !ok {
+		return &InvalidParameterError{
+			Param:   "metadata",
+			Message: "needed strip, keep or safe",
+		}
+	}
+
+	return nil
+}
+
+// ValidateRenditions validates the renditions declared by the conversion request.
+func ValidateRenditions(renditions []converter.Rendition) error {
+	if len(renditions) > maxRenditions {
+		return &InvalidParameterError{
+			Param:   "renditions",
+			Message: fmt.Sprintf("needed at most %d renditions", maxRenditions),
+		}
+	}
+
+	names := make(map[string]struct{}, len(renditions))
+	for _, r := range renditions {
+		if match, _ := regexp.MatchString(renditionNameRegex, r.Name); !match {
+			return &InvalidParameterError{
+				Param:   "rendition name",
+				Message: "needed 1 to 30 lowercase letters, digits, '-' or '_'",
+			}
+		}
+
+		if _, ok := names[r.Name]; ok {
+			return &InvalidParameterError{
+				Param:   "rendition name",
+				Message: fmt.Sprintf("%s is used more than once", r.Name),
+			}
+		}
+		names[r.Name] = struct{}{}
+
+		if r.Width < 0 || r.Width > maxDimension || r.Height < 0 || r.Height > maxDimension || r.Width == 0 && r.Height == 0 {
+			return &InvalidParameterError{
+				Param:   "rendition size",
+				Message: fmt.Sprintf("needed width or height from 1 to %d inclusive", maxDimension),
+			}
+		}
+
+		if int64(r.Width)*int64(r.Height) > converter.MaxPixels {
+			return &InvalidParameterError{
+				Param:   "rendition size",
+				Message: fmt.Sprintf("needed width * height up to %d pixels", converter.MaxPixels),
+			}
+		}
+
+		codec, ok := converter.Lookup(r.Format)
+		if !ok || !converter.CanEncode(r.Format) {
+			return &InvalidParameterError{
+				Param:   "rendition format",
+				Message: "needed one of " + strings.Join(converter.TargetFormats(), ", "),
+			}
+		}
+
+		if minRatio, maxRatio := codec.RatioRange(); r.Ratio < minRatio || r.Ratio > maxRatio {
+			return &InvalidParameterError{
+				Param:   "rendition ratio",
+				Message: fmt.Sprintf("needed a value from %d to %d inclusive", minRatio, maxRatio),
+			}
+		}
+	}
+
+	return nil
+}
+
+// ValidateBatchSize validates the number of files in the batch conversion request.
+func ValidateBatchSize(size int) error {
+	if size < 1 || size > maxBatchSize {
+		return &InvalidParameterError{
+			Param:   "files",
+			Message: fmt.Sprintf("needed from 1 to %d files", maxBatchSize),
+		}
+	}
+	return nil
+}
+
+// ValidateWait validates the long-polling wait time of the request status query.
+func ValidateWait(wait time.Duration) error {
+	if wait < 0 || wait > maxWait {
+		return &InvalidParameterError{
+			Param:   "wait",
+			Message: fmt.Sprintf("needed a duration from 0s to %s", maxWait),
+		}
+	}
+	return nil
+}
+
+// ValidatePriority validates the requested priority of the conversion request.
+func ValidatePriority(priority int) error {
+	if priority < 0 || priority > maxPriority {
+		return &InvalidParameterError{
+			Param:   "priority",
+			Message: fmt.Sprintf("needed a value from 0 to %d inclusive", maxPriority),
+		}
+	}
+	return nil
+}
+
+// ValidateID validates the id of the requested entity, the ids are UUIDs.
+func ValidateID(param, id string) error {
+	if match, _ := regexp.MatchString(uuidRegex, id); !match {
+		return &InvalidParameterError{
+			Param:   param,
+			Message: "needed a UUID",
+		}
+	}
+	return nil
+}
+
+// ValidateWebhookURL validates the URL of the registered webhook.
+func ValidateWebhookURL(rawURL string) error {
+	if len(rawURL) > maxURLLength {
+		return &InvalidParameterError{
+			Param:   "url",
+			Message: fmt.Sprintf("needed maximum %d characters", maxURLLength),
+		}
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return &InvalidParameterError{
+			Param:   "url",
+			Message: "needed an absolute http or https URL",
+		}
+	}
+
+	// The host names are resolved and checked once again by the notifier when it connects.
+	host := strings.ToLower(u.Hostname())
+	ip := net.ParseIP(host)
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") || (ip != nil && !IsPublicIP(ip)) {
+		return &InvalidParameterError{
+			Param:   "url",
+			Message: "needed a public host",
+		}
+	}
+
+	return nil
+}
+
+// IsPublicIP reports whether the IP address is reachable from the internet,
+// i.e. it's not a loopback, private, link-local, metadata or other reserved address.
+func IsPublicIP(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	for _, network := range restrictedNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
@@ -1,7 +1,12 @@
 package validation
 
 import (
+	"net"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/Konstantsiy/image-converter/internal/converter"
 )
 
 func assertNoError(t *testing.T, err error) {
@@ -129,6 +134,38 @@ func TestValidateConversionRequest(t *testing.T) {
 			IsErrorExpected:      true,
 			ExpectedInvalidParam: "formats",
 		},
+		{
+			Filename:             "filename",
+			SourceFormat:         "webp",
+			TargetFormat:         "gif",
+			Ratio:                50,
+			IsErrorExpected:      false,
+			ExpectedInvalidParam: "",
+		},
+		{
+			Filename:             "filename",
+			SourceFormat:         "png",
+			TargetFormat:         "webp",
+			Ratio:                50,
+			IsErrorExpected:      true,
+			ExpectedInvalidParam: "target format",
+		},
+		{
+			Filename:             "filename",
+			SourceFormat:         "bmp",
+			TargetFormat:         "tif",
+			Ratio:                50,
+			IsErrorExpected:      false,
+			ExpectedInvalidParam: "",
+		},
+		{
+			Filename:             "filename",
+			SourceFormat:         "tif",
+			TargetFormat:         "tiff",
+			Ratio:                50,
+			IsErrorExpected:      true,
+			ExpectedInvalidParam: "formats",
+		},
 		{
 			Filename:             "filename",
 			SourceFormat:         "jpg",
@@ -149,3 +186,303 @@ func TestValidateConversionRequest(t *testing.T) {
 		}
 	}
 }
+
+func TestValidateConversionOptions(t *testing.T) {
+	testTable := []struct {
+		Options              converter.Options
+		IsErrorExpected      bool
+		ExpectedInvalidParam string
+	}{
+		{
+			Options:         converter.Options{},
+			IsErrorExpected: false,
+		},
+		{
+			Options: converter.Options{
+				Width:    100,
+				Height:   50,
+				Fit:      converter.FitCover,
+				Crop:     &converter.Crop{X: 0, Y: 10, Width: 20, Height: 20},
+				Rotation: 270,
+				Flip:     converter.FlipHorizontal,
+				Metadata: converter.MetadataSafe,
+			},
+			IsErrorExpected: false,
+		},
+		{
+			Options:              converter.Options{Width: -1},
+			IsErrorExpected:      true,
+			ExpectedInvalidParam: "width",
+		},
+		{
+			Options:              converter.Options{Height: 100000},
+			IsErrorExpected:      true,
+			ExpectedInvalidParam: "height",
+		},
+		{
+			Options:              converter.Options{Width: 10000, Height: 10000, Fit: converter.FitFill},
+			IsErrorExpected:      true,
+			ExpectedInvalidParam: "size",
+		},
+		{
+			Options:              converter.Options{Width: 10, Height: 10, Fit: "stretch"},
+			IsErrorExpected:      true,
+			ExpectedInvalidParam: "fit",
+		},
+		{
+			Options:              converter.Options{Width: 10, Fit: converter.FitFill},
+			IsErrorExpected:      true,
+			ExpectedInvalidParam: "fit",
+		},
+		{
+			Options:              converter.Options{Crop: &converter.Crop{X: -1, Width: 10, Height: 10}},
+			IsErrorExpected:      true,
+			ExpectedInvalidParam: "crop",
+		},
+		{
+			Options:              converter.Options{Rotation: 45},
+			IsErrorExpected:      true,
+			ExpectedInvalidParam: "rotation",
+		},
+		{
+			Options:              converter.Options{Flip: "diagonal"},
+			IsErrorExpected:      true,
+			ExpectedInvalidParam: "flip",
+		},
+		{
+			Options:              converter.Options{Metadata: "all"},
+			IsErrorExpected:      true,
+			ExpectedInvalidParam: "metadata",
+		},
+	}
+
+	for _, tc := range testTable {
+		err := ValidateConversionOptions(tc.Options)
+		verr, _ := err.(*InvalidParameterError)
+		if tc.IsErrorExpected {
+			assertError(t, verr.Param, tc.ExpectedInvalidParam)
+		} else {
+			assertNoError(t, err)
+		}
+	}
+}
+
+func TestValidateRenditions(t *testing.T) {
+	small := converter.Rendition{Name: "small", Width: 150, Height: 150, Format: "png", Ratio: 80}
+
+	testTable := []struct {
+		Renditions           []converter.Rendition
+		IsErrorExpected      bool
+		ExpectedInvalidParam string
+	}{
+		{
+			Renditions:      nil,
+			IsErrorExpected: false,
+		},
+		{
+			Renditions: []converter.Rendition{
+				small,
+				{Name: "large", Width: 1200, Format: "jpeg", Ratio: 90},
+			},
+			IsErrorExpected: false,
+		},
+		{
+			Renditions:           make([]converter.Rendition, maxRenditions+1),
+			IsErrorExpected:      true,
+			ExpectedInvalidParam: "renditions",
+		},
+		{
+			Renditions:           []converter.Rendition{{Name: "Small!", Width: 10, Format: "png", Ratio: 50}},
+			IsErrorExpected:      true,
+			ExpectedInvalidParam: "rendition name",
+		},
+		{
+			Renditions:           []converter.Rendition{small, small},
+			IsErrorExpected:      true,
+			ExpectedInvalidParam: "rendition name",
+		},
+		{
+			Renditions:           []converter.Rendition{{Name: "empty", Format: "png", Ratio: 50}},
+			IsErrorExpected:      true,
+			ExpectedInvalidParam: "rendition size",
+		},
+		{
+			Renditions:           []converter.Rendition{{Name: "huge", Width: 10000, Height: 10000, Format: "png", Ratio: 50}},
+			IsErrorExpected:      true,
+			ExpectedInvalidParam: "rendition size",
+		},
+		{
+			Renditions:           []converter.Rendition{{Name: "vector", Width: 10, Format: "svg", Ratio: 50}},
+			IsErrorExpected:      true,
+			ExpectedInvalidParam: "rendition format",
+		},
+		{
+			Renditions:           []converter.Rendition{{Name: "small", Width: 10, Format: "webp", Ratio: 50}},
+			IsErrorExpected:      true,
+			ExpectedInvalidParam: "rendition format",
+		},
+		{
+			Renditions:           []converter.Rendition{{Name: "small", Width: 10, Format: "png", Ratio: 100}},
+			IsErrorExpected:      true,
+			ExpectedInvalidParam: "rendition ratio",
+		},
+	}
+
+	for _, tc := range testTable {
+		err := ValidateRenditions(tc.Renditions)
+		verr, _ := err.(*InvalidParameterError)
+		if tc.IsErrorExpected {
+			assertError(t, verr.Param, tc.ExpectedInvalidParam)
+		} else {
+			assertNoError(t, err)
+		}
+	}
+}
+
+func TestValidateBatchSize(t *testing.T) {
+	testTable := []struct {
+		Size            int
+		IsErrorExpected bool
+	}{
+		{Size: 1, IsErrorExpected: false},
+		{Size: maxBatchSize, IsErrorExpected: false},
+		{Size: 0, IsErrorExpected: true},
+		{Size: maxBatchSize + 1, IsErrorExpected: true},
+	}
+
+	for _, tc := range testTable {
+		err := ValidateBatchSize(tc.Size)
+		verr, _ := err.(*InvalidParameterError)
+		if tc.IsErrorExpected {
+			assertError(t, verr.Param, "files")
+		} else {
+			assertNoError(t, err)
+		}
+	}
+}
+
+func TestValidateWait(t *testing.T) {
+	testTable := []struct {
+		Wait            time.Duration
+		IsErrorExpected bool
+	}{
+		{Wait: 0, IsErrorExpected: false},
+		{Wait: 30 * time.Second, IsErrorExpected: false},
+		{Wait: maxWait, IsErrorExpected: false},
+		{Wait: -time.Second, IsErrorExpected: true},
+		{Wait: maxWait + time.Second, IsErrorExpected: true},
+	}
+
+	for _, tc := range testTable {
+		err := ValidateWait(tc.Wait)
+		verr, _ := err.(*InvalidParameterError)
+		if tc.IsErrorExpected {
+			assertError(t, verr.Param, "wait")
+		} else {
+			assertNoError(t, err)
+		}
+	}
+}
+
+func TestValidatePriority(t *testing.T) {
+	testTable := []struct {
+		Priority        int
+		IsErrorExpected bool
+	}{
+		{Priority: 0, IsErrorExpected: false},
+		{Priority: maxPriority, IsErrorExpected: false},
+		{Priority: -1, IsErrorExpected: true},
+		{Priority: maxPriority + 1, IsErrorExpected: true},
+	}
+
+	for _, tc := range testTable {
+		err := ValidatePriority(tc.Priority)
+		verr, _ := err.(*InvalidParameterError)
+		if tc.IsErrorExpected {
+			assertError(t, verr.Param, "priority")
+		} else {
+			assertNoError(t, err)
+		}
+	}
+}
+
+func TestValidateID(t *testing.T) {
+	testTable := []struct {
+		ID              string
+		IsErrorExpected bool
+	}{
+		{ID: "0f6b3c1e-8f2a-11ec-b909-0242ac120002", IsErrorExpected: false},
+		{ID: "0F6B3C1E-8F2A-11EC-B909-0242AC120002", IsErrorExpected: false},
+		{ID: "", IsErrorExpected: true},
+		{ID: "2", IsErrorExpected: true},
+		{ID: "0f6b3c1e8f2a11ecb9090242ac120002", IsErrorExpected: true},
+		{ID: "0f6b3c1e-8f2a-11ec-b909-0242ac12000z", IsErrorExpected: true},
+	}
+
+	for _, tc := range testTable {
+		err := ValidateID("id", tc.ID)
+		verr, _ := err.(*InvalidParameterError)
+		if tc.IsErrorExpected {
+			assertError(t, verr.Param, "id")
+		} else {
+			assertNoError(t, err)
+		}
+	}
+}
+
+func TestIsPublicIP(t *testing.T) {
+	testTable := []struct {
+		IP       string
+		Expected bool
+	}{
+		{IP: "93.184.216.34", Expected: true},
+		{IP: "2606:2800:220:1:248:1893:25c8:1946", Expected: true},
+		{IP: "127.0.0.1", Expected: false},
+		{IP: "169.254.169.254", Expected: false},
+		{IP: "10.0.0.1", Expected: false},
+		{IP: "10.255.255.255", Expected: false},
+		{IP: "172.16.0.1", Expected: false},
+		{IP: "192.168.1.1", Expected: false},
+		{IP: "0.0.0.0", Expected: false},
+		{IP: "::1", Expected: false},
+		{IP: "::ffff:127.0.0.1", Expected: false},
+		{IP: "fd00:ec2::254", Expected: false},
+		{IP: "fe80::1", Expected: false},
+	}
+
+	for _, tc := range testTable {
+		if actual := IsPublicIP(net.ParseIP(tc.IP)); actual != tc.Expected {
+			t.Errorf("IsPublicIP(%s) = %v, expected %v", tc.IP, actual, tc.Expected)
+		}
+	}
+}
+
+func TestValidateWebhookURL(t *testing.T) {
+	testTable := []struct {
+		URL             string
+		IsErrorExpected bool
+	}{
+		{URL: "https://example.com/hooks/converter", IsErrorExpected: false},
+		{URL: "http://93.184.216.34:8081/hooks", IsErrorExpected: false},
+		{URL: "http://localhost:8081", IsErrorExpected: true},
+		{URL: "http://127.0.0.1:8081", IsErrorExpected: true},
+		{URL: "http://169.254.169.254/latest/meta-data", IsErrorExpected: true},
+		{URL: "http://10.1.2.3/hooks", IsErrorExpected: true},
+		{URL: "http://[::1]:8081", IsErrorExpected: true},
+		{URL: "", IsErrorExpected: true},
+		{URL: "/hooks/converter", IsErrorExpected: true},
+		{URL: "ftp://example.com", IsErrorExpected: true},
+		{URL: "https://", IsErrorExpected: true},
+		{URL: "https://example.com/" + strings.Repeat("a", maxURLLength), IsErrorExpected: true},
+	}
+
+	for _, tc := range testTable {
+		err := ValidateWebhookURL(tc.URL)
+		verr, _ := err.(*InvalidParameterError)
+		if tc.IsErrorExpected {
+			assertError(t, verr.Param, "url")
+		} else {
+			assertNoError(t, err)
+		}
+	}
+}
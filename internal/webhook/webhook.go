@@ -0,0 +1,216 @@
+// Package webhook notifies the URLs registered by users about finished conversion requests.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Konstantsiy/image-converter/internal/repository"
+	"github.com/Konstantsiy/image-converter/internal/validation"
+	"github.com/Konstantsiy/image-converter/pkg/logger"
+)
+
+const (
+	// SignatureHeader contains the hex-encoded HMAC-SHA256 of the request body prefixed with "sha256=".
+	SignatureHeader = "X-Webhook-Signature"
+
+	defaultMaxAttempts = 5
+	defaultBackoff     = time.Second
+	deliveryTimeout    = 10 * time.Second
+	dialTimeout        = 5 * time.Second
+	secretLength       = 32
+	maxResponseSize    = 64 << 10
+)
+
+// ErrRestrictedAddress notifies that the webhook URL resolves to the loopback, private, link-local or metadata address.
+var ErrRestrictedAddress = errors.New("webhook address is not public")
+
+// Payload represents the JSON body sent to the webhook URL.
+type Payload struct {
+	RequestID string    `json:"request_id"`
+	Status    string    `json:"status"`
+	TargetID  string    `json:"target_id,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Notifier delivers the payloads to the webhooks of the request.
+// Failed deliveries are retried with exponential backoff, every attempt is logged in the repository.
+type Notifier struct {
+	repo        repository.Webhooks
+	client      *http.Client
+	maxAttempts int
+	backoff     time.Duration
+}
+
+// NewNotifier creates new webhook notifier.
+func NewNotifier(repo repository.Webhooks) *Notifier {
+	return &Notifier{
+		repo:        repo,
+		client:      newClient(),
+		maxAttempts: defaultMaxAttempts,
+		backoff:     defaultBackoff,
+	}
+}
+
+// newClient creates the HTTP client that connects only to the public addresses, so that the users can't
+// reach the internal services through their webhooks. The address is checked at connect time after
+// the host name is resolved, which also covers the DNS records changed after the webhook was registered.
+// The redirects aren't followed and the proxy from the environment isn't used for the same reason.
+func newClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: dialTimeout,
+		Control: restrictAddress,
+	}
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: dialTimeout,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+		Timeout: deliveryTimeout,
+	}
+}
+
+// restrictAddress refuses the connection to the address that isn't public.
+func restrictAddress(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !validation.IsPublicIP(ip) {
+		return fmt.Errorf("can't connect to %s: %w", host, ErrRestrictedAddress)
+	}
+	return nil
+}
+
+// Notify sends the request status to all webhooks of the request and waits until the deliveries finish.
+func (n *Notifier) Notify(ctx context.Context, requestID, status, targetID string) {
+	webhooks, err := n.repo.GetRequestWebhooks(ctx, requestID)
+	if err != nil {
+		logger.FromContext(ctx).WithField("request_id", requestID).
+			Errorln(fmt.Errorf("can't get request webhooks: %w", err))
+		return
+	}
+	if len(webhooks) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(Payload{RequestID: requestID, Status: status, TargetID: targetID, Timestamp: time.Now().UTC()})
+	if err != nil {
+		logger.FromContext(ctx).WithField("request_id", requestID).
+			Errorln(fmt.Errorf("can't encode webhook payload: %w", err))
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, webhook := range webhooks {
+		wg.Add(1)
+		go func(webhook repository.Webhook) {
+			defer wg.Done()
+			n.deliver(ctx, webhook, requestID, body)
+		}(webhook)
+	}
+	wg.Wait()
+}
+
+// deliver sends the body to the webhook until it is accepted or the attempts run out.
+func (n *Notifier) deliver(ctx context.Context, webhook repository.Webhook, requestID string, body []byte) {
+	backoff := n.backoff
+	for attempt := 1; attempt <= n.maxAttempts; attempt++ {
+		statusCode, err := n.send(ctx, webhook, body)
+
+		delivery := repository.WebhookDelivery{
+			WebhookID:  webhook.ID,
+			RequestID:  requestID,
+			Attempt:    attempt,
+			StatusCode: statusCode,
+		}
+		if err != nil {
+			delivery.Error = err.Error()
+		}
+		if lErr := n.repo.InsertDelivery(ctx, delivery); lErr != nil {
+			logger.FromContext(ctx).WithField("webhook_id", webhook.ID).Errorln(lErr)
+		}
+
+		if err == nil {
+			logger.FromContext(ctx).WithField("webhook_id", webhook.ID).WithField("request_id", requestID).
+				Infoln("webhook delivered")
+			return
+		}
+		if !retryable(statusCode) || errors.Is(err, ErrRestrictedAddress) || attempt == n.maxAttempts {
+			logger.FromContext(ctx).WithField("webhook_id", webhook.ID).WithField("request_id", requestID).
+				Errorln(fmt.Errorf("webhook delivery failed after %d attempts: %w", attempt, err))
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// send posts the signed body to the webhook URL and returns the response status code.
+func (n *Notifier) send(ctx context.Context, webhook repository.Webhook, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("can't create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, "sha256="+Sign(webhook.Secret, body))
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("can't send webhook request: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxResponseSize))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected response status %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// retryable reports whether the delivery that ended with the status code (0 for network errors) should be retried.
+// The redirect responses aren't followed and fail the delivery without retries.
+func retryable(statusCode int) bool {
+	return statusCode == 0 || statusCode == http.StatusTooManyRequests || statusCode >= 500
+}
+
+// Sign returns the hex-encoded HMAC-SHA256 of the body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// GenerateSecret generates a random signing secret for the new webhook.
+func GenerateSecret() (string, error) {
+	b := make([]byte, secretLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("can't generate webhook secret: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
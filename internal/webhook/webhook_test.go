@@ -0,0 +1,174 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Konstantsiy/image-converter/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRepository keeps the webhooks and the delivery log in memory.
+type fakeRepository struct {
+	repository.Webhooks
+
+	mu         sync.Mutex
+	webhooks   []repository.Webhook
+	deliveries []repository.WebhookDelivery
+}
+
+func (f *fakeRepository) GetRequestWebhooks(_ context.Context, _ string) ([]repository.Webhook, error) {
+	return f.webhooks, nil
+}
+
+func (f *fakeRepository) InsertDelivery(_ context.Context, delivery repository.WebhookDelivery) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.deliveries = append(f.deliveries, delivery)
+	return nil
+}
+
+func TestNotifier_Notify(t *testing.T) {
+	const secret = "secret"
+
+	testTable := []struct {
+		name               string
+		responses          []int
+		expectedDeliveries []int
+	}{
+		{
+			name:               "Ok",
+			responses:          []int{http.StatusOK},
+			expectedDeliveries: []int{http.StatusOK},
+		},
+		{
+			name:               "Retry after server error",
+			responses:          []int{http.StatusInternalServerError, http.StatusTooManyRequests, http.StatusNoContent},
+			expectedDeliveries: []int{http.StatusInternalServerError, http.StatusTooManyRequests, http.StatusNoContent},
+		},
+		{
+			name:               "No retry after client error",
+			responses:          []int{http.StatusNotFound},
+			expectedDeliveries: []int{http.StatusNotFound},
+		},
+		{
+			name:               "Attempts run out",
+			responses:          []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway},
+			expectedDeliveries: []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway},
+		},
+	}
+
+	for _, tc := range testTable {
+		t.Run(tc.name, func(t *testing.T) {
+			calls := 0
+			receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, err := ioutil.ReadAll(r.Body)
+				require.NoError(t, err)
+				assert.Equal(t, "sha256="+Sign(secret, body), r.Header.Get(SignatureHeader))
+
+				var payload Payload
+				require.NoError(t, json.Unmarshal(body, &payload))
+				assert.Equal(t, Payload{RequestID: "1", Status: repository.RequestStatusDone, TargetID: "2", Timestamp: payload.Timestamp}, payload)
+
+				w.WriteHeader(tc.responses[calls])
+				calls++
+			}))
+			defer receiver.Close()
+
+			repo := &fakeRepository{webhooks: []repository.Webhook{{ID: "10", URL: receiver.URL, Secret: secret}}}
+			n := NewNotifier(repo)
+			n.client = receiver.Client()
+			n.maxAttempts, n.backoff = 3, time.Millisecond
+
+			n.Notify(context.Background(), "1", repository.RequestStatusDone, "2")
+
+			require.Len(t, repo.deliveries, len(tc.expectedDeliveries))
+			for i, statusCode := range tc.expectedDeliveries {
+				assert.Equal(t, i+1, repo.deliveries[i].Attempt)
+				assert.Equal(t, statusCode, repo.deliveries[i].StatusCode)
+				assert.Equal(t, "10", repo.deliveries[i].WebhookID)
+			}
+		})
+	}
+}
+
+func TestNotifier_NotifyUnreachable(t *testing.T) {
+	receiver := httptest.NewServer(http.NotFoundHandler())
+	url := receiver.URL
+	receiver.Close()
+
+	repo := &fakeRepository{webhooks: []repository.Webhook{{ID: "10", URL: url, Secret: "secret"}}}
+	n := NewNotifier(repo)
+	n.client = receiver.Client()
+	n.maxAttempts, n.backoff = 2, time.Millisecond
+
+	n.Notify(context.Background(), "1", repository.RequestStatusFailed, "")
+
+	require.Len(t, repo.deliveries, 2)
+	for _, d := range repo.deliveries {
+		assert.Zero(t, d.StatusCode)
+		assert.NotEmpty(t, d.Error)
+	}
+}
+
+func TestNotifier_NotifyRestrictedAddress(t *testing.T) {
+	called := false
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer receiver.Close()
+
+	testTable := []struct {
+		name string
+		url  string
+	}{
+		{name: "Loopback", url: receiver.URL},
+		{name: "Localhost", url: strings.Replace(receiver.URL, "127.0.0.1", "localhost", 1)},
+		{name: "Metadata", url: "http://169.254.169.254/latest/meta-data"},
+		{name: "Private", url: "http://10.0.0.1:8080/hooks"},
+	}
+
+	for _, tc := range testTable {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := &fakeRepository{webhooks: []repository.Webhook{{ID: "10", URL: tc.url, Secret: "secret"}}}
+			n := NewNotifier(repo)
+			n.maxAttempts, n.backoff = 3, time.Millisecond
+
+			n.Notify(context.Background(), "1", repository.RequestStatusDone, "2")
+
+			require.Len(t, repo.deliveries, 1)
+			assert.Zero(t, repo.deliveries[0].StatusCode)
+			assert.Contains(t, repo.deliveries[0].Error, ErrRestrictedAddress.Error())
+			assert.False(t, called)
+		})
+	}
+}
+
+func TestNotifier_NotifyRedirect(t *testing.T) {
+	receiver := httptest.NewServer(http.RedirectHandler("http://169.254.169.254/latest/meta-data", http.StatusFound))
+	defer receiver.Close()
+
+	repo := &fakeRepository{webhooks: []repository.Webhook{{ID: "10", URL: receiver.URL, Secret: "secret"}}}
+	n := NewNotifier(repo)
+	n.client.Transport = receiver.Client().Transport
+	n.maxAttempts, n.backoff = 3, time.Millisecond
+
+	n.Notify(context.Background(), "1", repository.RequestStatusDone, "2")
+
+	require.Len(t, repo.deliveries, 1)
+	assert.Equal(t, http.StatusFound, repo.deliveries[0].StatusCode)
+}
+
+func TestSign(t *testing.T) {
+	// echo -n '{"request_id":"1"}' | openssl dgst -sha256 -hmac secret
+	assert.Equal(t, "c3db7136aaddefe11ae29c194cbfd3c0ad3bf23e7c6ad428c0dd8c07a72f4393",
+		Sign("secret", []byte(`{"request_id":"1"}`)))
+}
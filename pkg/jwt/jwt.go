@@ -3,6 +3,10 @@ package jwt
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"time"
 
@@ -17,8 +21,11 @@ const (
 	// AccessTokenTimeout determines the validity period of the access token.
 	AccessTokenTimeout = 12 * time.Hour
 
-	// RefreshTokenTimeout 	// AccessTokenTimeout determines the validity period of the refresh token.
+	// RefreshTokenTimeout determines the validity period of the refresh token.
 	RefreshTokenTimeout = 48 * time.Hour
+
+	// refreshTokenSize is the number of random bytes of the refresh token.
+	refreshTokenSize = 32
 )
 
 // TokenManager implements functionality for Access & Refresh tokens generation.
@@ -46,14 +53,21 @@ func (tm *TokenManager) GenerateAccessToken(userID string) (string, error) {
 	return token.SignedString([]byte(tm.signingKey))
 }
 
-// GenerateRefreshToken generates new refresh token.
+// GenerateRefreshToken generates new opaque refresh token. The token is bound to the user by the stored hash,
+// see HashRefreshToken, so it can be revoked unlike the access token.
 func (tm *TokenManager) GenerateRefreshToken() (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.StandardClaims{
-		ExpiresAt: time.Now().Add(RefreshTokenTimeout).Unix(),
-		IssuedAt:  time.Now().Unix(),
-	})
+	b := make([]byte, refreshTokenSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("can't generate random bytes: %w", err)
+	}
 
-	return token.SignedString([]byte(tm.signingKey))
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashRefreshToken returns the hex encoded SHA-256 of the refresh token, only the hash is stored.
+func HashRefreshToken(refreshToken string) string {
+	sum := sha256.Sum256([]byte(refreshToken))
+	return hex.EncodeToString(sum[:])
 }
 
 // ParseToken parses the given token, checks it validity and returns the user ID.
@@ -72,7 +86,7 @@ func (tm *TokenManager) ParseToken(accessToken string) (string, error) {
 	logger.FromContext(context.Background()).Infoln("token is valid")
 
 	claims, ok := token.Claims.(*jwt.StandardClaims)
-	if !ok {
+	if !ok || claims.Subject == "" {
 		return "", fmt.Errorf("can't get user claims from token")
 	}
 
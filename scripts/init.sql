@@ -22,6 +22,12 @@ do $$
     end
 $$;
 
+alter type file_format add value if not exists 'webp';
+alter type file_format add value if not exists 'gif';
+alter type file_format add value if not exists 'bmp';
+alter type file_format add value if not exists 'tif';
+alter type file_format add value if not exists 'tiff';
+
 do $$
     begin
         if not exists(select 1 from pg_type where typname = 'status') then
@@ -34,31 +40,215 @@ create table if not exists converter.users (
     id uuid default uuid_generate_v1() primary key,
     email varchar(50) unique not null,
     password varchar(120) not null,
+    priority int default 5 not null check ( priority between 0 and 9 ),
+    original_retention interval,
+    converted_retention interval,
     created timestamp without time zone default current_timestamp not null,
     updated timestamp without time zone default current_timestamp not null
 );
 
+alter table converter.users add column if not exists priority int default 5 not null check ( priority between 0 and 9 );
+alter table converter.users add column if not exists original_retention interval;
+alter table converter.users add column if not exists converted_retention interval;
+
 create table if not exists converter.images (
     id uuid default uuid_generate_v1() primary key,
     name varchar(80) not null,
     format file_format not null,
+    hash char(64),
+    refs int default 1 not null check ( refs >= 0 ),
+    stored boolean default true not null,
+    deleted timestamp without time zone,
     created timestamp without time zone default current_timestamp not null,
     updated timestamp without time zone default current_timestamp not null
 );
 
+alter table converter.images add column if not exists hash char(64);
+alter table converter.images add column if not exists refs int default 1 not null check ( refs >= 0 );
+alter table converter.images add column if not exists stored boolean default true not null;
+alter table converter.images add column if not exists deleted timestamp without time zone;
+
+create unique index if not exists images_hash_idx on converter.images (hash, format)
+    where hash is not null and deleted is null;
+create index if not exists images_deleted_idx on converter.images (deleted) where deleted is not null and stored;
+
+create table if not exists converter.batches (
+    id uuid default uuid_generate_v1() primary key,
+    user_id uuid not null,
+    created timestamp without time zone default current_timestamp not null,
+
+    foreign key (user_id) references converter.users(id)
+);
+
 create table if not exists converter.requests (
     id uuid default uuid_generate_v1() primary key,
     user_id uuid not null,
     source_id uuid not null,
+    filename varchar(80),
     target_id uuid,
     source_format file_format not null,
     target_format file_format not null,
     ratio int check ( ratio > 0  and ratio < 100),
     status status not null,
+    width int check ( width > 0 ),
+    height int check ( height > 0 ),
+    fit varchar(10),
+    crop_x int,
+    crop_y int,
+    crop_width int,
+    crop_height int,
+    rotation int check ( rotation in (90, 180, 270) ),
+    flip varchar(10),
+    metadata varchar(10),
+    batch_id uuid,
+    retry_count int default 0 not null,
+    last_error text,
+    priority int default 5 not null check ( priority between 0 and 9 ),
     created timestamp without time zone default current_timestamp not null,
     updated timestamp without time zone default current_timestamp not null,
 
     foreign key (user_id) references converter.users(id),
     foreign key (source_id) references converter.images(id),
-    foreign key (target_id) references converter.images(id)
-);
\ No newline at end of file
+    foreign key (target_id) references converter.images(id),
+    foreign key (batch_id) references converter.batches(id)
+);
+
+alter table converter.requests add column if not exists width int check ( width > 0 );
+alter table converter.requests add column if not exists height int check ( height > 0 );
+alter table converter.requests add column if not exists fit varchar(10);
+alter table converter.requests add column if not exists crop_x int;
+alter table converter.requests add column if not exists crop_y int;
+alter table converter.requests add column if not exists crop_width int;
+alter table converter.requests add column if not exists crop_height int;
+alter table converter.requests add column if not exists rotation int check ( rotation in (90, 180, 270) );
+alter table converter.requests add column if not exists flip varchar(10);
+alter table converter.requests add column if not exists metadata varchar(10);
+alter table converter.requests add column if not exists batch_id uuid references converter.batches(id);
+alter table converter.requests add column if not exists retry_count int default 0 not null;
+alter table converter.requests add column if not exists last_error text;
+alter table converter.requests add column if not exists priority int default 5 not null check ( priority between 0 and 9 );
+alter table converter.requests add column if not exists filename varchar(80);
+
+update converter.requests r set filename = i.name from converter.images i where i.id = r.source_id and r.filename is null;
+update converter.images set name = hash where hash is not null and name <> hash;
+
+create table if not exists converter.renditions (
+    id uuid default uuid_generate_v1() primary key,
+    request_id uuid not null,
+    name varchar(30) not null,
+    width int check ( width > 0 ),
+    height int check ( height > 0 ),
+    format file_format not null,
+    ratio int check ( ratio > 0  and ratio < 100),
+    image_id uuid,
+
+    unique (request_id, name),
+    foreign key (request_id) references converter.requests(id),
+    foreign key (image_id) references converter.images(id)
+);
+create table if not exists converter.webhooks (
+    id uuid default uuid_generate_v1() primary key,
+    user_id uuid not null,
+    request_id uuid,
+    url varchar(2048) not null,
+    secret varchar(64) not null,
+    created timestamp without time zone default current_timestamp not null,
+
+    foreign key (user_id) references converter.users(id),
+    foreign key (request_id) references converter.requests(id)
+);
+
+create table if not exists converter.webhook_deliveries (
+    id uuid default uuid_generate_v1() primary key,
+    webhook_id uuid not null,
+    request_id uuid not null,
+    attempt int not null,
+    status_code int,
+    error text,
+    created timestamp without time zone default current_timestamp not null,
+
+    foreign key (webhook_id) references converter.webhooks(id) on delete cascade,
+    foreign key (request_id) references converter.requests(id)
+);
+
+create or replace function converter.notify_request_status() returns trigger as $$
+    begin
+        if tg_op = 'UPDATE' and old.status = new.status then
+            return new;
+        end if;
+
+        perform pg_notify('request_status', json_build_object(
+            'request_id', new.id,
+            'user_id', new.user_id,
+            'status', new.status,
+            'target_id', new.target_id)::text);
+        return new;
+    end;
+$$ language plpgsql;
+
+drop trigger if exists request_status_notify on converter.requests;
+create trigger request_status_notify
+    after insert or update of status on converter.requests
+    for each row execute procedure converter.notify_request_status();
+
+create table if not exists converter.outbox (
+    id uuid default uuid_generate_v1() primary key,
+    request_id uuid not null,
+    attempts int default 0 not null,
+    last_error text,
+    created timestamp without time zone default current_timestamp not null,
+
+    foreign key (request_id) references converter.requests(id) on delete cascade
+);
+
+alter table converter.outbox add column if not exists next_attempt timestamp without time zone default current_timestamp not null;
+
+create table if not exists converter.jobs (
+    id uuid default uuid_generate_v1() primary key,
+    request_id uuid not null,
+    payload jsonb not null,
+    priority int default 5 not null,
+    attempts int default 0 not null,
+    available_at timestamp with time zone default current_timestamp not null,
+    locked_by varchar(100),
+    locked_until timestamp with time zone,
+    last_error text,
+    created timestamp without time zone default current_timestamp not null,
+
+    foreign key (request_id) references converter.requests(id) on delete cascade
+);
+
+alter table converter.jobs add column if not exists priority int default 5 not null;
+
+create index if not exists jobs_priority_idx on converter.jobs (priority desc, available_at);
+
+create table if not exists converter.account_jobs (
+    id uuid default uuid_generate_v1() primary key,
+    user_id uuid not null,
+    kind varchar(10) not null check ( kind in ('delete', 'export') ),
+    status status default 'queued' not null,
+    file_id uuid,
+    attempts int default 0 not null,
+    available_at timestamp with time zone default current_timestamp not null,
+    locked_until timestamp with time zone,
+    last_error text,
+    created timestamp without time zone default current_timestamp not null,
+    updated timestamp without time zone default current_timestamp not null
+);
+
+create index if not exists account_jobs_user_idx on converter.account_jobs (user_id, kind);
+
+create table if not exists converter.refresh_tokens (
+    id uuid default uuid_generate_v1() primary key,
+    user_id uuid not null,
+    family_id uuid not null,
+    token_hash char(64) unique not null,
+    expires timestamp with time zone not null,
+    used timestamp with time zone,
+    revoked timestamp with time zone,
+    created timestamp without time zone default current_timestamp not null,
+
+    foreign key (user_id) references converter.users(id) on delete cascade
+);
+
+create index if not exists refresh_tokens_family_idx on converter.refresh_tokens (family_id);
@@ -20,6 +20,7 @@ import (
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
 
+	"github.com/Konstantsiy/image-converter/internal/converter"
 	"github.com/Konstantsiy/image-converter/pkg/hash"
 )
 
@@ -104,7 +105,7 @@ func (s *APITestSuite) TestGetRequestsHistory() {
 	s.NoError(err)
 
 	s.T().Log("insert user request for testing")
-	requestID, err := s.repos.requests.InsertRequest(context.Background(), userID, sourceID, defaultSourceFormat, defaultTargetFormat, 99)
+	requestID, err := s.repos.requests.InsertRequest(context.Background(), userID, sourceID, defaultFile, defaultSourceFormat, defaultTargetFormat, 99, converter.Options{})
 	s.NoError(err)
 
 	jwt, err := s.tm.GenerateAccessToken(userID)
@@ -153,7 +154,7 @@ func (s *APITestSuite) TestDownloadImage() {
 	s.NoError(err)
 
 	s.T().Log("insert user request for testing")
-	_, err = s.repos.requests.InsertRequest(context.Background(), userID, sourceID, defaultSourceFormat, defaultTargetFormat, 99)
+	_, err = s.repos.requests.InsertRequest(context.Background(), userID, sourceID, defaultFile, defaultSourceFormat, defaultTargetFormat, 99, converter.Options{})
 	s.NoError(err)
 
 	jwt, err := s.tm.GenerateAccessToken(userID)
@@ -235,10 +236,6 @@ func (s *APITestSuite) TestConvertImage() {
 	s.T().Log("mock the storage on error-free file saving")
 	s.mocks.storageMock.EXPECT().UploadFile(gomock.Any(), gomock.Any()).Return(nil)
 
-	s.T().Log("mock the producer to send a message to the queue")
-	s.mocks.producerMock.EXPECT().
-		SendToQueue(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
-
 	s.T().Log("make http test conversion request")
 	w := httptest.NewRecorder()
 	req := createMockRequest(s.T(), testConversionURL, http.MethodPost)
@@ -249,4 +246,10 @@ func (s *APITestSuite) TestConvertImage() {
 
 	s.T().Log("check http status code")
 	s.Equal(http.StatusAccepted, w.Result().StatusCode)
+
+	s.T().Log("check that the request is saved to the outbox")
+	var count int
+	err = s.db.QueryRow("SELECT count(*) FROM converter.outbox;").Scan(&count)
+	s.NoError(err)
+	s.Equal(1, count)
 }
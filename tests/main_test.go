@@ -7,8 +7,6 @@ import (
 	"os"
 	"testing"
 
-	mockqueue "github.com/Konstantsiy/image-converter/internal/queue/mock"
-
 	"github.com/golang/mock/gomock"
 
 	mockstorage "github.com/Konstantsiy/image-converter/internal/storage/mock"
@@ -46,8 +44,7 @@ type repositories struct {
 }
 
 type mocks struct {
-	storageMock  *mockstorage.MockStorage
-	producerMock *mockqueue.MockProducer
+	storageMock *mockstorage.MockStorage
 }
 
 func TestAPISuite(t *testing.T) {
@@ -98,8 +95,7 @@ func (s *APITestSuite) initMocks() {
 	s.T().Log("init mocks")
 	s.mc = gomock.NewController(s.T())
 	s.mocks = &mocks{
-		storageMock:  mockstorage.NewMockStorage(s.mc),
-		producerMock: mockqueue.NewMockProducer(s.mc),
+		storageMock: mockstorage.NewMockStorage(s.mc),
 	}
 }
 
@@ -134,18 +130,44 @@ func (s *APITestSuite) initDependencies(conf *config.Config) {
 		s.FailWithError(fmt.Errorf("requests repository creating error: %w", err))
 	}
 
+	batchesRepo, err := repository.NewBatchesRepository(s.db)
+	if err != nil {
+		s.FailWithError(fmt.Errorf("batches repository creating error: %w", err))
+	}
+
+	webhooksRepo, err := repository.NewWebhooksRepository(s.db)
+	if err != nil {
+		s.FailWithError(fmt.Errorf("webhooks repository creating error: %w", err))
+	}
+
+	tokensRepo, err := repository.NewRefreshTokensRepository(s.db)
+	if err != nil {
+		s.FailWithError(fmt.Errorf("refresh tokens repository creating error: %w", err))
+	}
+
+	accountJobsRepo, err := repository.NewAccountJobsRepository(s.db)
+	if err != nil {
+		s.FailWithError(fmt.Errorf("account jobs repository creating error: %w", err))
+	}
+
 	s.repos = &repositories{
 		users:    usersRepo,
 		images:   imagesRepo,
 		requests: requestsRepo,
 	}
 
-	authService := service.NewAuthService(usersRepo, s.tm)
-	imagesService := service.NewImageService(imagesRepo, requestsRepo, s.mocks.storageMock)
-	requestsService := service.NewRequestsService(requestsRepo)
+	authService := service.NewAuthService(usersRepo, tokensRepo, s.tm)
+	imagesService := service.NewImageService(imagesRepo, requestsRepo, usersRepo, s.mocks.storageMock)
+	eventsBroker := service.NewRequestEventsBroker()
+	requestsService := service.NewRequestsService(requestsRepo, imagesRepo, s.mocks.storageMock, eventsBroker)
+	batchService := service.NewBatchService(batchesRepo, imagesService, s.mocks.storageMock)
+	webhookService := service.NewWebhooksService(webhooksRepo)
+	accountService := service.NewAccountService(accountJobsRepo, usersRepo, requestsRepo, imagesRepo, s.mocks.storageMock,
+		conf.AccountsConf)
 
 	s.T().Log("init application server")
-	s.serv = server.NewServer(authService, imagesService, requestsService, s.mocks.producerMock)
+	s.serv = server.NewServer(authService, imagesService, requestsService, batchService, webhookService, eventsBroker,
+		accountService)
 	s.router = mux.NewRouter()
 	s.T().Log("register http routing")
 	s.serv.RegisterRoutes(s.router)
@@ -0,0 +1,48 @@
+package tests
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Konstantsiy/image-converter/internal/config"
+	"github.com/Konstantsiy/image-converter/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestS3Storage runs against the S3-compatible store of docker-compose.test.yml (MinIO).
+func TestS3Storage(t *testing.T) {
+	conf, err := config.Load()
+	require.NoError(t, err)
+	if conf.AWSConf.Endpoint == "" {
+		t.Skip("AWS_ENDPOINT is not set")
+	}
+
+	st, err := storage.NewStorage(conf.AWSConf)
+	require.NoError(t, err)
+
+	fileID := fmt.Sprintf("test-%d", time.Now().UnixNano())
+	require.NoError(t, st.UploadFile(bytes.NewReader([]byte("image")), fileID))
+
+	file, err := st.DownloadFile(fileID)
+	require.NoError(t, err)
+	defer file.Close()
+	data, err := ioutil.ReadAll(file)
+	require.NoError(t, err)
+	assert.Equal(t, "image", string(data))
+
+	url, err := st.GetDownloadURL(fileID)
+	require.NoError(t, err)
+
+	resp, err := http.Get(url)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	data, err = ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "image", string(data))
+}